@@ -0,0 +1,124 @@
+package example
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/appender"
+)
+
+func AppendWithWriter(a types.Appender, path string) {
+	// appender.Create calls CreateAppend, and returns an io.WriteCloser.
+	//
+	// Small writes are buffered, and sent by WriteAppend once 1 MiB is
+	// buffered, or after 5 seconds.
+	w, err := appender.Create(context.Background(), a, path, appender.WriterOptions{
+		BufferSize:    1024 * 1024,
+		FlushInterval: 5 * time.Second,
+	})
+	if err != nil {
+		log.Fatalf("appender.Create %v: %v", path, err)
+	}
+
+	// The Writer could be given to a logger.
+	logger := log.New(w, "", log.LstdFlags)
+	for i := 0; i < 1000; i++ {
+		logger.Printf("line %d", i)
+	}
+
+	// Close flushes the buffer and calls CommitAppend.
+	if err := w.Close(); err != nil {
+		log.Fatalf("close %v: %v", path, err)
+	}
+
+	log.Printf("append size: %d", w.Offset())
+}
+
+func AppendWithWriterToExistingFile(store types.Storager, path string) {
+	a, ok := store.(types.Appender)
+	if !ok {
+		log.Fatalf("Appender unimplemented")
+	}
+
+	o, err := store.Stat(path)
+	if err != nil {
+		log.Fatalf("Stat %v: %v", path, err)
+	}
+
+	// NewWriter continues at the end of the object returned by Stat.
+	w := appender.NewWriter(context.Background(), a, o, appender.WriterOptions{})
+	fmt.Fprintf(w, "appended at %s\n", time.Now())
+	if err := w.Close(); err != nil {
+		log.Fatalf("close %v: %v", path, err)
+	}
+}
+
+func AppendWithEmulation(store types.Storager, path string) {
+	// appender.Appendable returns store if it implements Appender, or
+	// emulates appends by rewriting the object.
+	//
+	// Every emulated WriteAppend rewrites the whole object, so appends
+	// should be buffered with a large BufferSize.
+	a := appender.Appendable(store, appender.EmulatorOptions{})
+	if e, ok := a.(*appender.Emulator); ok {
+		log.Printf("append emulated by %s", e.Strategy())
+	}
+
+	o, err := store.Stat(path)
+	if err != nil {
+		log.Fatalf("Stat %v: %v", path, err)
+	}
+
+	w := appender.NewWriter(context.Background(), a, o, appender.WriterOptions{
+		BufferSize: 64 * 1024 * 1024,
+	})
+	fmt.Fprintf(w, "appended at %s\n", time.Now())
+
+	// An emulated append fails with ErrConflict if the object has been
+	// changed by someone else before it. A change racing with the rewrite
+	// is lost, so only one writer should append to the object.
+	err = w.Close()
+	if errors.Is(err, appender.ErrConflict) {
+		log.Fatalf("%v has been changed concurrently", path)
+	}
+	if err != nil {
+		log.Fatalf("close %v: %v", path, err)
+	}
+}
+
+func AppendWithSession(store types.Storager, path string) {
+	ctx := context.Background()
+
+	// appender.OpenSession keeps a journal of the appended offset. An append
+	// left pending by a crash is completed here before returning.
+	s, err := appender.OpenSession(ctx, store, path, "append-session.json", appender.SessionOptions{
+		Retries:  5,
+		Verify:   true,
+		ErrorLog: log.Printf,
+	})
+	if err != nil {
+		log.Fatalf("OpenSession %v: %v", path, err)
+	}
+
+	// If WriteAppend fails, Append stats the object and sends only the
+	// bytes which didn't land, so nothing is duplicated or lost.
+	for i := 0; i < 10; i++ {
+		err = s.Append(ctx, []byte(fmt.Sprintf("record %d\n", i)))
+		if errors.Is(err, appender.ErrOffsetMismatch) {
+			log.Fatalf("%v has been appended by someone else", path)
+		}
+		if err != nil {
+			log.Fatalf("append %v: %v", path, err)
+		}
+	}
+
+	if err := s.Close(ctx); err != nil {
+		log.Fatalf("close %v: %v", path, err)
+	}
+	log.Printf("append size: %d", s.Offset())
+}
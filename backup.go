@@ -0,0 +1,77 @@
+//go:build go1.16
+// +build go1.16
+
+package example
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.beyondstorage.io/v5/pkg/fswrap"
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/backup"
+)
+
+func BackupDir(store types.Storager, dir string) {
+	// backup.New splits files into content-defined chunks, so that a
+	// change in a large file only uploads the chunks around the change.
+	repo := backup.New(store, backup.Options{})
+
+	s, err := repo.Backup(context.Background(), dir)
+	if err != nil {
+		log.Fatalf("backup %v: %v", dir, err)
+	}
+
+	log.Printf("snapshot %s: %d files, %d unchanged, %d new chunks of %d bytes",
+		s.ID, s.Summary.Files, s.Summary.Unchanged, s.Summary.NewChunks, s.Summary.NewBytes)
+}
+
+func RestoreSnapshot(store types.Storager, id, dir string) {
+	repo := backup.New(store, backup.Options{})
+
+	// Restore verifies every chunk against its digest, id can be
+	// backup.Latest.
+	err := repo.Restore(context.Background(), id, dir)
+	if err != nil {
+		log.Fatalf("restore %v: %v", id, err)
+	}
+}
+
+func RestoreSnapshotFromFS(store types.Storager, id, dir string) {
+	// backup.NewFS reads the repository through io/fs, which is read only.
+	repo := backup.NewFS(fswrap.Fs(store), backup.Options{})
+
+	err := repo.Restore(context.Background(), id, dir)
+	if err != nil {
+		log.Fatalf("restore %v: %v", id, err)
+	}
+}
+
+func PruneSnapshots(store types.Storager) {
+	ctx := context.Background()
+	repo := backup.New(store, backup.Options{})
+
+	// Keep the last 7 snapshots of every dir, and all snapshots of the
+	// last 30 days. Chunks only referenced by removed snapshots are
+	// deleted.
+	stats, err := repo.Prune(ctx, backup.PruneOptions{
+		KeepLast:   7,
+		KeepWithin: 30 * 24 * time.Hour,
+	})
+	if err != nil {
+		log.Fatalf("prune: %v", err)
+	}
+	log.Printf("removed %d snapshots, deleted %d chunks of %d bytes",
+		len(stats.Removed), stats.DeletedChunks, stats.DeletedBytes)
+
+	// Verify with readData downloads every chunk.
+	report, err := repo.Verify(ctx, true)
+	if err != nil {
+		log.Fatalf("verify: %v", err)
+	}
+	if !report.OK() {
+		log.Fatalf("%d chunks missing, %d chunks corrupted", len(report.Missing), len(report.Corrupted))
+	}
+}
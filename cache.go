@@ -0,0 +1,53 @@
+package example
+
+import (
+	"bytes"
+	"log"
+	"os"
+
+	fs "go.beyondstorage.io/services/fs/v4"
+	"go.beyondstorage.io/v5/pairs"
+
+	"go.beyondstorage.io/example/pkg/cache"
+)
+
+func NewS3WithLocalCache() *cache.Cache {
+	s3, err := NewS3()
+	if err != nil {
+		log.Fatalf("NewS3: %v", err)
+	}
+
+	// Blocks are stored in a local fs storager.
+	local, err := fs.NewStorager(pairs.WithWorkDir(os.Getenv("STORAGE_CACHE_WORKDIR")))
+	if err != nil {
+		log.Fatalf("new local storager: %v", err)
+	}
+
+	// cache.New caches reads of s3 in 4 MiB blocks, and evicts the least
+	// recently used blocks once they are larger than 10 GiB.
+	//
+	// Every Read validates the cached blocks with a Stat on s3, unless the
+	// last Stat is younger than `ValidateAfter`.
+	c, err := cache.New(s3, local, cache.Options{
+		BlockSize: 4 * 1024 * 1024,
+		MaxSize:   10 * 1024 * 1024 * 1024,
+	})
+	if err != nil {
+		log.Fatalf("cache.New: %v", err)
+	}
+	return c
+}
+
+func ReadRangeWithCache(c *cache.Cache, path string, offset, size int64) []byte {
+	var buf bytes.Buffer
+
+	// Only blocks covering the range are fetched from s3 and cached.
+	_, err := c.Read(path, &buf, pairs.WithOffset(offset), pairs.WithSize(size))
+	if err != nil {
+		log.Fatalf("read %v: %v", path, err)
+	}
+
+	stats := c.Stats()
+	log.Printf("cache hits %d, misses %d, %d bytes cached", stats.Hits, stats.Misses, stats.Size)
+	return buf.Bytes()
+}
@@ -0,0 +1,88 @@
+package example
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/cas"
+)
+
+func CacheBuildOutput(store types.Storager, name string, files []string) {
+	ctx := context.Background()
+
+	// cas.New stores blobs by their SHA-256, so that outputs shared by
+	// builds are uploaded once.
+	s := cas.New(store, cas.Options{})
+
+	m := &cas.Manifest{Name: name, Blobs: make(map[string]cas.Blob)}
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			log.Fatalf("open %v: %v", file, err)
+		}
+
+		// Put skips the upload if the blob exists.
+		blob, err := s.Put(ctx, f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("put %v: %v", file, err)
+		}
+		m.Blobs[filepath.ToSlash(file)] = blob
+	}
+
+	// SetManifest references the blobs by name, and fails if some of them
+	// don't exist anymore, like blobs deleted by a concurrent GC.
+	err := s.SetManifest(ctx, m)
+	if err != nil {
+		log.Fatalf("set manifest %v: %v", name, err)
+	}
+
+	log.Printf("cached %d files as %v", len(m.Blobs), name)
+}
+
+func RestoreBuildOutput(store types.Storager, name, dir string) {
+	ctx := context.Background()
+	s := cas.New(store, cas.Options{})
+
+	m, err := s.GetManifest(ctx, name)
+	if err != nil {
+		log.Fatalf("get manifest %v: %v", name, err)
+	}
+
+	for file, blob := range m.Blobs {
+		local := filepath.Join(dir, filepath.FromSlash(file))
+		if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+			log.Fatalf("mkdir %v: %v", local, err)
+		}
+		f, err := os.Create(local)
+		if err != nil {
+			log.Fatalf("create %v: %v", local, err)
+		}
+
+		// Get verifies the SHA-256 of the blob while reading.
+		_, err = s.Get(ctx, blob.Digest, f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("get %v: %v", file, err)
+		}
+	}
+}
+
+func CollectGarbage(store types.Storager) {
+	// Blobs younger than Grace are kept, so that builds putting blobs
+	// while GC runs don't lose them before SetManifest.
+	s := cas.New(store, cas.Options{Grace: 24 * time.Hour})
+
+	stats, err := s.GC(context.Background(), false)
+	if err != nil {
+		log.Fatalf("gc: %v", err)
+	}
+
+	log.Printf("%d manifests, %d blobs, deleted %d blobs of %d bytes",
+		stats.Manifests, stats.Blobs, len(stats.Deleted), stats.DeletedBytes)
+}
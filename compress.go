@@ -0,0 +1,47 @@
+package example
+
+import (
+	"log"
+
+	"go.beyondstorage.io/example/pkg/compress"
+)
+
+func NewS3WithCompression() *compress.Storager {
+	s3, err := NewS3()
+	if err != nil {
+		log.Fatalf("NewS3: %v", err)
+	}
+
+	// compress.New compresses objects on write, and decompresses them on
+	// read. The codec is recorded by the suffix of the stored object, like
+	// `logs/app.log~gz`.
+	return compress.New(s3, compress.Options{
+		Rules: []compress.Rule{
+			{Prefix: "logs/", Codec: compress.Gzip},
+			// Seekable objects can still be read by range cheaply.
+			{Prefix: "datasets/", Codec: compress.Seekable},
+			{Prefix: "media/", Codec: compress.None},
+		},
+		// Paths matching no rule are compressed with zstd if they look
+		// like text.
+		Default: compress.Auto,
+		Sniffed: compress.Zstd,
+	})
+}
+
+func WriteDataCompressed() {
+	store := NewS3WithCompression()
+
+	// WriteData writes to `logs/app.log~gz` through the wrapper, the
+	// content is read back uncompressed.
+	WriteData(store, "logs/app.log")
+	ReadWhole(store, "logs/app.log")
+}
+
+func ReadRangeCompressed() {
+	store := NewS3WithCompression()
+
+	// Offset and size are in uncompressed bytes. Only the frames covering
+	// the range are read from `datasets/train.csv~zst`.
+	ReadRange(store, "datasets/train.csv", 1024*1024, 4096)
+}
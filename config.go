@@ -0,0 +1,131 @@
+package example
+
+import (
+	"encoding/base64"
+	"fmt"
+	"log"
+
+	// Service packages register themselves to services.NewStorager on import.
+	_ "go.beyondstorage.io/services/bos/v2"
+	_ "go.beyondstorage.io/services/cos/v3"
+	_ "go.beyondstorage.io/services/fs/v4"
+	_ "go.beyondstorage.io/services/ftp"
+	_ "go.beyondstorage.io/services/gdrive"
+	_ "go.beyondstorage.io/services/hdfs"
+	_ "go.beyondstorage.io/services/ipfs"
+	_ "go.beyondstorage.io/services/minio"
+	s3 "go.beyondstorage.io/services/s3/v3"
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/config"
+)
+
+func init() {
+	// Default pairs are service specific, register how to build them for s3 so
+	// that profiles could configure server side encryption.
+	config.RegisterDefaultPairs("s3", S3DefaultPairs)
+}
+
+// S3DefaultPairs converts the `default_pairs` of a s3 profile, like:
+//
+//	default_pairs:
+//	  write:
+//	    server_side_encryption: aws:kms
+//	    server_side_encryption_aws_kms_key_id: 1234abcd-12ab-34cd-56ef-1234567890ab
+//
+// `server_side_encryption_customer_key` must be base64 encoded.
+func S3DefaultPairs(ops map[string]map[string]string) (types.Pair, error) {
+	var dp s3.DefaultStoragePairs
+	for op, kv := range ops {
+		ps := make([]types.Pair, 0, len(kv))
+		for k, v := range kv {
+			switch k {
+			case "server_side_encryption":
+				ps = append(ps, s3.WithServerSideEncryption(v))
+			case "server_side_encryption_aws_kms_key_id":
+				ps = append(ps, s3.WithServerSideEncryptionAwsKmsKeyID(v))
+			case "server_side_encryption_context":
+				ps = append(ps, s3.WithServerSideEncryptionContext(v))
+			case "server_side_encryption_bucket_key_enabled":
+				if v == "true" {
+					ps = append(ps, s3.WithServerSideEncryptionBucketKeyEnabled())
+				}
+			case "server_side_encryption_customer_algorithm":
+				ps = append(ps, s3.WithServerSideEncryptionCustomerAlgorithm(v))
+			case "server_side_encryption_customer_key":
+				key, err := base64.StdEncoding.DecodeString(v)
+				if err != nil {
+					return types.Pair{}, fmt.Errorf("%s: %w", k, err)
+				}
+				ps = append(ps, s3.WithServerSideEncryptionCustomerKey(key))
+			default:
+				return types.Pair{}, fmt.Errorf("unsupported pair %s", k)
+			}
+		}
+
+		switch op {
+		case "create":
+			dp.Create = ps
+		case "read":
+			dp.Read = ps
+		case "write":
+			dp.Write = ps
+		default:
+			return types.Pair{}, fmt.Errorf("unsupported operation %s", op)
+		}
+	}
+	return s3.WithDefaultStoragePairs(dp), nil
+}
+
+// LoadStoragers creates all storagers defined in a config file, for example:
+//
+//	profiles:
+//	  backups:
+//	    type: s3
+//	    credential: hmac:${STORAGE_S3_ACCESS_KEY}:${STORAGE_S3_SECRET_KEY}
+//	    location: ap-east-1
+//	    name: backups
+//	    work_dir: /daily/
+//	    features: [virtual_dir]
+//	    default_pairs:
+//	      write:
+//	        server_side_encryption: AES256
+//	  local:
+//	    type: fs
+//	    work_dir: ${STORAGE_FS_WORKDIR:-/tmp/storage/}
+//
+// The format is detected by the file extension: .yaml, .yml, .toml or .json.
+func LoadStoragers(path string) map[string]types.Storager {
+	// config.Load reads the file, replaces `${ENV}` and `${ENV:-default}` with
+	// environment variables, and validates every profile against the schema of
+	// its type. Unknown fields, unknown types, missing required fields and
+	// unset variables are all reported as errors.
+	c, err := config.Load(path)
+	if err != nil {
+		log.Fatalf("config.Load %v: %v", path, err)
+	}
+
+	stores, err := c.Open()
+	if err != nil {
+		log.Fatalf("Open %v: %v", path, err)
+	}
+
+	for _, name := range c.Names() {
+		log.Printf("profile %s: %s", name, stores[name])
+	}
+	return stores
+}
+
+// NewStoragerFromProfile creates the storager of a single profile.
+func NewStoragerFromProfile(path, name string) (types.Storager, error) {
+	c, err := config.Load(path)
+	if err != nil {
+		return nil, err
+	}
+
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("profile %s not found in %s", name, path)
+	}
+	return p.NewStorager()
+}
@@ -0,0 +1,23 @@
+package example
+
+import (
+	"log"
+
+	"go.beyondstorage.io/example/pkg/connstr"
+)
+
+func ParseConnStr(s string) *connstr.ConnStr {
+	// connstr.Parse unescapes the name, work dir and values, and validates them
+	// against the service type.
+	//
+	// Misspelled pairs are rejected with a hint, for example
+	// `s3://bucket/?enbale_virtual_dir` fails with
+	// `unknown pair: enbale_virtual_dir for s3, did you mean enable_virtual_dir?`
+	c, err := connstr.Parse(s)
+	if err != nil {
+		log.Fatalf("Parse %v: %v", s, err)
+	}
+
+	log.Printf("type: %s, name: %s, work_dir: %s, endpoint: %s", c.Type, c.Name, c.WorkDir, c.Endpoint)
+	return c
+}
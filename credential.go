@@ -0,0 +1,61 @@
+package example
+
+import (
+	"context"
+	"net/http"
+	"os"
+
+	s3 "go.beyondstorage.io/services/s3/v3"
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/credential"
+)
+
+// newS3WithCredential is used by credential.NewStorager to create a new s3
+// storager every time the credential is rotated.
+func newS3WithCredential(cred string) (types.Storager, error) {
+	return s3.NewStorager(
+		pairs.WithWorkDir(os.Getenv("STORAGE_S3_WORKDIR")),
+		pairs.WithCredential(cred),
+		pairs.WithEndpoint(os.Getenv("STORAGE_S3_ENDPOINT")),
+		pairs.WithLocation(os.Getenv("STORAGE_S3_LOCATION")),
+		pairs.WithName(os.Getenv("STORAGE_S3_NAME")),
+	)
+}
+
+func NewS3WithEnvCredential() (types.Storager, error) {
+	// NewEnv reads environment variables before every operation, and joins
+	// them after the protocol: `hmac:<access_key_id>:<secret_access_key>`.
+	p := credential.NewEnv("hmac", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY")
+
+	return credential.NewStorager(context.Background(), p, newS3WithCredential)
+}
+
+func NewS3WithCredentialFile(path string) (types.Storager, error) {
+	// NewFile reads the file again once it's modified, the file could contain
+	// `hmac:ak:sk` or a JSON document like:
+	//
+	//	{"AccessKeyId": "ak", "SecretAccessKey": "sk", "Expiration": "2021-09-01T00:00:00Z"}
+	p := credential.NewFile(path)
+
+	return credential.NewStorager(context.Background(), p, newS3WithCredential)
+}
+
+func NewS3WithCredentialEndpoint(url, token string) (types.Storager, error) {
+	// NewHTTP fetches credentials from a metadata-style endpoint, and refreshes
+	// them 5 minutes before `Expiration`.
+	p := credential.NewHTTP(url, http.Header{
+		"Authorization": []string{token},
+	})
+
+	return credential.NewStorager(context.Background(), p, newS3WithCredential)
+}
+
+func NewS3WithCredentialCommand(name string, args ...string) (types.Storager, error) {
+	// NewCommand runs an external command, its output has the same format
+	// as the credential file.
+	p := credential.NewCommand(name, args...)
+
+	return credential.NewStorager(context.Background(), p, newS3WithCredential)
+}
@@ -0,0 +1,55 @@
+package example
+
+import (
+	"context"
+	"log"
+
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/etag"
+)
+
+func ComputeMultipartETag(local string) {
+	// etag.ComputeFile computes the ETag of local uploaded in parts of
+	// 8 MiB, like `<md5 of part md5s>-<number of parts>`.
+	e, err := etag.ComputeFile(local, 8*1024*1024)
+	if err != nil {
+		log.Fatalf("compute etag of %v: %v", local, err)
+	}
+
+	log.Printf("etag: %s, %d parts", e, e.Parts)
+}
+
+func CheckMultipartETag(multiparter types.Multiparter, o *types.Object, parts []*types.Part) {
+	// etag.FromParts computes the expected ETag from the parts returned by
+	// WriteMultipart, to be compared with Stat after CompleteMultipart.
+	e, err := etag.FromParts(parts)
+	if err != nil {
+		log.Fatalf("etag from parts: %v", err)
+	}
+
+	err = multiparter.CompleteMultipart(o, parts)
+	if err != nil {
+		log.Fatalf("CompleteMultipart %v: %v", o.Path, err)
+	}
+
+	log.Printf("expected etag: %s", e)
+}
+
+func VerifyLocalCopy(store types.Storager, path, local string) {
+	// etag.VerifyObject compares the size and ETag of the object to local.
+	//
+	// For a multipart ETag, the part size is inferred from the ETag and the
+	// size of the object.
+	m, err := etag.VerifyObject(context.Background(), store, path, local)
+	if err != nil {
+		log.Fatalf("verify %v: %v", path, err)
+	}
+	if !m.OK {
+		log.Fatalf("%v differs from %v", local, path)
+	}
+
+	if m.PartSize > 0 {
+		log.Printf("%v matches, uploaded in parts of %d bytes", local, m.PartSize)
+	}
+}
@@ -0,0 +1,50 @@
+//go:build go1.16
+// +build go1.16
+
+package example
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/fileserver"
+)
+
+func ServeHTTP(store types.Storager, addr string) {
+	// fileserver.New creates an http.Handler serving files under store's work dir.
+	//
+	// `IndexFile` will be served for a directory request if it exists.
+	// Otherwise, the directory will be listed as HTML, or as JSON for requests
+	// with `?format=json` or `Accept: application/json`.
+	//
+	// Range, If-None-Match, If-Modified-Since and HEAD requests are supported.
+	h := fileserver.New(store, fileserver.Options{
+		IndexFile: "index.html",
+	})
+
+	log.Printf("listening on %s", addr)
+
+	err := http.ListenAndServe(addr, h)
+	if err != nil {
+		log.Fatalf("ListenAndServe %v: %v", addr, err)
+	}
+}
+
+func ServeHTTPWithRedirect(store types.Storager, addr string, size int64) {
+	// Objects larger than `RedirectSize` will be redirected to a presigned URL,
+	// so that the client downloads them from the service directly.
+	//
+	// `store` should implement `StorageHTTPSigner`, otherwise all objects are proxied.
+	h := fileserver.New(store, fileserver.Options{
+		RedirectSize:   size,
+		RedirectExpire: 10 * time.Minute,
+	})
+
+	err := http.ListenAndServe(addr, h)
+	if err != nil {
+		log.Fatalf("ListenAndServe %v: %v", addr, err)
+	}
+}
@@ -3,6 +3,8 @@ module go.beyondstorage.io/example
 go 1.16
 
 require (
+	github.com/klauspost/compress v1.13.5
+	github.com/pelletier/go-toml v1.9.4
 	go.beyondstorage.io/services/bos/v2 v2.0.0
 	go.beyondstorage.io/services/cos/v3 v3.0.0
 	go.beyondstorage.io/services/fs/v4 v4.0.0
@@ -13,4 +15,6 @@ require (
 	go.beyondstorage.io/services/minio v0.3.0
 	go.beyondstorage.io/services/s3/v3 v3.0.1
 	go.beyondstorage.io/v5 v5.0.0
+	golang.org/x/net v0.0.0-20210503060351-7fd8e65b6420
+	gopkg.in/yaml.v3 v3.0.0-20200313102051-9f266ea9e77c
 )
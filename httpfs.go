@@ -61,10 +61,12 @@ func HttpFsRead(store types.Storager, path string) {
 		log.Fatalf("Stat %v: %v", path, err)
 	}
 
-	size := info.Size()
-	data := make([]byte, 0, size+1)
+	// Read fills at most len(data) bytes, so data must have a length instead of
+	// only a capacity. A single Read could also return less than len(data),
+	// use io.ReadFull to read until data is full.
+	data := make([]byte, info.Size())
 
-	n, err := f.Read(data)
+	n, err := io.ReadFull(f, data)
 	if err != nil {
 		log.Fatalf("Read %v: %v", path, err)
 	}
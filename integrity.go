@@ -0,0 +1,58 @@
+package example
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+
+	"go.beyondstorage.io/v5/pairs"
+
+	"go.beyondstorage.io/example/pkg/integrity"
+)
+
+func NewS3WithIntegrity() *integrity.Storager {
+	s3, err := NewS3()
+	if err != nil {
+		log.Fatalf("NewS3: %v", err)
+	}
+
+	// integrity.New computes checksums while writing, and verifies them
+	// while reading.
+	//
+	// Checksums are kept in `<path>.integrity` next to the object. Content
+	// is verified in blocks of `BlockSize`, so that ranged reads are
+	// verified too.
+	return integrity.New(s3, integrity.Options{
+		Algorithms: []string{integrity.MD5, integrity.CRC32C, integrity.SHA256},
+		BlockSize:  4 * 1024 * 1024,
+		// s3 checks the Content-MD5 of seekable readers.
+		ContentMD5: true,
+	})
+}
+
+func WriteAndVerify(s *integrity.Storager, path string, content []byte) {
+	// bytes.Reader is seekable, the Content-MD5 is sent along.
+	_, err := s.Write(path, bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		log.Fatalf("write %v: %v", path, err)
+	}
+
+	var buf bytes.Buffer
+	_, err = s.Read(path, &buf, pairs.WithOffset(1024), pairs.WithSize(1024))
+
+	var mismatch *integrity.MismatchError
+	if errors.As(err, &mismatch) {
+		log.Fatalf("%v is corrupted: %s at [%d, %d)", path, mismatch.Algorithm,
+			mismatch.Offset, mismatch.Offset+mismatch.Size)
+	}
+	if err != nil {
+		log.Fatalf("read %v: %v", path, err)
+	}
+
+	m, err := s.Manifest(context.Background(), path)
+	if err != nil {
+		log.Fatalf("manifest %v: %v", path, err)
+	}
+	log.Printf("sha256: %s", m.Sums[integrity.SHA256])
+}
@@ -4,12 +4,17 @@
 package example
 
 import (
+	"archive/zip"
+	"io"
 	"io/fs"
 	"io/ioutil"
 	"log"
+	"testing/fstest"
 
 	"go.beyondstorage.io/v5/pkg/fswrap"
 	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/iofs"
 )
 
 func FSOpen(store types.Storager, path string) {
@@ -113,13 +118,107 @@ func FileRead(store types.Storager, path string) {
 		log.Fatalf("Stat %v: %v", path, err)
 	}
 
-	size := info.Size()
-	data := make([]byte, 0, size+1)
+	// Read fills at most len(data) bytes, so data must have a length instead of
+	// only a capacity. A single Read could also return less than len(data),
+	// use io.ReadFull to read until data is full.
+	data := make([]byte, info.Size())
 
-	n, err := f.Read(data)
+	n, err := io.ReadFull(f, data)
 	if err != nil {
 		log.Fatalf("Read %v: %v", path, err)
 	}
 
 	log.Printf("read data size: %d", n)
 }
+
+func FSTestFS(store types.Storager, expected ...string) {
+	// iofs.New returns an fs.FS which implements fs.StatFS, fs.ReadDirFS,
+	// fs.ReadFileFS, fs.GlobFS and fs.SubFS, so no runtime assertion is needed.
+	fsys := iofs.New(store)
+
+	// TestFS walks the whole tree under work dir and checks that every optional
+	// interface behaves the same as the plain Open/Read/ReadDir calls.
+	//
+	// `expected` is a list of files that must be found, e.g. "dir/file.txt".
+	err := fstest.TestFS(fsys, expected...)
+	if err != nil {
+		log.Fatalf("TestFS: %v", err)
+	}
+
+	log.Printf("fs.FS test passed")
+}
+
+func FSSub(store types.Storager, dir string) {
+	fsys := iofs.New(store)
+
+	// Sub returns an fs.FS rooted at `dir`, paths passed to it are relative to `dir`.
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		log.Fatalf("Sub %v: %v", dir, err)
+	}
+
+	// Entries are sorted by file name.
+	list, err := fs.ReadDir(sub, ".")
+	if err != nil {
+		log.Fatalf("ReadDir %v: %v", dir, err)
+	}
+
+	for _, entry := range list {
+		log.Printf("DirEntry: %s, %v", entry.Name(), entry.Type())
+	}
+}
+
+func FileReadAt(store types.Storager, path string, offset, size int64) {
+	fsys := iofs.New(store)
+
+	f, err := fsys.Open(path)
+	if err != nil {
+		log.Fatalf("Open %v: %v", path, err)
+	}
+
+	defer f.Close()
+
+	// Files opened by iofs implement io.ReaderAt and io.Seeker.
+	// Every call is served by a ranged Read, only the bytes around `offset` will be transferred.
+	ra, ok := f.(io.ReaderAt)
+	if !ok {
+		log.Fatalf("io.ReaderAt unimplemented")
+	}
+
+	data := make([]byte, size)
+
+	n, err := ra.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		log.Fatalf("ReadAt %v: %v", path, err)
+	}
+
+	log.Printf("read data size: %d", n)
+}
+
+func FileReadZip(store types.Storager, path string) {
+	fsys := iofs.New(store)
+
+	f, err := fsys.Open(path)
+	if err != nil {
+		log.Fatalf("Open %v: %v", path, err)
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Fatalf("Stat %v: %v", path, err)
+	}
+
+	// archive/zip reads the central directory at the end of the file first,
+	// then jumps to every file header. With io.ReaderAt, only these parts of
+	// the remote object will be read.
+	zr, err := zip.NewReader(f.(io.ReaderAt), info.Size())
+	if err != nil {
+		log.Fatalf("zip.NewReader %v: %v", path, err)
+	}
+
+	for _, zf := range zr.File {
+		log.Printf("zip entry: %s, %d", zf.Name, zf.UncompressedSize64)
+	}
+}
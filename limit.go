@@ -0,0 +1,59 @@
+package example
+
+import (
+	"log"
+	"time"
+
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/limit"
+)
+
+func NewLimitedStoragers() (*limit.Bucket, []types.Storager) {
+	s3, err := NewS3()
+	if err != nil {
+		log.Fatalf("NewS3: %v", err)
+	}
+	cos, err := NewCos()
+	if err != nil {
+		log.Fatalf("NewCos: %v", err)
+	}
+
+	// limit.NewBucket creates a token bucket with a rate per second and a
+	// burst.
+	//
+	// The uplink bucket is shared by s3 and cos, so that writes to both stay
+	// under 10 MiB/s together.
+	uplink := limit.NewBucket(10*1024*1024, 10*1024*1024)
+	downlink := limit.NewBucket(50*1024*1024, 50*1024*1024)
+
+	s3Limited := limit.New(s3, limit.Limits{
+		ReadBytes:  downlink,
+		WriteBytes: uplink,
+		// Requests to s3 are limited to 100/s, and writes to 20/s.
+		AllOps: limit.NewBucket(100, 100),
+		Ops: map[string]*limit.Bucket{
+			limit.OpWrite: limit.NewBucket(20, 20),
+		},
+	})
+	cosLimited := limit.New(cos, limit.Limits{
+		ReadBytes:  downlink,
+		WriteBytes: uplink,
+	})
+	return uplink, []types.Storager{s3Limited, cosLimited}
+}
+
+func WriteDataLimited() {
+	uplink, stores := NewLimitedStoragers()
+
+	// Limits can be changed at runtime, like giving bulk jobs less bandwidth
+	// at daytime.
+	if h := time.Now().Hour(); h >= 8 && h < 20 {
+		uplink.SetLimit(2*1024*1024, 2*1024*1024)
+	}
+
+	for _, store := range stores {
+		WriteData(store, "limited")
+		ReadWhole(store, "limited")
+	}
+}
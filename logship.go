@@ -0,0 +1,53 @@
+package example
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"go.beyondstorage.io/example/pkg/logship"
+)
+
+func ShipLogsToCos(files []string) {
+	store, err := NewCos()
+	if err != nil {
+		log.Fatalf("NewCos: %v", err)
+	}
+
+	host, _ := os.Hostname()
+
+	// logship.New tails local files, and appends new lines to objects via
+	// Appender.
+	//
+	// Objects are rolled over after 128 MiB or 15 minutes. Progress is kept
+	// in `Checkpoint`, so a restart continues where it stopped.
+	agent, err := logship.New(store, logship.Options{
+		Files:      files,
+		Checkpoint: "/var/lib/logship/checkpoint.json",
+		Name: func(file string, t time.Time) string {
+			return path.Join("logs", host, filepath.Base(file), t.UTC().Format("2006/01/02/150405")+".log")
+		},
+		MaxObjectSize: 128 * 1024 * 1024,
+		MaxObjectAge:  15 * time.Minute,
+		ErrorLog:      log.Printf,
+	})
+	if err != nil {
+		log.Fatalf("logship.New: %v", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	// Run returns once ctx is done.
+	_ = agent.Run(ctx)
+
+	// Flush commits the current objects before exiting.
+	if err := agent.Flush(context.Background()); err != nil {
+		log.Fatalf("flush: %v", err)
+	}
+}
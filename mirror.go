@@ -0,0 +1,51 @@
+package example
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/mirror"
+)
+
+func NewMirror() *mirror.Mirror {
+	cos, err := NewCos()
+	if err != nil {
+		log.Fatalf("NewCos: %v", err)
+	}
+	bos, err := NewBos()
+	if err != nil {
+		log.Fatalf("NewBos: %v", err)
+	}
+
+	// mirror.New creates a Storager which writes to all storagers at once.
+	//
+	// With `Quorum: 1`, Write and Delete succeed as long as one of cos and bos
+	// succeeded. The failed one is recorded in `Queue` to be repaired later.
+	m, err := mirror.New([]types.Storager{cos, bos}, mirror.Options{
+		Quorum:   1,
+		Queue:    mirror.NewFileQueue("mirror-repairs.jsonl"),
+		ErrorLog: log.Printf,
+	})
+	if err != nil {
+		log.Fatalf("mirror.New: %v", err)
+	}
+	return m
+}
+
+func WriteMirrored(m *mirror.Mirror, path string, content string) {
+	_, err := m.Write(path, strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		log.Fatalf("write %v: %v", path, err)
+	}
+
+	// Repair copies the object from a replica having it to the ones which
+	// failed, or deletes it from them if no replica has it anymore.
+	n, err := m.Repair(context.Background())
+	if err != nil {
+		log.Printf("repair: %v", err)
+	}
+	log.Printf("%d replicas repaired", n)
+}
@@ -1,13 +1,13 @@
 package example
 
 import (
-	"fmt"
 	"os"
 
 	bos "go.beyondstorage.io/services/bos/v2"
 	"go.beyondstorage.io/v5/pairs"
-	"go.beyondstorage.io/v5/services"
 	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/connstr"
 )
 
 func NewBos() (types.Storager, error) {
@@ -34,12 +34,15 @@ func NewBos() (types.Storager, error) {
 }
 
 func NewBosFromString() (types.Storager, error) {
-	connStr := fmt.Sprintf(
-		"bos://%s%s?credential=%s&location=%s",
-		os.Getenv("STORAGE_BOS_NAME"),
-		os.Getenv("STORAGE_BOS_WORKDIR"),
-		os.Getenv("STORAGE_BOS_CREDENTIAL"),
-		os.Getenv("STORAGE_BOS_ENDPOINT"),
-	)
-	return services.NewStoragerFromString(connStr)
+	connStr, err := connstr.ConnStr{
+		Type:       "bos",
+		Name:       os.Getenv("STORAGE_BOS_NAME"),
+		WorkDir:    os.Getenv("STORAGE_BOS_WORKDIR"),
+		Credential: os.Getenv("STORAGE_BOS_CREDENTIAL"),
+		Endpoint:   os.Getenv("STORAGE_BOS_ENDPOINT"),
+	}.Build()
+	if err != nil {
+		return nil, err
+	}
+	return connstr.NewStorager(connStr)
 }
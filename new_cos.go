@@ -1,13 +1,13 @@
 package example
 
 import (
-	"fmt"
 	"os"
 
 	cos "go.beyondstorage.io/services/cos/v3"
 	"go.beyondstorage.io/v5/pairs"
-	"go.beyondstorage.io/v5/services"
 	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/connstr"
 )
 
 func NewCos() (types.Storager, error) {
@@ -34,12 +34,15 @@ func NewCos() (types.Storager, error) {
 }
 
 func NewCosFromString() (types.Storager, error) {
-	connStr := fmt.Sprintf(
-		"cos://%s%s?credential=%s&location=%s",
-		os.Getenv("STORAGE_COS_NAME"),
-		os.Getenv("STORAGE_COS_WORKDIR"),
-		os.Getenv("STORAGE_COS_CREDENTIAL"),
-		os.Getenv("STORAGE_COS_LOCATION"),
-	)
-	return services.NewStoragerFromString(connStr)
+	connStr, err := connstr.ConnStr{
+		Type:       "cos",
+		Name:       os.Getenv("STORAGE_COS_NAME"),
+		WorkDir:    os.Getenv("STORAGE_COS_WORKDIR"),
+		Credential: os.Getenv("STORAGE_COS_CREDENTIAL"),
+		Location:   os.Getenv("STORAGE_COS_LOCATION"),
+	}.Build()
+	if err != nil {
+		return nil, err
+	}
+	return connstr.NewStorager(connStr)
 }
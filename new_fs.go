@@ -1,13 +1,13 @@
 package example
 
 import (
-	"fmt"
 	"os"
 
 	fs "go.beyondstorage.io/services/fs/v4"
 	"go.beyondstorage.io/v5/pairs"
-	"go.beyondstorage.io/v5/services"
 	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/connstr"
 )
 
 func NewFs() (types.Storager, error) {
@@ -20,9 +20,12 @@ func NewFs() (types.Storager, error) {
 }
 
 func NewFsFromString() (types.Storager, error) {
-	connStr := fmt.Sprintf(
-		"fs://%s",
-		os.Getenv("STORAGE_FS_WORKDIR"),
-	)
-	return services.NewStoragerFromString(connStr)
+	connStr, err := connstr.ConnStr{
+		Type:    "fs",
+		WorkDir: os.Getenv("STORAGE_FS_WORKDIR"),
+	}.Build()
+	if err != nil {
+		return nil, err
+	}
+	return connstr.NewStorager(connStr)
 }
@@ -1,13 +1,13 @@
 package example
 
 import (
-	"fmt"
 	"os"
 
 	ftp "go.beyondstorage.io/services/ftp"
 	"go.beyondstorage.io/v5/pairs"
-	"go.beyondstorage.io/v5/services"
 	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/connstr"
 )
 
 func NewFTP() (types.Storager, error) {
@@ -30,11 +30,14 @@ func NewFTP() (types.Storager, error) {
 }
 
 func NewFTPFromString() (types.Storager, error) {
-	str := fmt.Sprintf(
-		"ftp://%s?credential=%s&endpoint=%s",
-		os.Getenv("STORAGE_FTP_WORKDIR"),
-		os.Getenv("STORAGE_FTP_CREDENTIAL"),
-		os.Getenv("STORAGE_FTP_ENDPOINT"),
-	)
-	return services.NewStoragerFromString(str)
+	connStr, err := connstr.ConnStr{
+		Type:       "ftp",
+		WorkDir:    os.Getenv("STORAGE_FTP_WORKDIR"),
+		Credential: os.Getenv("STORAGE_FTP_CREDENTIAL"),
+		Endpoint:   os.Getenv("STORAGE_FTP_ENDPOINT"),
+	}.Build()
+	if err != nil {
+		return nil, err
+	}
+	return connstr.NewStorager(connStr)
 }
@@ -1,13 +1,13 @@
 package example
 
 import (
-	"fmt"
 	"os"
 
 	gdrive "go.beyondstorage.io/services/gdrive"
 	"go.beyondstorage.io/v5/pairs"
-	"go.beyondstorage.io/v5/services"
 	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/connstr"
 )
 
 func NewGdrive() (types.Storager, error) {
@@ -28,11 +28,14 @@ func NewGdrive() (types.Storager, error) {
 }
 
 func NewGdriveFromString() (types.Storager, error) {
-	str := fmt.Sprintf(
-		"gdrive://%s%s?credential=%s",
-		os.Getenv("STORAGE_GDRIVE_NAME"),
-		os.Getenv("STORAGE_GDRIVE_WORKDIR"),
-		os.Getenv("STORAGE_GDRIVE_CREDENTIAL"),
-	)
-	return services.NewStoragerFromString(str)
+	connStr, err := connstr.ConnStr{
+		Type:       "gdrive",
+		Name:       os.Getenv("STORAGE_GDRIVE_NAME"),
+		WorkDir:    os.Getenv("STORAGE_GDRIVE_WORKDIR"),
+		Credential: os.Getenv("STORAGE_GDRIVE_CREDENTIAL"),
+	}.Build()
+	if err != nil {
+		return nil, err
+	}
+	return connstr.NewStorager(connStr)
 }
@@ -1,13 +1,13 @@
 package example
 
 import (
-	"fmt"
 	"os"
 
 	hdfs "go.beyondstorage.io/services/hdfs"
 	"go.beyondstorage.io/v5/pairs"
-	"go.beyondstorage.io/v5/services"
 	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/connstr"
 )
 
 func NewHDFS() (types.Storager, error) {
@@ -24,10 +24,13 @@ func NewHDFS() (types.Storager, error) {
 }
 
 func NewHDFSFromString() (types.Storager, error) {
-	str := fmt.Sprintf(
-		"hdfs://%s?endpoint=%s",
-		os.Getenv("STORAGE_HDFS_WORKDIR"),
-		os.Getenv("STORAGE_HDFS_ENDPOINT"),
-	)
-	return services.NewStoragerFromString(str)
+	connStr, err := connstr.ConnStr{
+		Type:     "hdfs",
+		WorkDir:  os.Getenv("STORAGE_HDFS_WORKDIR"),
+		Endpoint: os.Getenv("STORAGE_HDFS_ENDPOINT"),
+	}.Build()
+	if err != nil {
+		return nil, err
+	}
+	return connstr.NewStorager(connStr)
 }
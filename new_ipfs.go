@@ -1,13 +1,13 @@
 package example
 
 import (
-	"fmt"
 	"os"
 
 	ipfs "go.beyondstorage.io/services/ipfs"
 	"go.beyondstorage.io/v5/pairs"
-	"go.beyondstorage.io/v5/services"
 	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/connstr"
 )
 
 func NewIPFS() (types.Storager, error) {
@@ -24,10 +24,13 @@ func NewIPFS() (types.Storager, error) {
 }
 
 func NewIPFSFromString() (types.Storager, error) {
-	connStr := fmt.Sprintf(
-		"ipfs://%s?endpoint=%s",
-		os.Getenv("STORAGE_IPFS_WORKDIR"),
-		os.Getenv("STORAGE_IPFS_ENDPOINT"),
-	)
-	return services.NewStoragerFromString(connStr)
+	connStr, err := connstr.ConnStr{
+		Type:     "ipfs",
+		WorkDir:  os.Getenv("STORAGE_IPFS_WORKDIR"),
+		Endpoint: os.Getenv("STORAGE_IPFS_ENDPOINT"),
+	}.Build()
+	if err != nil {
+		return nil, err
+	}
+	return connstr.NewStorager(connStr)
 }
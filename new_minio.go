@@ -1,13 +1,13 @@
 package example
 
 import (
-	"fmt"
 	"os"
 
 	minio "go.beyondstorage.io/services/minio"
 	"go.beyondstorage.io/v5/pairs"
-	"go.beyondstorage.io/v5/services"
 	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/connstr"
 )
 
 func NewMinio() (types.Storager, error) {
@@ -34,12 +34,15 @@ func NewMinio() (types.Storager, error) {
 }
 
 func NewMinioFromString() (types.Storager, error) {
-	str := fmt.Sprintf(
-		"minio://%s%s?credential=%s&endpoint=%s",
-		os.Getenv("STORAGE_MINIO_NAME"),
-		os.Getenv("STORAGE_MINIO_WORKDIR"),
-		os.Getenv("STORAGE_MINIO_CREDENTIAL"),
-		os.Getenv("STORAGE_MINIO_ENDPOINT"),
-	)
-	return services.NewStoragerFromString(str)
+	connStr, err := connstr.ConnStr{
+		Type:       "minio",
+		Name:       os.Getenv("STORAGE_MINIO_NAME"),
+		WorkDir:    os.Getenv("STORAGE_MINIO_WORKDIR"),
+		Credential: os.Getenv("STORAGE_MINIO_CREDENTIAL"),
+		Endpoint:   os.Getenv("STORAGE_MINIO_ENDPOINT"),
+	}.Build()
+	if err != nil {
+		return nil, err
+	}
+	return connstr.NewStorager(connStr)
 }
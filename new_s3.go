@@ -1,13 +1,13 @@
 package example
 
 import (
-	"fmt"
 	"os"
 
 	s3 "go.beyondstorage.io/services/s3/v3"
 	"go.beyondstorage.io/v5/pairs"
-	"go.beyondstorage.io/v5/services"
 	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/connstr"
 )
 
 func NewS3() (types.Storager, error) {
@@ -49,13 +49,21 @@ func NewS3() (types.Storager, error) {
 }
 
 func NewS3FromString() (types.Storager, error) {
-	connStr := fmt.Sprintf(
-		"s3://%s%s?credential=%s&endpoint=%s&location=%s&enbale_virtual_dir",
-		os.Getenv("STORAGE_S3_NAME"),
-		os.Getenv("STORAGE_S3_WORKDIR"),
-		os.Getenv("STORAGE_S3_CREDENTIAL"),
-		os.Getenv("STORAGE_S3_ENDPOINT"),
-		os.Getenv("STORAGE_S3_LOCATION"),
-	)
-	return services.NewStoragerFromString(connStr)
+	// connstr.ConnStr escapes every part of the connection string, so
+	// credentials containing `&`, `:` or `/` are kept as is.
+	connStr, err := connstr.ConnStr{
+		Type:       "s3",
+		Name:       os.Getenv("STORAGE_S3_NAME"),
+		WorkDir:    os.Getenv("STORAGE_S3_WORKDIR"),
+		Credential: os.Getenv("STORAGE_S3_CREDENTIAL"),
+		Endpoint:   os.Getenv("STORAGE_S3_ENDPOINT"),
+		Location:   os.Getenv("STORAGE_S3_LOCATION"),
+		Features:   []string{"virtual_dir"},
+	}.Build()
+	if err != nil {
+		return nil, err
+	}
+	// connstr.NewStorager rejects unknown or misspelled pairs instead of
+	// ignoring them.
+	return connstr.NewStorager(connStr)
 }
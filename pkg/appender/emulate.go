@@ -0,0 +1,304 @@
+package appender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+const defaultMinPartSize = 5 * 1024 * 1024
+
+// Strategies of an Emulator.
+const (
+	// StrategyMultipart rewrites the object by a multipart upload: the
+	// current content is the first part, the appended data the second.
+	//
+	// go-storage v5 has no API to copy a part from an existing object, so
+	// the current content is downloaded and uploaded again, which moves as
+	// many bytes as StrategyRewrite. It's the default for the object only
+	// being replaced once the upload is completed, and the current content
+	// being streamed without a temporary file.
+	StrategyMultipart = "multipart"
+	// StrategyRewrite reads the current content into a temporary file and
+	// writes it again followed by the appended data, so an append downloads
+	// the whole object and uploads it again.
+	StrategyRewrite = "rewrite"
+)
+
+var (
+	// ErrConflict means the object has been changed by someone else since
+	// the last append.
+	ErrConflict = errors.New("object changed concurrently")
+	// ErrObjectExist means CreateAppend found an object at the path.
+	ErrObjectExist = errors.New("object already exists")
+)
+
+// EmulatorOptions configures an Emulator.
+type EmulatorOptions struct {
+	// Strategy forces a strategy, default to StrategyMultipart if the
+	// storager is a types.Multiparter, StrategyRewrite otherwise.
+	Strategy string
+	// MinPartSize is the smallest part but the last one accepted by the
+	// service, default to 5 MiB.
+	MinPartSize int64
+	// Precondition returns the pairs making Write fail if the ETag of the
+	// object isn't etag, for services supporting it. It's only used by
+	// StrategyRewrite, go-storage has no such pair for all services, so
+	// there is no default.
+	//
+	// Without Precondition, the ETag is only checked by a Stat before the
+	// object is written, and updates can be lost, see Emulator.
+	Precondition func(etag string) []types.Pair
+	// TempDir holds the current content while StrategyRewrite writes the
+	// object, default to os.TempDir.
+	TempDir string
+}
+
+// Emulator gives append semantics to a storager without types.Appender,
+// by rewriting the object on every WriteAppend.
+//
+// Every WriteAppend costs at least a Stat and a rewrite of the object, so
+// appending n times to an object of size L moves O(n*L) bytes. Append in
+// large chunks, like through a Writer with a large BufferSize.
+//
+// The ETag of the object is checked before every rewrite, and WriteAppend
+// returns ErrConflict if the object has been changed by someone else. The
+// check is not atomic with the rewrite: a write by someone else between the
+// check and the rewrite is lost, unless EmulatorOptions.Precondition makes
+// the service reject the rewrite. Emulated appends are only safe with a
+// single writer per object.
+type Emulator struct {
+	types.Storager
+	types.UnimplementedAppender
+
+	opts EmulatorOptions
+}
+
+// Appendable returns store as a types.Appender, emulated by an Emulator if
+// the store doesn't implement it.
+func Appendable(store types.Storager, opts EmulatorOptions) types.Appender {
+	if a, ok := store.(types.Appender); ok {
+		return a
+	}
+	return NewEmulator(store, opts)
+}
+
+// NewEmulator creates an Emulator for store.
+func NewEmulator(store types.Storager, opts EmulatorOptions) *Emulator {
+	if opts.Strategy == "" {
+		opts.Strategy = StrategyRewrite
+		if _, ok := store.(types.Multiparter); ok {
+			opts.Strategy = StrategyMultipart
+		}
+	}
+	if opts.MinPartSize <= 0 {
+		opts.MinPartSize = defaultMinPartSize
+	}
+	return &Emulator{Storager: store, opts: opts}
+}
+
+// Strategy returns the strategy in use.
+func (e *Emulator) Strategy() string {
+	return e.opts.Strategy
+}
+
+func (e *Emulator) String() string {
+	return fmt.Sprintf("Emulator {Strategy: %s, Storager: %s}", e.opts.Strategy, e.Storager)
+}
+
+func (e *Emulator) CreateAppend(path string, pairs ...types.Pair) (*types.Object, error) {
+	return e.CreateAppendWithContext(context.Background(), path, pairs...)
+}
+
+// CreateAppendWithContext writes an empty object at path. It fails with
+// ErrObjectExist if there is an object at path already, open it by Stat to
+// append to it.
+func (e *Emulator) CreateAppendWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.Object, error) {
+	_, err := e.Storager.StatWithContext(ctx, path)
+	if err == nil {
+		return nil, fmt.Errorf("create append %s: %w", path, ErrObjectExist)
+	}
+	if !errors.Is(err, services.ErrObjectNotExist) {
+		return nil, err
+	}
+
+	if _, err := e.Storager.WriteWithContext(ctx, path, strings.NewReader(""), 0, pairs...); err != nil {
+		return nil, err
+	}
+	o, err := e.Storager.StatWithContext(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	o.SetAppendOffset(0)
+	return o, nil
+}
+
+func (e *Emulator) WriteAppend(o *types.Object, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	return e.WriteAppendWithContext(context.Background(), o, r, size, pairs...)
+}
+
+// WriteAppendWithContext rewrites the object with r appended. The object
+// must be returned by CreateAppend, or Stat.
+func (e *Emulator) WriteAppendWithContext(ctx context.Context, o *types.Object, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	offset, ok := o.GetAppendOffset()
+	if !ok {
+		offset, _ = o.GetContentLength()
+	}
+	etag, _ := o.GetEtag()
+
+	if err := e.check(ctx, o.Path, etag, offset); err != nil {
+		return 0, err
+	}
+
+	var err error
+	if e.opts.Strategy == StrategyMultipart {
+		err = e.multipart(ctx, o.Path, etag, offset, r, size, pairs)
+	} else {
+		err = e.rewrite(ctx, o.Path, etag, offset, r, size, pairs)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	// The new ETag guards the next append.
+	n, err := e.Storager.StatWithContext(ctx, o.Path)
+	if err != nil {
+		return 0, err
+	}
+	if etag, ok := n.GetEtag(); ok {
+		o.SetEtag(etag)
+	}
+	o.SetAppendOffset(offset + size)
+	o.SetContentLength(offset + size)
+	return size, nil
+}
+
+func (e *Emulator) CommitAppend(o *types.Object, pairs ...types.Pair) error {
+	return e.CommitAppendWithContext(context.Background(), o, pairs...)
+}
+
+// CommitAppendWithContext does nothing, every WriteAppend is visible once
+// returned.
+func (e *Emulator) CommitAppendWithContext(ctx context.Context, o *types.Object, pairs ...types.Pair) error {
+	return nil
+}
+
+// check returns ErrConflict if the object isn't at the ETag and length of
+// the last append.
+func (e *Emulator) check(ctx context.Context, path, etag string, offset int64) error {
+	cur, err := e.Storager.StatWithContext(ctx, path)
+	if err != nil {
+		return err
+	}
+	curTag, _ := cur.GetEtag()
+	curSize, _ := cur.GetContentLength()
+	if curTag != etag || curSize != offset {
+		return fmt.Errorf("append to %s: expected etag %s and size %d, got %s and %d: %w",
+			path, etag, offset, curTag, curSize, ErrConflict)
+	}
+	return nil
+}
+
+// current returns a reader of the first size bytes of the object.
+func (e *Emulator) current(ctx context.Context, path string, size int64) io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := e.Storager.ReadWithContext(ctx, path, pw, pairs.WithSize(size))
+		pw.CloseWithError(err)
+	}()
+	return pr
+}
+
+// rewrite copies the current content to a temporary file before writing
+// the object, since services writing in place, like fs, truncate the object
+// which is being read.
+func (e *Emulator) rewrite(ctx context.Context, path, etag string, offset int64, r io.Reader, size int64, ps []types.Pair) error {
+	f, err := ioutil.TempFile(e.opts.TempDir, "appender-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	n, err := e.Storager.ReadWithContext(ctx, path, f, pairs.WithSize(offset))
+	if err != nil {
+		return err
+	}
+	if n != offset {
+		return fmt.Errorf("append to %s: read %d bytes of %d: %w", path, n, offset, ErrConflict)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	if e.opts.Precondition != nil {
+		ps = append(ps, e.opts.Precondition(etag)...)
+	}
+
+	_, err = e.Storager.WriteWithContext(ctx, path, io.MultiReader(f, io.LimitReader(r, size)), offset+size, ps...)
+	return err
+}
+
+func (e *Emulator) multipart(ctx context.Context, path, etag string, offset int64, r io.Reader, size int64, ps []types.Pair) error {
+	mp, ok := e.Storager.(types.Multiparter)
+	if !ok {
+		return fmt.Errorf("append to %s by multipart: %w", path, services.ErrCapabilityInsufficient)
+	}
+
+	o, err := mp.CreateMultipartWithContext(ctx, path, ps...)
+	if err != nil {
+		return err
+	}
+	id, _ := o.GetMultipartID()
+	abort := func(err error) error {
+		_ = e.Storager.DeleteWithContext(ctx, path, pairs.WithMultipartID(id))
+		return err
+	}
+
+	var parts []*types.Part
+	if offset < e.opts.MinPartSize {
+		// Too small to be a part of its own.
+		cur := e.current(ctx, path, offset)
+		_, part, err := mp.WriteMultipartWithContext(ctx, o, io.MultiReader(cur, io.LimitReader(r, size)), offset+size, 0)
+		cur.Close()
+		if err != nil {
+			return abort(err)
+		}
+		parts = append(parts, part)
+	} else {
+		cur := e.current(ctx, path, offset)
+		_, part, err := mp.WriteMultipartWithContext(ctx, o, cur, offset, 0)
+		cur.Close()
+		if err != nil {
+			return abort(err)
+		}
+		parts = append(parts, part)
+
+		_, part, err = mp.WriteMultipartWithContext(ctx, o, r, size, 1)
+		if err != nil {
+			return abort(err)
+		}
+		parts = append(parts, part)
+	}
+
+	// Multipart uploads don't support preconditions, the upload is only
+	// completed if the object hasn't changed meanwhile. A change between
+	// this check and the completion is lost.
+	if err := e.check(ctx, path, etag, offset); err != nil {
+		return abort(err)
+	}
+	if err := mp.CompleteMultipartWithContext(ctx, o, parts); err != nil {
+		return abort(err)
+	}
+	return nil
+}
@@ -0,0 +1,370 @@
+package appender
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+const (
+	defaultRetries    = 3
+	defaultRetryDelay = time.Second
+)
+
+// ErrOffsetMismatch means the object's length is not one the journal
+// expects, the object has been appended by someone else.
+var ErrOffsetMismatch = errors.New("append offset mismatch")
+
+// SessionOptions configures a Session.
+type SessionOptions struct {
+	// Retries is the number of retries of a failed WriteAppend, default
+	// to 3.
+	Retries int
+	// RetryDelay is the delay before a retry, default to 1s.
+	RetryDelay time.Duration
+	// Verify reads back the data appended by a failed WriteAppend before
+	// resuming after it.
+	Verify bool
+	// ErrorLog logs failed attempts, default to discard.
+	ErrorLog func(format string, v ...interface{})
+}
+
+// journal is the state of a Session on the local disk. The chunk being
+// appended is kept next to it in <journal>.pending.
+type journal struct {
+	Path   string `json:"path"`
+	Offset int64  `json:"offset"`
+	// Pending is the size of the chunk being appended at Offset, and CRC
+	// its CRC-32.
+	Pending int64  `json:"pending,omitempty"`
+	CRC     uint32 `json:"crc,omitempty"`
+}
+
+// Session appends to an object, and keeps a journal so that an append
+// interrupted by an error or a crash is resumed at the right position.
+//
+// Before every WriteAppend, the expected offset and the chunk are synced to
+// the journal. After a failure, the object is stated: the part of the
+// chunk which landed is skipped, and the rest is appended again.
+type Session struct {
+	store   types.Storager
+	a       types.Appender
+	journal string
+	opts    SessionOptions
+
+	mu     sync.Mutex
+	o      *types.Object
+	offset int64
+	// pending is the chunk of a failed Append, it's resumed by the next
+	// Append.
+	pending []byte
+}
+
+// OpenSession opens a Session appending to path, and the journal at
+// journalPath. An append left pending in the journal by a crash is
+// completed first.
+//
+// The object is created by CreateAppend if it doesn't exist.
+func OpenSession(ctx context.Context, store types.Storager, path, journalPath string, opts SessionOptions) (*Session, error) {
+	if opts.Retries <= 0 {
+		opts.Retries = defaultRetries
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = defaultRetryDelay
+	}
+	if opts.ErrorLog == nil {
+		opts.ErrorLog = func(string, ...interface{}) {}
+	}
+
+	a, ok := store.(types.Appender)
+	if !ok {
+		return nil, fmt.Errorf("append session to %s: %w", path, services.ErrCapabilityInsufficient)
+	}
+	s := &Session{store: store, a: a, journal: journalPath, opts: opts}
+
+	j, err := s.readJournal()
+	if err != nil {
+		return nil, err
+	}
+	if j != nil && j.Path != path {
+		return nil, fmt.Errorf("journal %s is for %s, not %s", journalPath, j.Path, path)
+	}
+
+	o, length, err := s.stat(ctx, path)
+	if err != nil && errors.Is(err, services.ErrObjectNotExist) && j == nil {
+		o, err = a.CreateAppendWithContext(ctx, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.o = o
+
+	if j == nil {
+		j = &journal{Path: path, Offset: length}
+	}
+	s.offset = j.Offset
+
+	if j.Pending > 0 {
+		chunk, err := ioutil.ReadFile(s.pendingPath())
+		if err != nil || int64(len(chunk)) != j.Pending || crc32.ChecksumIEEE(chunk) != j.CRC {
+			return nil, fmt.Errorf("journal %s: pending chunk lost: %v", journalPath, err)
+		}
+		// Resume the interrupted append.
+		if err := s.resume(ctx, chunk, length); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	if length != s.offset {
+		return nil, fmt.Errorf("%s has %d bytes, journal expects %d: %w", path, length, s.offset, ErrOffsetMismatch)
+	}
+	if err := s.writeJournal(nil); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Offset returns the length of the object after the appended data.
+func (s *Session) Offset() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.offset
+}
+
+// Write implements io.Writer, every call is an Append.
+//
+// If the chunk is kept pending, Write returns len(p) with the error: p is
+// consumed and will be resumed, writing it again would append it twice.
+func (s *Session) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept, err := s.append(context.Background(), p)
+	if err != nil && kept {
+		return len(p), err
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Append appends p, retrying from the position the object actually reached.
+//
+// If Append fails after p is journaled, a copy of p stays pending. It's
+// resumed before the next chunk by Append, or by the next OpenSession after
+// a crash, so p must not be appended again.
+func (s *Session) Append(ctx context.Context, p []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := s.append(ctx, p)
+	return err
+}
+
+// append appends p, and reports whether p is kept pending on failure.
+func (s *Session) append(ctx context.Context, p []byte) (kept bool, err error) {
+	if err := s.resumePending(ctx); err != nil {
+		return false, err
+	}
+	if len(p) == 0 {
+		return false, nil
+	}
+
+	if err := s.writeJournal(p); err != nil {
+		return false, err
+	}
+	offset := s.offset
+	if err := s.resume(ctx, p, offset); err != nil {
+		if s.offset != offset {
+			// p landed, only the journal is behind.
+			return true, err
+		}
+		// The caller may reuse p.
+		s.pending = append([]byte(nil), p...)
+		return true, err
+	}
+	return false, nil
+}
+
+func (s *Session) resumePending(ctx context.Context) error {
+	if s.pending == nil {
+		return nil
+	}
+	_, length, err := s.stat(ctx, s.o.Path)
+	if err != nil {
+		return err
+	}
+	if err := s.resume(ctx, s.pending, length); err != nil {
+		return err
+	}
+	s.pending = nil
+	return nil
+}
+
+// Close resumes the pending chunk if any, commits the object and removes
+// the journal.
+func (s *Session) Close(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.resumePending(ctx); err != nil {
+		return err
+	}
+
+	if err := s.a.CommitAppendWithContext(ctx, s.o); err != nil {
+		return err
+	}
+	for _, name := range []string{s.journal, s.pendingPath()} {
+		if err := os.Remove(name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// resume appends the part of chunk, expected at s.offset, which is not in
+// the object of the given length yet.
+func (s *Session) resume(ctx context.Context, chunk []byte, length int64) error {
+	for attempt := 0; ; attempt++ {
+		landed := length - s.offset
+		if landed < 0 || landed > int64(len(chunk)) {
+			return fmt.Errorf("%s has %d bytes, expected %d to %d: %w",
+				s.o.Path, length, s.offset, s.offset+int64(len(chunk)), ErrOffsetMismatch)
+		}
+		if landed > 0 && s.opts.Verify {
+			if err := s.verify(ctx, chunk[:landed]); err != nil {
+				return err
+			}
+		}
+
+		var err error
+		if rest := chunk[landed:]; len(rest) > 0 {
+			s.o.SetAppendOffset(length)
+			_, err = s.a.WriteAppendWithContext(ctx, s.o, bytes.NewReader(rest), int64(len(rest)))
+		}
+		if err == nil {
+			s.offset += int64(len(chunk))
+			return s.writeJournal(nil)
+		}
+
+		s.opts.ErrorLog("append %s at %d (attempt %d): %v", s.o.Path, length, attempt+1, err)
+		if attempt >= s.opts.Retries {
+			return fmt.Errorf("append %s at %d: %w", s.o.Path, length, err)
+		}
+		select {
+		case <-time.After(s.opts.RetryDelay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		// The failed WriteAppend may have appended a part of the chunk.
+		if _, length, err = s.stat(ctx, s.o.Path); err != nil {
+			return err
+		}
+	}
+}
+
+// verify checks that the object has b at s.offset.
+func (s *Session) verify(ctx context.Context, b []byte) error {
+	var buf bytes.Buffer
+	_, err := s.store.ReadWithContext(ctx, s.o.Path, &buf,
+		pairs.WithOffset(s.offset), pairs.WithSize(int64(len(b))))
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(buf.Bytes(), b) {
+		return fmt.Errorf("%s at %d differs from the journal: %w", s.o.Path, s.offset, ErrOffsetMismatch)
+	}
+	return nil
+}
+
+// stat returns the object and its current length.
+func (s *Session) stat(ctx context.Context, path string) (*types.Object, int64, error) {
+	o, err := s.store.StatWithContext(ctx, path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if n, ok := o.GetAppendOffset(); ok {
+		return o, n, nil
+	}
+	n, ok := o.GetContentLength()
+	if !ok {
+		return nil, 0, fmt.Errorf("stat %s: no content length", path)
+	}
+	return o, n, nil
+}
+
+func (s *Session) pendingPath() string {
+	return s.journal + ".pending"
+}
+
+func (s *Session) readJournal() (*journal, error) {
+	content, err := ioutil.ReadFile(s.journal)
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	j := &journal{}
+	if err := json.Unmarshal(content, j); err != nil {
+		return nil, fmt.Errorf("journal %s: %w", s.journal, err)
+	}
+	return j, nil
+}
+
+// writeJournal records s.offset, and chunk as pending if not nil. The chunk
+// is synced before the journal refers to it.
+func (s *Session) writeJournal(chunk []byte) error {
+	j := journal{Path: s.o.Path, Offset: s.offset}
+	if chunk != nil {
+		if err := writeFileSync(s.pendingPath(), chunk); err != nil {
+			return err
+		}
+		j.Pending = int64(len(chunk))
+		j.CRC = crc32.ChecksumIEEE(chunk)
+	}
+
+	content, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+	return writeFileSync(s.journal, content)
+}
+
+// writeFileSync replaces name with content atomically.
+func writeFileSync(name string, content []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
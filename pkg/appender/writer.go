@@ -0,0 +1,203 @@
+// Package appender builds on types.Appender to write objects continuously,
+// and emulates it on storagers without types.Appender.
+package appender
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.beyondstorage.io/v5/types"
+)
+
+const defaultBufferSize = 4 * 1024 * 1024
+
+// ErrClosed is returned by writes to a closed Writer.
+var ErrClosed = errors.New("appender closed")
+
+// WriterOptions configures a Writer.
+type WriterOptions struct {
+	// BufferSize is the size of WriteAppend calls, default to 4 MiB. Writes
+	// are buffered until BufferSize bytes are pending.
+	BufferSize int
+	// FlushInterval is the longest time data stays in the buffer, default
+	// to 0 which only flushes on BufferSize, Flush and Close.
+	FlushInterval time.Duration
+	// Pairs are given to every WriteAppend.
+	Pairs []types.Pair
+}
+
+// Writer is an io.WriteCloser appending to an appendable object. It's safe
+// for concurrent use.
+//
+// A failed WriteAppend breaks the Writer: the error is returned by all
+// later calls, since the object may have received part of the data.
+type Writer struct {
+	ctx  context.Context
+	a    types.Appender
+	o    *types.Object
+	opts WriterOptions
+
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	offset int64
+	timer  *time.Timer
+	err    error
+	closed bool
+}
+
+// Create creates an appendable object at path, and returns a Writer to it.
+func Create(ctx context.Context, a types.Appender, path string, opts WriterOptions, pairs ...types.Pair) (*Writer, error) {
+	o, err := a.CreateAppendWithContext(ctx, path, pairs...)
+	if err != nil {
+		return nil, fmt.Errorf("create append %s: %w", path, err)
+	}
+	return NewWriter(ctx, a, o, opts), nil
+}
+
+// NewWriter returns a Writer appending to o, which is returned by
+// CreateAppend, or Stat of an appendable object.
+func NewWriter(ctx context.Context, a types.Appender, o *types.Object, opts WriterOptions) *Writer {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = defaultBufferSize
+	}
+
+	offset, _ := o.GetAppendOffset()
+	if offset == 0 {
+		// Objects from Stat carry their length instead.
+		offset, _ = o.GetContentLength()
+	}
+	return &Writer{ctx: ctx, a: a, o: o, opts: opts, offset: offset}
+}
+
+// Offset returns the length of the object after the appended data, the
+// buffered data is not included.
+func (w *Writer) Offset() int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.offset
+}
+
+// Buffered returns the number of bytes waiting in the buffer.
+func (w *Writer) Buffered() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.buf.Len()
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrClosed
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	w.buf.Write(p)
+	for w.buf.Len() >= w.opts.BufferSize {
+		if err := w.appendLocked(w.opts.BufferSize); err != nil {
+			// The data of p still in the buffer has not been written.
+			return len(p) - min(w.buf.Len(), len(p)), err
+		}
+	}
+	if w.buf.Len() > 0 && w.opts.FlushInterval > 0 && w.timer == nil {
+		w.timer = time.AfterFunc(w.opts.FlushInterval, w.flushOnTimer)
+	}
+	return len(p), nil
+}
+
+// Flush appends the buffered data.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrClosed
+	}
+	return w.flushLocked()
+}
+
+// Close flushes the buffer and commits the object. Close doesn't commit a
+// broken Writer.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return ErrClosed
+	}
+	w.closed = true
+
+	if err := w.flushLocked(); err != nil {
+		return err
+	}
+	if err := w.a.CommitAppendWithContext(w.ctx, w.o, w.opts.Pairs...); err != nil {
+		return fmt.Errorf("commit append %s: %w", w.o.Path, err)
+	}
+	return nil
+}
+
+func (w *Writer) flushOnTimer() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.timer = nil
+	if w.closed || w.err != nil {
+		return
+	}
+	// The error is kept in w.err, and returned by the next call.
+	_ = w.flushLocked()
+}
+
+func (w *Writer) flushLocked() error {
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	if w.err != nil {
+		return w.err
+	}
+	for w.buf.Len() > 0 {
+		n := w.buf.Len()
+		if n > w.opts.BufferSize {
+			n = w.opts.BufferSize
+		}
+		if err := w.appendLocked(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendLocked appends the first n bytes of the buffer.
+func (w *Writer) appendLocked(n int) error {
+	w.o.SetAppendOffset(w.offset)
+	_, err := w.a.WriteAppendWithContext(w.ctx, w.o, bytes.NewReader(w.buf.Bytes()[:n]), int64(n), w.opts.Pairs...)
+	if err != nil {
+		w.err = fmt.Errorf("write append %s at %d: %w", w.o.Path, w.offset, err)
+		return w.err
+	}
+
+	w.buf.Next(n)
+	w.offset += int64(n)
+	if w.buf.Len() == 0 && w.buf.Cap() > 2*w.opts.BufferSize {
+		// Release the memory of a large write.
+		w.buf = bytes.Buffer{}
+	}
+	return nil
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,204 @@
+//go:build go1.16
+// +build go1.16
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// Backup snapshots dir.
+//
+// Only chunks missing from the repository are uploaded. Files whose size,
+// mode and modification time are the same as in the latest snapshot of dir
+// are not read at all, their chunks are reused. The snapshot is written
+// once all its chunks are uploaded, so an interrupted Backup leaves no
+// snapshot, and the next Backup skips the chunks already uploaded.
+func (r *Repo) Backup(ctx context.Context, dir string) (*Snapshot, error) {
+	if r.store == nil {
+		return nil, ErrReadOnly
+	}
+
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{
+		ID:     id,
+		Time:   time.Now(),
+		Host:   host,
+		Source: dir,
+		Files:  make([]File, 0),
+	}
+
+	parent, err := r.parent(ctx, host, dir)
+	if err != nil {
+		return nil, err
+	}
+	previous := make(map[string]File)
+	if parent != nil {
+		s.Parent = parent.ID
+		for _, f := range parent.Files {
+			previous[f.Path] = f
+		}
+	}
+
+	// Chunks are listed once, instead of a Stat for every chunk.
+	known := make(map[string]bool)
+	entries, err := r.src.list(ctx, chunksDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		known[path.Base(e.path)] = true
+	}
+
+	err = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil && p != dir && errors.Is(err, fs.ErrNotExist) {
+			r.opts.ErrorLog("backup: %s removed while walking", p)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil && errors.Is(err, fs.ErrNotExist) {
+			r.opts.ErrorLog("backup: %s removed while walking", p)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		f := File{
+			Path:    filepath.ToSlash(rel),
+			Mode:    info.Mode(),
+			ModTime: info.ModTime(),
+		}
+
+		switch {
+		case info.IsDir():
+			s.Summary.Dirs++
+		case info.Mode()&os.ModeSymlink != 0:
+			if f.Link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			s.Summary.Files++
+			if old, ok := previous[f.Path]; ok && unchanged(old, info) {
+				f.Size, f.Chunks = old.Size, old.Chunks
+				s.Summary.Unchanged++
+			} else if err := r.backupFile(ctx, p, &f, known, &s.Summary); err != nil {
+				if errors.Is(err, fs.ErrNotExist) {
+					r.opts.ErrorLog("backup: %s removed while walking", p)
+					return nil
+				}
+				return err
+			}
+			s.Summary.Bytes += f.Size
+			s.Summary.Chunks += len(f.Chunks)
+		default:
+			// Devices, pipes and sockets are not backed up.
+			return nil
+		}
+		s.Files = append(s.Files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.writeSnapshot(ctx, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// backupFile chunks the file at p, and uploads the chunks not in known.
+func (r *Repo) backupFile(ctx context.Context, p string, f *File, known map[string]bool, sum *Summary) error {
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	c := newChunker(file, r.opts.MinChunk, r.opts.MaxChunk, r.mask)
+	for {
+		chunk, err := c.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		h := sha256.Sum256(chunk)
+		digest := hex.EncodeToString(h[:])
+		f.Chunks = append(f.Chunks, digest)
+		f.Size += int64(len(chunk))
+		if known[digest] {
+			continue
+		}
+
+		_, err = r.store.WriteWithContext(ctx, chunkPath(digest), bytes.NewReader(chunk), int64(len(chunk)))
+		if err != nil {
+			return err
+		}
+		known[digest] = true
+		sum.NewChunks++
+		sum.NewBytes += int64(len(chunk))
+	}
+}
+
+// parent returns the latest snapshot of dir on host, or nil.
+func (r *Repo) parent(ctx context.Context, host, dir string) (*Snapshot, error) {
+	snaps, err := r.Snapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(snaps) - 1; i >= 0; i-- {
+		if snaps[i].Host == host && snaps[i].Source == dir {
+			return snaps[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func unchanged(old File, info fs.FileInfo) bool {
+	return old.Mode == info.Mode() && old.Size == info.Size() && old.ModTime.Equal(info.ModTime())
+}
+
+// newID returns a snapshot id which sorts by time.
+func newID() (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(b), nil
+}
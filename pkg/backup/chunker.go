@@ -0,0 +1,80 @@
+//go:build go1.16
+// +build go1.16
+
+package backup
+
+import (
+	"io"
+)
+
+// gear maps bytes to random values for the rolling hash. It must never
+// change, or chunks of existing snapshots stop matching.
+var gear [256]uint64
+
+func init() {
+	// splitmix64 with a fixed seed.
+	x := uint64(0x6261636b7570)
+	for i := range gear {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		gear[i] = z ^ z>>31
+	}
+}
+
+// chunker splits a stream into content-defined chunks.
+//
+// It uses a gear hash: every byte shifts the hash left and adds a random
+// value, so the hash only depends on the last 64 bytes. A chunk ends where
+// the low bits of the hash are 0, or at max.
+type chunker struct {
+	r        io.Reader
+	min, max int
+	mask     uint64
+
+	buf []byte
+	n   int
+	eof bool
+}
+
+func newChunker(r io.Reader, min, max int, mask uint64) *chunker {
+	return &chunker{r: r, min: min, max: max, mask: mask, buf: make([]byte, max)}
+}
+
+// next returns the next chunk, or io.EOF.
+func (c *chunker) next() ([]byte, error) {
+	if !c.eof && c.n < c.max {
+		n, err := io.ReadFull(c.r, c.buf[c.n:])
+		c.n += n
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			c.eof = true
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if c.n == 0 {
+		return nil, io.EOF
+	}
+
+	cut := c.cut(c.buf[:c.n])
+	chunk := make([]byte, cut)
+	copy(chunk, c.buf)
+	c.n = copy(c.buf, c.buf[cut:c.n])
+	return chunk, nil
+}
+
+func (c *chunker) cut(b []byte) int {
+	if len(b) <= c.min {
+		return len(b)
+	}
+
+	var h uint64
+	for i := c.min; i < len(b); i++ {
+		h = h<<1 + gear[b[i]]
+		if h&c.mask == 0 {
+			return i + 1
+		}
+	}
+	return len(b)
+}
@@ -0,0 +1,121 @@
+//go:build go1.16
+// +build go1.16
+
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"time"
+
+	"go.beyondstorage.io/v5/services"
+)
+
+// PruneOptions selects the snapshots kept by Prune. A snapshot is kept if
+// any rule keeps it. The latest snapshot of every host and source is
+// always kept.
+type PruneOptions struct {
+	// KeepLast keeps the last n snapshots of every host and source.
+	KeepLast int
+	// KeepWithin keeps the snapshots younger than KeepWithin.
+	KeepWithin time.Duration
+	// DryRun reports what would be deleted, without deleting.
+	DryRun bool
+}
+
+// PruneStats reports a Prune.
+type PruneStats struct {
+	Kept          []string
+	Removed       []string
+	DeletedChunks int
+	DeletedBytes  int64
+}
+
+// Prune deletes the snapshots not kept by opts, then the chunks referenced
+// by no snapshot.
+//
+// Chunks younger than Options.Grace are kept for backups in progress. A
+// backup reusing the chunks of a snapshot being pruned may still lose them,
+// so don't run Prune and Backup of the same source at the same time.
+func (r *Repo) Prune(ctx context.Context, opts PruneOptions) (*PruneStats, error) {
+	if r.store == nil {
+		return nil, ErrReadOnly
+	}
+
+	start := time.Now()
+	snaps, err := r.Snapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &PruneStats{}
+	seen := make(map[string]bool)
+	live := make(map[string]bool)
+	count := make(map[string]int)
+	for i := len(snaps) - 1; i >= 0; i-- {
+		s := snaps[i]
+		seen[s.ID] = true
+		key := s.Host + "\x00" + s.Source
+		count[key]++
+
+		keep := count[key] <= opts.KeepLast || count[key] == 1 ||
+			start.Sub(s.Time) < opts.KeepWithin
+		if !keep {
+			stats.Removed = append(stats.Removed, s.ID)
+			continue
+		}
+		stats.Kept = append(stats.Kept, s.ID)
+		for _, f := range s.Files {
+			for _, digest := range f.Chunks {
+				live[digest] = true
+			}
+		}
+	}
+
+	if !opts.DryRun {
+		for _, id := range stats.Removed {
+			err := r.store.DeleteWithContext(ctx, snapshotPath(id))
+			if err != nil && !errors.Is(err, services.ErrObjectNotExist) {
+				return stats, fmt.Errorf("delete snapshot %s: %w", id, err)
+			}
+		}
+	}
+
+	// Snapshots written since Prune started reference chunks too.
+	fresh, err := r.Snapshots(ctx)
+	if err != nil {
+		return stats, err
+	}
+	for _, s := range fresh {
+		if seen[s.ID] {
+			continue
+		}
+		for _, f := range s.Files {
+			for _, digest := range f.Chunks {
+				live[digest] = true
+			}
+		}
+	}
+
+	chunks, err := r.src.list(ctx, chunksDir)
+	if err != nil {
+		return stats, err
+	}
+	for _, c := range chunks {
+		digest := path.Base(c.path)
+		if live[digest] || !validDigest(digest) || start.Sub(c.modTime) < r.opts.Grace {
+			continue
+		}
+		if !opts.DryRun {
+			err := r.store.DeleteWithContext(ctx, c.path)
+			if err != nil && !errors.Is(err, services.ErrObjectNotExist) {
+				return stats, err
+			}
+		}
+		stats.DeletedChunks++
+		stats.DeletedBytes += c.size
+	}
+	return stats, nil
+}
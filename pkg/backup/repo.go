@@ -0,0 +1,250 @@
+//go:build go1.16
+// +build go1.16
+
+// Package backup snapshots local directories into a types.Storager, with
+// chunk-level deduplication.
+//
+// Files are split into chunks at content-defined boundaries found by a
+// rolling hash, so that an insertion into a large file only changes the
+// chunks around it. Chunks are stored once by their SHA-256 at
+// chunks/<first 2 digits>/<digest>, and a snapshot at snapshots/<id> lists
+// the files with their chunks.
+package backup
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"go.beyondstorage.io/v5/types"
+)
+
+const (
+	chunksDir    = "chunks"
+	snapshotsDir = "snapshots"
+
+	defaultMinChunk = 512 * 1024
+	defaultAvgChunk = 1024 * 1024
+	defaultMaxChunk = 8 * 1024 * 1024
+	defaultGrace    = time.Hour
+)
+
+// Latest can be passed as snapshot id to pick the latest snapshot.
+const Latest = "latest"
+
+var (
+	// ErrNotFound means the snapshot or chunk doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrCorrupted means the content of a chunk doesn't match its digest.
+	ErrCorrupted = errors.New("chunk corrupted")
+	// ErrReadOnly is returned by Backup and Prune on a repository opened
+	// by NewFS.
+	ErrReadOnly = errors.New("repository is read only")
+)
+
+// Options configures a Repo.
+type Options struct {
+	// MinChunk, AvgChunk and MaxChunk bound the size of chunks, default to
+	// 512 KiB, 1 MiB and 8 MiB. AvgChunk is rounded down to a power of 2.
+	//
+	// Changing them doesn't break existing snapshots, but chunks of
+	// unchanged files are not deduplicated anymore.
+	MinChunk int
+	AvgChunk int
+	MaxChunk int
+	// Grace protects chunks younger than Grace from Prune, so that chunks
+	// of backups in progress survive. Default to 1h.
+	Grace time.Duration
+	// ErrorLog logs files skipped by Backup, because they were removed
+	// while walking. Default to no logging.
+	ErrorLog func(format string, v ...interface{})
+}
+
+// Snapshot is the state of a directory at a time.
+type Snapshot struct {
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	Host   string    `json:"host"`
+	Source string    `json:"source"`
+	// Parent is the snapshot whose chunk lists were reused for unchanged
+	// files.
+	Parent  string  `json:"parent,omitempty"`
+	Files   []File  `json:"files"`
+	Summary Summary `json:"summary"`
+}
+
+// File is a file, dir or symlink of a snapshot.
+type File struct {
+	// Path is slash separated and relative to the snapshot source.
+	Path    string      `json:"path"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mod_time"`
+	Size    int64       `json:"size,omitempty"`
+	Link    string      `json:"link,omitempty"`
+	Chunks  []string    `json:"chunks,omitempty"`
+}
+
+// Summary counts the work of a Backup.
+type Summary struct {
+	Files int   `json:"files"`
+	Dirs  int   `json:"dirs"`
+	Bytes int64 `json:"bytes"`
+	// Unchanged files were not read, their chunks come from the parent.
+	Unchanged int   `json:"unchanged"`
+	Chunks    int   `json:"chunks"`
+	NewChunks int   `json:"new_chunks"`
+	NewBytes  int64 `json:"new_bytes"`
+}
+
+// Repo is a backup repository.
+type Repo struct {
+	store types.Storager
+	src   source
+	opts  Options
+	mask  uint64
+}
+
+// New opens the repository in store's work dir.
+func New(store types.Storager, opts Options) *Repo {
+	r := newRepo(opts)
+	r.store = store
+	r.src = storeSource{store}
+	return r
+}
+
+// NewFS opens a read only repository from fsys, like fswrap.Fs of a
+// storager or os.DirFS of a copy of the repository.
+func NewFS(fsys fs.FS, opts Options) *Repo {
+	r := newRepo(opts)
+	r.src = fsSource{fsys}
+	return r
+}
+
+func newRepo(opts Options) *Repo {
+	if opts.MinChunk <= 0 {
+		opts.MinChunk = defaultMinChunk
+	}
+	if opts.AvgChunk <= 0 {
+		opts.AvgChunk = defaultAvgChunk
+	}
+	if opts.MaxChunk <= 0 {
+		opts.MaxChunk = defaultMaxChunk
+	}
+	if opts.MaxChunk < opts.MinChunk {
+		opts.MaxChunk = opts.MinChunk
+	}
+	if opts.Grace <= 0 {
+		opts.Grace = defaultGrace
+	}
+	if opts.ErrorLog == nil {
+		opts.ErrorLog = func(string, ...interface{}) {}
+	}
+
+	// A cut point is where the low bits of the hash are 0, which happens
+	// every AvgChunk bytes on average.
+	bits := 0
+	for 1<<(bits+1) <= opts.AvgChunk {
+		bits++
+	}
+	return &Repo{opts: opts, mask: 1<<uint(bits) - 1}
+}
+
+func chunkPath(digest string) string {
+	return path.Join(chunksDir, digest[:2], digest)
+}
+
+func snapshotPath(id string) string {
+	return path.Join(snapshotsDir, id)
+}
+
+// Snapshots returns all snapshots sorted by time, oldest first.
+func (r *Repo) Snapshots(ctx context.Context) ([]*Snapshot, error) {
+	entries, err := r.src.list(ctx, snapshotsDir)
+	if err != nil {
+		return nil, err
+	}
+
+	snaps := make([]*Snapshot, 0, len(entries))
+	for _, e := range entries {
+		s, err := r.Snapshot(ctx, path.Base(e.path))
+		if err != nil && errors.Is(err, ErrNotFound) {
+			// Pruned meanwhile.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, s)
+	}
+	sort.Slice(snaps, func(i, j int) bool {
+		return snaps[i].Time.Before(snaps[j].Time)
+	})
+	return snaps, nil
+}
+
+// Snapshot reads a snapshot, id can be Latest.
+func (r *Repo) Snapshot(ctx context.Context, id string) (*Snapshot, error) {
+	if id == Latest {
+		snaps, err := r.Snapshots(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(snaps) == 0 {
+			return nil, fmt.Errorf("snapshot %s: %w", id, ErrNotFound)
+		}
+		return snaps[len(snaps)-1], nil
+	}
+	if id == "" || strings.ContainsAny(id, "/\\") {
+		return nil, fmt.Errorf("invalid snapshot id %q", id)
+	}
+
+	content, err := r.src.read(ctx, snapshotPath(id))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	s := &Snapshot{}
+	if err := json.Unmarshal(content, s); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	return s, nil
+}
+
+// chunk reads a chunk and verifies its digest.
+func (r *Repo) chunk(ctx context.Context, digest string) ([]byte, error) {
+	if !validDigest(digest) {
+		return nil, fmt.Errorf("chunk %q: %w", digest, ErrCorrupted)
+	}
+	content, err := r.src.read(ctx, chunkPath(digest))
+	if err != nil {
+		return nil, fmt.Errorf("chunk %s: %w", digest, err)
+	}
+	if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("chunk %s: %w", digest, ErrCorrupted)
+	}
+	return content, nil
+}
+
+// writeSnapshot writes s, which must be the last step of a Backup.
+func (r *Repo) writeSnapshot(ctx context.Context, s *Snapshot) error {
+	content, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	_, err = r.store.WriteWithContext(ctx, snapshotPath(s.ID), bytes.NewReader(content), int64(len(content)))
+	return err
+}
+
+func validDigest(digest string) bool {
+	b, err := hex.DecodeString(digest)
+	return err == nil && len(b) == sha256.Size && strings.ToLower(digest) == digest
+}
@@ -0,0 +1,140 @@
+//go:build go1.16
+// +build go1.16
+
+package backup
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Restore writes the snapshot id into dir, id can be Latest.
+//
+// Every chunk is verified against its digest before it's written. Files
+// existing in dir are overwritten, other files are left alone. Nothing is
+// written through a symlink: symlinks are restored last, and a path with a
+// symlink as parent fails the restore.
+func (r *Repo) Restore(ctx context.Context, id, dir string) error {
+	s, err := r.Snapshot(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range s.Files {
+		// The snapshot comes from the storage, don't let it write outside
+		// dir.
+		if !fs.ValidPath(f.Path) || f.Path == "." {
+			return fmt.Errorf("snapshot %s: invalid path %q", s.ID, f.Path)
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	// Symlinks are restored after the files, so that no file is written
+	// through a restored symlink.
+	for _, links := range []bool{false, true} {
+		for _, f := range s.Files {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if (f.Mode&os.ModeSymlink != 0) != links {
+				continue
+			}
+			if err := checkParents(dir, f.Path); err != nil {
+				return err
+			}
+			if err := r.restoreFile(ctx, f, filepath.Join(dir, filepath.FromSlash(f.Path))); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Dirs are modified by restoring their files, and may not be writable,
+	// set their mode and time at last, deepest first.
+	for i := len(s.Files) - 1; i >= 0; i-- {
+		f := s.Files[i]
+		if !f.Mode.IsDir() {
+			continue
+		}
+		local := filepath.Join(dir, filepath.FromSlash(f.Path))
+		if err := os.Chmod(local, f.Mode.Perm()); err != nil {
+			return err
+		}
+		if err := os.Chtimes(local, f.ModTime, f.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkParents fails if a parent of the slash separated path p in dir is a
+// symlink.
+func checkParents(dir, p string) error {
+	parent := dir
+	elems := strings.Split(p, "/")
+	for _, elem := range elems[:len(elems)-1] {
+		parent = filepath.Join(parent, elem)
+		fi, err := os.Lstat(parent)
+		if err != nil && os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("restore %s: parent %s is a symlink", p, parent)
+		}
+	}
+	return nil
+}
+
+func (r *Repo) restoreFile(ctx context.Context, f File, local string) error {
+	// Replace a symlink instead of following it.
+	if fi, err := os.Lstat(local); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(local); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case f.Mode.IsDir():
+		return os.MkdirAll(local, 0700)
+	case f.Mode&os.ModeSymlink != 0:
+		if err := os.Remove(local); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return os.Symlink(f.Link, local)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(local), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(local, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	for _, digest := range f.Chunks {
+		chunk, err := r.chunk(ctx, digest)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("restore %s: %w", f.Path, err)
+		}
+		if _, err := file.Write(chunk); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(local, f.Mode.Perm()); err != nil {
+		return err
+	}
+	return os.Chtimes(local, f.ModTime, f.ModTime)
+}
@@ -0,0 +1,94 @@
+//go:build go1.16
+// +build go1.16
+
+package backup
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"path"
+	"time"
+
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/internal/walk"
+)
+
+// source is the read path of a repository.
+type source interface {
+	read(ctx context.Context, p string) ([]byte, error)
+	// list returns the files below dir, recursively.
+	list(ctx context.Context, dir string) ([]entry, error)
+}
+
+type entry struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+type storeSource struct {
+	store types.Storager
+}
+
+func (s storeSource) read(ctx context.Context, p string) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := s.store.ReadWithContext(ctx, p, &buf)
+	if err != nil && errors.Is(err, services.ErrObjectNotExist) {
+		return nil, ErrNotFound
+	}
+	return buf.Bytes(), err
+}
+
+func (s storeSource) list(ctx context.Context, dir string) ([]entry, error) {
+	var entries []entry
+	err := walk.Walk(ctx, s.store, dir, func(o *types.Object) error {
+		e := entry{path: o.Path}
+		e.size, _ = o.GetContentLength()
+		e.modTime, _ = o.GetLastModified()
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+type fsSource struct {
+	fsys fs.FS
+}
+
+func (s fsSource) read(ctx context.Context, p string) ([]byte, error) {
+	content, err := fs.ReadFile(s.fsys, p)
+	if err != nil && errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return content, err
+}
+
+func (s fsSource) list(ctx context.Context, dir string) ([]entry, error) {
+	var entries []entry
+	err := fs.WalkDir(s.fsys, dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil && p == dir && errors.Is(err, fs.ErrNotExist) {
+			return fs.SkipDir
+		}
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry{path: path.Clean(p), size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	return entries, err
+}
@@ -0,0 +1,88 @@
+//go:build go1.16
+// +build go1.16
+
+package backup
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sort"
+)
+
+// Report is the result of Verify.
+type Report struct {
+	Snapshots int
+	Chunks    int
+	// Missing are the chunks referenced by a snapshot but not stored.
+	Missing []string
+	// Corrupted are the chunks whose content doesn't match their digest,
+	// only checked with readData.
+	Corrupted []string
+	// Unreferenced is the number of chunks referenced by no snapshot,
+	// which are deleted by the next Prune.
+	Unreferenced int
+}
+
+// OK reports whether all snapshots can be restored.
+func (r *Report) OK() bool {
+	return len(r.Missing) == 0 && len(r.Corrupted) == 0
+}
+
+// Verify checks that all chunks referenced by snapshots exist. With
+// readData, every chunk is also read and checked against its digest.
+func (r *Repo) Verify(ctx context.Context, readData bool) (*Report, error) {
+	snaps, err := r.Snapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := r.src.list(ctx, chunksDir)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &Report{Snapshots: len(snaps), Chunks: len(entries)}
+	stored := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		stored[path.Base(e.path)] = true
+	}
+
+	referenced := make(map[string]bool)
+	for _, s := range snaps {
+		for _, f := range s.Files {
+			for _, digest := range f.Chunks {
+				if referenced[digest] {
+					continue
+				}
+				referenced[digest] = true
+				if !stored[digest] {
+					report.Missing = append(report.Missing, digest)
+				}
+			}
+		}
+	}
+	for digest := range stored {
+		if !referenced[digest] {
+			report.Unreferenced++
+		}
+	}
+
+	if !readData {
+		return report, nil
+	}
+	for digest := range referenced {
+		if !stored[digest] {
+			continue
+		}
+		_, err := r.chunk(ctx, digest)
+		if err != nil && errors.Is(err, ErrCorrupted) {
+			report.Corrupted = append(report.Corrupted, digest)
+			continue
+		}
+		if err != nil {
+			return report, err
+		}
+	}
+	sort.Strings(report.Corrupted)
+	return report, nil
+}
@@ -0,0 +1,444 @@
+// Package cache caches reads of a storager in a local storager, like a fs
+// storager on a local disk.
+//
+// Objects are cached in blocks, so a ranged Read only fetches and caches the
+// blocks it covers. Blocks are evicted by least recent use once the cached
+// size exceeds Options.MaxSize.
+//
+// Cached blocks are validated against the ETag, or the last modified time
+// and size, returned by Stat on the origin. Write and Delete through the
+// Cache invalidate the cached blocks of the path.
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/internal/walk"
+)
+
+const (
+	defaultBlockSize = 1024 * 1024
+	defaultMaxSize   = 1024 * 1024 * 1024
+	// maxFetchBlocks is the maximum number of missing blocks fetched from
+	// the origin in one request.
+	maxFetchBlocks = 8
+)
+
+// Options configures a Cache.
+type Options struct {
+	// BlockSize is the unit of caching, default to 1 MiB.
+	BlockSize int64
+	// MaxSize is the maximum size of cached blocks, default to 1 GiB.
+	MaxSize int64
+	// ValidateAfter is how long a Stat on the origin is trusted before
+	// validating again. Default to 0, which validates on every Read.
+	ValidateAfter time.Duration
+}
+
+// Stats reports the usage of a Cache.
+type Stats struct {
+	Hits   int64
+	Misses int64
+	Size   int64
+	Blocks int
+}
+
+// Cache is a types.Storager caching reads of origin in local.
+type Cache struct {
+	types.UnimplementedStorager
+
+	origin types.Storager
+	local  types.Storager
+	opts   Options
+	lru    *lru
+
+	mu     sync.Mutex
+	metas  map[string]*meta
+	hits   int64
+	misses int64
+}
+
+// meta is the validated version of a path.
+type meta struct {
+	version     string
+	size        int64
+	validatedAt time.Time
+}
+
+// New creates a Cache. Blocks already in local, like those of a previous
+// run, are indexed as least recently used.
+func New(origin, local types.Storager, opts Options) (*Cache, error) {
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = defaultBlockSize
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = defaultMaxSize
+	}
+
+	c := &Cache{
+		origin: origin,
+		local:  local,
+		opts:   opts,
+		lru:    newLRU(opts.MaxSize),
+		metas:  make(map[string]*meta),
+	}
+	if err := c.load(); err != nil {
+		return nil, fmt.Errorf("cache: load %s: %w", local, err)
+	}
+	return c, nil
+}
+
+// load indexes the existing blocks, the oldest first.
+func (c *Cache) load() error {
+	var blocks []*types.Object
+	err := walk.Walk(context.Background(), c.local, "", func(o *types.Object) error {
+		if strings.Count(o.Path, "/") == 2 {
+			blocks = append(blocks, o)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(blocks, func(i, j int) bool {
+		ti, _ := blocks[i].GetLastModified()
+		tj, _ := blocks[j].GetLastModified()
+		return ti.After(tj)
+	})
+	for _, o := range blocks {
+		size, _ := o.GetContentLength()
+		c.lru.addOld(o.Path, size)
+	}
+
+	// The cache may have been configured smaller since last run.
+	for _, key := range c.lru.evict() {
+		_ = c.local.Delete(key)
+	}
+	return nil
+}
+
+// Stats returns the usage of the cache.
+func (c *Cache) Stats() Stats {
+	size, blocks := c.lru.usage()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Stats{Hits: c.hits, Misses: c.misses, Size: size, Blocks: blocks}
+}
+
+func (c *Cache) String() string {
+	return fmt.Sprintf("Cache {Origin: %s, Local: %s}", c.origin, c.local)
+}
+
+func (c *Cache) Metadata(pairs ...types.Pair) *types.StorageMeta {
+	return c.origin.Metadata(pairs...)
+}
+
+func (c *Cache) Create(path string, pairs ...types.Pair) *types.Object {
+	return c.origin.Create(path, pairs...)
+}
+
+func (c *Cache) List(path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	return c.ListWithContext(context.Background(), path, pairs...)
+}
+
+func (c *Cache) ListWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	return c.origin.ListWithContext(ctx, path, pairs...)
+}
+
+func (c *Cache) Stat(path string, pairs ...types.Pair) (*types.Object, error) {
+	return c.StatWithContext(context.Background(), path, pairs...)
+}
+
+// StatWithContext stats the origin, and invalidates the cache if the object
+// has changed.
+func (c *Cache) StatWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.Object, error) {
+	o, err := c.origin.StatWithContext(ctx, path, pairs...)
+	if err != nil {
+		c.invalidate(path)
+		return nil, err
+	}
+	c.update(path, o)
+	return o, nil
+}
+
+func (c *Cache) Write(path string, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	return c.WriteWithContext(context.Background(), path, r, size, pairs...)
+}
+
+func (c *Cache) WriteWithContext(ctx context.Context, path string, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	// Invalidate even if the write failed, the object may have changed.
+	defer c.invalidate(path)
+	return c.origin.WriteWithContext(ctx, path, r, size, pairs...)
+}
+
+func (c *Cache) Delete(path string, pairs ...types.Pair) error {
+	return c.DeleteWithContext(context.Background(), path, pairs...)
+}
+
+func (c *Cache) DeleteWithContext(ctx context.Context, path string, pairs ...types.Pair) error {
+	defer c.invalidate(path)
+	return c.origin.DeleteWithContext(ctx, path, pairs...)
+}
+
+func (c *Cache) Read(path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	return c.ReadWithContext(context.Background(), path, w, pairs...)
+}
+
+// ReadWithContext reads from cached blocks, and fetches the missing ones from
+// the origin. Objects without ETag or last modified time are not cached.
+func (c *Cache) ReadWithContext(ctx context.Context, path string, w io.Writer, ps ...types.Pair) (int64, error) {
+	m, err := c.validate(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	if m == nil {
+		return c.origin.ReadWithContext(ctx, path, w, ps...)
+	}
+
+	offset, size, rest := splitRange(ps)
+	if offset > m.size {
+		offset = m.size
+	}
+	if size < 0 || offset+size > m.size {
+		size = m.size - offset
+	}
+
+	prefix := versionPrefix(path, m.version)
+	bs := c.opts.BlockSize
+
+	var written int64
+	for idx := offset / bs; written < size; {
+		blocks, err := c.blocks(ctx, path, prefix, m, idx, (offset+size-1)/bs, rest)
+		if err != nil {
+			return written, err
+		}
+
+		for _, b := range blocks {
+			start := offset + written - idx*bs
+			end := int64(len(b))
+			if remain := size - written; end-start > remain {
+				end = start + remain
+			}
+			n, err := w.Write(b[start:end])
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+			idx++
+		}
+	}
+	return written, nil
+}
+
+// blocks returns the blocks from first, it returns a single cached block,
+// or a run of missing blocks (up to last) fetched from the origin at once.
+func (c *Cache) blocks(ctx context.Context, path, prefix string, m *meta, first, last int64, ps []types.Pair) ([][]byte, error) {
+	bs := c.opts.BlockSize
+	want := bs
+	if (first+1)*bs > m.size {
+		want = m.size - first*bs
+	}
+	if b, ok := c.readLocal(ctx, prefix, first, want); ok {
+		c.count(true)
+		return [][]byte{b}, nil
+	}
+	c.count(false)
+
+	n := int64(1)
+	for n < maxFetchBlocks && first+n <= last && !c.lru.touch(blockKey(prefix, first+n)) {
+		n++
+	}
+
+	offset := first * bs
+	length := n * bs
+	if offset+length > m.size {
+		length = m.size - offset
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(int(length))
+	_, err := c.origin.ReadWithContext(ctx, path, &buf,
+		append(ps, pairs.WithOffset(offset), pairs.WithSize(length))...)
+	if err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) != length {
+		// The object has changed since validated.
+		c.invalidate(path)
+		return nil, fmt.Errorf("cache: read %s: got %d bytes, expected %d", path, buf.Len(), length)
+	}
+
+	data := buf.Bytes()
+	blocks := make([][]byte, 0, n)
+	for i := int64(0); i < n && len(data) > 0; i++ {
+		size := bs
+		if int64(len(data)) < size {
+			size = int64(len(data))
+		}
+		b := data[:size]
+		data = data[size:]
+		blocks = append(blocks, b)
+		c.writeLocal(ctx, blockKey(prefix, first+i), b)
+	}
+	return blocks, nil
+}
+
+// readLocal reads a cached block, which must be of the wanted size.
+func (c *Cache) readLocal(ctx context.Context, prefix string, idx, want int64) ([]byte, bool) {
+	key := blockKey(prefix, idx)
+	if !c.lru.touch(key) {
+		return nil, false
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(int(c.opts.BlockSize))
+	_, err := c.local.ReadWithContext(ctx, key, &buf)
+	if err != nil || int64(buf.Len()) != want {
+		// Evicted by another reader, or removed from the disk.
+		c.lru.delete(key)
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// writeLocal caches a block, failures are ignored since the block has
+// been read anyway.
+func (c *Cache) writeLocal(ctx context.Context, key string, b []byte) {
+	_, err := c.local.WriteWithContext(ctx, key, bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return
+	}
+	for _, k := range c.lru.add(key, int64(len(b))) {
+		_ = c.local.DeleteWithContext(ctx, k)
+	}
+}
+
+func (c *Cache) count(hit bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if hit {
+		c.hits++
+	} else {
+		c.misses++
+	}
+}
+
+// validate returns the meta of path, stat the origin if needed. It returns
+// nil if the object can't be cached.
+func (c *Cache) validate(ctx context.Context, path string) (*meta, error) {
+	c.mu.Lock()
+	m, ok := c.metas[path]
+	c.mu.Unlock()
+	if ok && c.opts.ValidateAfter > 0 && time.Since(m.validatedAt) < c.opts.ValidateAfter {
+		return m, nil
+	}
+
+	o, err := c.origin.StatWithContext(ctx, path)
+	if err != nil {
+		c.invalidate(path)
+		return nil, err
+	}
+	return c.update(path, o), nil
+}
+
+// update records the version of path, and drops the blocks of other
+// versions.
+func (c *Cache) update(path string, o *types.Object) *meta {
+	size, ok := o.GetContentLength()
+	version := objectVersion(o)
+	if !ok || version == "" || o.Mode.IsDir() {
+		c.invalidate(path)
+		return nil
+	}
+
+	m := &meta{version: version, size: size, validatedAt: time.Now()}
+
+	c.mu.Lock()
+	old, ok := c.metas[path]
+	c.metas[path] = m
+	c.mu.Unlock()
+
+	if !ok || old.version != version {
+		c.drop(pathPrefix(path), versionPrefix(path, version))
+	}
+	return m
+}
+
+// invalidate drops everything cached for path.
+func (c *Cache) invalidate(path string) {
+	c.mu.Lock()
+	delete(c.metas, path)
+	c.mu.Unlock()
+
+	c.drop(pathPrefix(path), "")
+}
+
+func (c *Cache) drop(prefix, keep string) {
+	for _, key := range c.lru.removePrefix(prefix, keep) {
+		_ = c.local.Delete(key)
+	}
+}
+
+// objectVersion identifies the content of an object, by ETag if possible.
+func objectVersion(o *types.Object) string {
+	if etag, ok := o.GetEtag(); ok && etag != "" {
+		return "etag:" + etag
+	}
+	if t, ok := o.GetLastModified(); ok && !t.IsZero() {
+		size, _ := o.GetContentLength()
+		return "mtime:" + strconv.FormatInt(t.UnixNano(), 10) + ":" + strconv.FormatInt(size, 10)
+	}
+	return ""
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:16])
+}
+
+// Blocks are stored as <path hash>/<version hash>/<index>.
+func pathPrefix(path string) string {
+	return hash(path) + "/"
+}
+
+func versionPrefix(path, version string) string {
+	return pathPrefix(path) + hash(version) + "/"
+}
+
+func blockKey(prefix string, idx int64) string {
+	return prefix + strconv.FormatInt(idx, 10)
+}
+
+// splitRange returns the offset and size pairs, and the other pairs. The size
+// is -1 if not set.
+func splitRange(ps []types.Pair) (offset, size int64, rest []types.Pair) {
+	size = -1
+	for _, p := range ps {
+		switch p.Key {
+		case "offset":
+			offset = p.Value.(int64)
+		case "size":
+			size = p.Value.(int64)
+		default:
+			rest = append(rest, p)
+		}
+	}
+	return offset, size, rest
+}
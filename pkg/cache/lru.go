@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+)
+
+// block is a cached block in the local storager.
+type block struct {
+	key  string // <path hash>/<version hash>/<index>
+	size int64
+}
+
+// lru indexes the blocks in the local storager by recency.
+type lru struct {
+	mu     sync.Mutex
+	max    int64
+	size   int64
+	ll     *list.List
+	blocks map[string]*list.Element
+}
+
+func newLRU(max int64) *lru {
+	return &lru{
+		max:    max,
+		ll:     list.New(),
+		blocks: make(map[string]*list.Element),
+	}
+}
+
+// touch marks key as recently used, and reports whether it's cached.
+func (l *lru) touch(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e, ok := l.blocks[key]
+	if ok {
+		l.ll.MoveToFront(e)
+	}
+	return ok
+}
+
+// add adds a block and returns the blocks evicted to stay under max.
+func (l *lru) add(key string, size int64) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.blocks[key]; ok {
+		b := e.Value.(*block)
+		l.size += size - b.size
+		b.size = size
+		l.ll.MoveToFront(e)
+	} else {
+		l.blocks[key] = l.ll.PushFront(&block{key: key, size: size})
+		l.size += size
+	}
+
+	return l.evictLocked()
+}
+
+// evict removes the least recently used blocks until the size is under max,
+// and returns their keys.
+func (l *lru) evict() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.evictLocked()
+}
+
+func (l *lru) evictLocked() []string {
+	var evicted []string
+	// Keep the most recent block even if it's larger than max.
+	for l.size > l.max && l.ll.Len() > 1 {
+		evicted = append(evicted, l.remove(l.ll.Back()))
+	}
+	return evicted
+}
+
+// delete removes a block.
+func (l *lru) delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if e, ok := l.blocks[key]; ok {
+		l.remove(e)
+	}
+}
+
+// addOld adds a block found on startup as the least recently used.
+func (l *lru) addOld(key string, size int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.blocks[key]; ok {
+		return
+	}
+	l.blocks[key] = l.ll.PushBack(&block{key: key, size: size})
+	l.size += size
+}
+
+// removePrefix removes all blocks whose key has the prefix, except those of
+// keep, and returns the removed keys.
+func (l *lru) removePrefix(prefix, keep string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var removed []string
+	for key, e := range l.blocks {
+		if !strings.HasPrefix(key, prefix) || (keep != "" && strings.HasPrefix(key, keep)) {
+			continue
+		}
+		removed = append(removed, l.remove(e))
+	}
+	return removed
+}
+
+func (l *lru) remove(e *list.Element) string {
+	b := l.ll.Remove(e).(*block)
+	delete(l.blocks, b.key)
+	l.size -= b.size
+	return b.key
+}
+
+// usage returns the total size and number of cached blocks.
+func (l *lru) usage() (int64, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.size, l.ll.Len()
+}
@@ -0,0 +1,284 @@
+// Package cas stores blobs under their SHA-256 on any storager.
+//
+// Blobs are stored once at blobs/<first 2 digits>/<digest>, Put skips the
+// upload of a blob which already exists. Logical names are mapped to blobs
+// by manifests at manifests/<name>. Blobs which no manifest references are
+// deleted by GC.
+package cas
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/internal/walk"
+)
+
+const (
+	blobsDir     = "blobs"
+	manifestsDir = "manifests"
+	defaultGrace = time.Hour
+)
+
+var (
+	// ErrNotFound means the blob or manifest doesn't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrCorrupted means the content of a blob doesn't match its digest.
+	ErrCorrupted = errors.New("blob corrupted")
+	// ErrInvalidDigest means a digest is not a hex encoded SHA-256.
+	ErrInvalidDigest = errors.New("invalid digest")
+)
+
+// Options configures a Store.
+type Options struct {
+	// Grace protects blobs younger than Grace from GC, so that blobs put
+	// but not referenced yet survive. Default to 1h.
+	Grace time.Duration
+	// TempDir holds the content of Put while it's hashed, default to
+	// os.TempDir.
+	TempDir string
+}
+
+// Blob is a stored blob.
+type Blob struct {
+	Digest string `json:"digest"`
+	Size   int64  `json:"size"`
+}
+
+// Manifest maps a logical name to blobs, like the files of a build output.
+type Manifest struct {
+	Name    string          `json:"name"`
+	Blobs   map[string]Blob `json:"blobs"`
+	Created time.Time       `json:"created"`
+}
+
+// Store is a content-addressed store.
+type Store struct {
+	store types.Storager
+	opts  Options
+}
+
+// New creates a Store on store.
+func New(store types.Storager, opts Options) *Store {
+	if opts.Grace <= 0 {
+		opts.Grace = defaultGrace
+	}
+	return &Store{store: store, opts: opts}
+}
+
+func blobPath(digest string) string {
+	return path.Join(blobsDir, digest[:2], digest)
+}
+
+func manifestPath(name string) string {
+	return path.Join(manifestsDir, name)
+}
+
+// validName reports whether name stays below the manifests.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, elem := range strings.Split(name, "/") {
+		if elem == "" || elem == "." || elem == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// fresh reports whether o was modified less than d before now.
+func (s *Store) fresh(o *types.Object, now time.Time, d time.Duration) bool {
+	t, ok := o.GetLastModified()
+	return ok && now.Sub(t) < d
+}
+
+func validDigest(digest string) error {
+	if b, err := hex.DecodeString(digest); err != nil || len(b) != sha256.Size || strings.ToLower(digest) != digest {
+		return fmt.Errorf("%q: %w", digest, ErrInvalidDigest)
+	}
+	return nil
+}
+
+// Put stores the content of r, and skips the upload if the blob exists. The
+// content is written to a temporary file while it's hashed.
+//
+// An existing blob is not written again, so it's not protected by Grace: a
+// concurrent GC may delete it before its manifest is set, which SetManifest
+// reports.
+func (s *Store) Put(ctx context.Context, r io.Reader) (Blob, error) {
+	f, err := ioutil.TempFile(s.opts.TempDir, "cas-")
+	if err != nil {
+		return Blob{}, err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(f, h), r)
+	if err != nil {
+		return Blob{}, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return Blob{}, err
+	}
+	return s.put(ctx, hex.EncodeToString(h.Sum(nil)), f, size)
+}
+
+// PutBytes stores b, like Put.
+func (s *Store) PutBytes(ctx context.Context, b []byte) (Blob, error) {
+	sum := sha256.Sum256(b)
+	return s.put(ctx, hex.EncodeToString(sum[:]), bytes.NewReader(b), int64(len(b)))
+}
+
+func (s *Store) put(ctx context.Context, digest string, r io.Reader, size int64) (Blob, error) {
+	blob := Blob{Digest: digest, Size: size}
+
+	_, err := s.store.StatWithContext(ctx, blobPath(digest))
+	if err == nil {
+		return blob, nil
+	}
+	if err != nil && !errors.Is(err, services.ErrObjectNotExist) {
+		return Blob{}, err
+	}
+
+	if _, err := s.store.WriteWithContext(ctx, blobPath(digest), r, size); err != nil {
+		return Blob{}, err
+	}
+	return blob, nil
+}
+
+// Has reports whether the blob exists.
+func (s *Store) Has(ctx context.Context, digest string) (bool, error) {
+	if err := validDigest(digest); err != nil {
+		return false, err
+	}
+	_, err := s.store.StatWithContext(ctx, blobPath(digest))
+	if err != nil && errors.Is(err, services.ErrObjectNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Get writes the blob to w, and verifies its digest. ErrCorrupted is
+// returned once the whole content is written to w.
+func (s *Store) Get(ctx context.Context, digest string, w io.Writer) (int64, error) {
+	if err := validDigest(digest); err != nil {
+		return 0, err
+	}
+
+	h := sha256.New()
+	n, err := s.store.ReadWithContext(ctx, blobPath(digest), io.MultiWriter(w, h))
+	if err != nil && errors.Is(err, services.ErrObjectNotExist) {
+		return 0, fmt.Errorf("blob %s: %w", digest, ErrNotFound)
+	}
+	if err != nil {
+		return n, err
+	}
+	if got := hex.EncodeToString(h.Sum(nil)); got != digest {
+		return n, fmt.Errorf("blob %s has digest %s: %w", digest, got, ErrCorrupted)
+	}
+	return n, nil
+}
+
+// SetManifest writes a manifest. All its blobs must exist, they're checked
+// after the manifest is written, so that a concurrent GC either sees the
+// manifest or has deleted the blob before the check. If a blob is missing,
+// the manifest is written anyway, Put the blob again and retry.
+//
+// Names are slash separated paths below the manifests, like `build/1`,
+// without `.` or `..` elements.
+func (s *Store) SetManifest(ctx context.Context, m *Manifest) error {
+	if !validName(m.Name) {
+		return fmt.Errorf("invalid manifest name %q", m.Name)
+	}
+	for _, b := range m.Blobs {
+		if err := validDigest(b.Digest); err != nil {
+			return err
+		}
+	}
+	if m.Created.IsZero() {
+		m.Created = time.Now()
+	}
+
+	content, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = s.store.WriteWithContext(ctx, manifestPath(m.Name), bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return err
+	}
+
+	for file, b := range m.Blobs {
+		ok, err := s.Has(ctx, b.Digest)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("manifest %s: blob %s of %s: %w", m.Name, b.Digest, file, ErrNotFound)
+		}
+	}
+	return nil
+}
+
+// GetManifest reads a manifest.
+func (s *Store) GetManifest(ctx context.Context, name string) (*Manifest, error) {
+	if !validName(name) {
+		return nil, fmt.Errorf("invalid manifest name %q", name)
+	}
+
+	var buf bytes.Buffer
+	_, err := s.store.ReadWithContext(ctx, manifestPath(name), &buf)
+	if err != nil && errors.Is(err, services.ErrObjectNotExist) {
+		return nil, fmt.Errorf("manifest %s: %w", name, ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(buf.Bytes(), m); err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", name, err)
+	}
+	return m, nil
+}
+
+// DeleteManifest deletes a manifest, its blobs are deleted by the next GC
+// if no other manifest references them.
+func (s *Store) DeleteManifest(ctx context.Context, name string) error {
+	if !validName(name) {
+		return fmt.Errorf("invalid manifest name %q", name)
+	}
+
+	err := s.store.DeleteWithContext(ctx, manifestPath(name))
+	if err != nil && !errors.Is(err, services.ErrObjectNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Manifests returns the names of all manifests.
+func (s *Store) Manifests(ctx context.Context) ([]string, error) {
+	var names []string
+	err := walk.Walk(ctx, s.store, manifestsDir, func(o *types.Object) error {
+		names = append(names, strings.TrimPrefix(o.Path, manifestsDir+"/"))
+		return nil
+	})
+	return names, err
+}
@@ -0,0 +1,136 @@
+package cas
+
+import (
+	"context"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/internal/walk"
+)
+
+// GCStats reports a GC.
+type GCStats struct {
+	Manifests int
+	Blobs     int
+	// RefCounts is the number of manifests referencing each live blob.
+	RefCounts map[string]int
+	// Deleted are the unreferenced blobs deleted, or to be deleted in a
+	// dry run.
+	Deleted      []string
+	DeletedBytes int64
+}
+
+// RefCounts returns the number of manifests referencing every blob.
+func (s *Store) RefCounts(ctx context.Context) (map[string]int, error) {
+	counts := make(map[string]int)
+	err := s.mark(ctx, counts, time.Time{})
+	return counts, err
+}
+
+// GC deletes the blobs referenced by no manifest, and older than Grace. With
+// dryRun, nothing is deleted.
+//
+// Blobs younger than Grace are kept, so that blobs put but not referenced
+// yet survive. Manifests written while GC runs are marked again before
+// sweeping, and every blob is stated again right before it's deleted.
+//
+// Put doesn't write blobs which already exist, so a blob put again while GC
+// runs may still be deleted before its manifest is set. SetManifest fails
+// with ErrNotFound then, Put the blobs again and retry it, or run GC when
+// nothing is put.
+func (s *Store) GC(ctx context.Context, dryRun bool) (*GCStats, error) {
+	start := time.Now()
+	stats := &GCStats{RefCounts: make(map[string]int)}
+
+	if err := s.mark(ctx, stats.RefCounts, time.Time{}); err != nil {
+		return nil, err
+	}
+	names, err := s.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stats.Manifests = len(names)
+
+	var garbage []*types.Object
+	err = walk.Walk(ctx, s.store, blobsDir, func(o *types.Object) error {
+		stats.Blobs++
+		digest := path.Base(o.Path)
+		if validDigest(digest) != nil || stats.RefCounts[digest] > 0 {
+			return nil
+		}
+		if t, ok := o.GetLastModified(); !ok || start.Sub(t) < s.opts.Grace {
+			return nil
+		}
+		garbage = append(garbage, o)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Manifests written since GC started may reference garbage.
+	late := make(map[string]int)
+	if err := s.mark(ctx, late, start.Add(-time.Minute)); err != nil {
+		return nil, err
+	}
+
+	for _, o := range garbage {
+		digest := path.Base(o.Path)
+		if late[digest] > 0 {
+			continue
+		}
+
+		// The blob may have been deleted and put again meanwhile.
+		cur, err := s.store.StatWithContext(ctx, o.Path)
+		if err != nil && errors.Is(err, services.ErrObjectNotExist) {
+			continue
+		}
+		if err != nil {
+			return stats, err
+		}
+		if s.fresh(cur, time.Now(), s.opts.Grace) {
+			continue
+		}
+
+		if !dryRun {
+			err := s.store.DeleteWithContext(ctx, o.Path)
+			if err != nil && !errors.Is(err, services.ErrObjectNotExist) {
+				return stats, err
+			}
+		}
+		size, _ := o.GetContentLength()
+		stats.Deleted = append(stats.Deleted, digest)
+		stats.DeletedBytes += size
+	}
+	return stats, nil
+}
+
+// mark counts the references of manifests modified after since.
+func (s *Store) mark(ctx context.Context, counts map[string]int, since time.Time) error {
+	return walk.Walk(ctx, s.store, manifestsDir, func(o *types.Object) error {
+		if t, ok := o.GetLastModified(); ok && t.Before(since) {
+			return nil
+		}
+		m, err := s.GetManifest(ctx, strings.TrimPrefix(o.Path, manifestsDir+"/"))
+		if err != nil && errors.Is(err, ErrNotFound) {
+			// Deleted meanwhile.
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		seen := make(map[string]bool)
+		for _, b := range m.Blobs {
+			if !seen[b.Digest] {
+				seen[b.Digest] = true
+				counts[b.Digest]++
+			}
+		}
+		return nil
+	})
+}
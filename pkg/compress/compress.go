@@ -0,0 +1,345 @@
+// Package compress compresses objects on write and decompresses them on
+// read, on top of any types.Storager.
+//
+// The codec of an object is recorded by a tag appended to its stored path:
+// `~gz` for Gzip, `~zst` for Zstd and Seekable, `~raw` for uncompressed
+// objects. Tags work on every service, unlike user metadata. Every object
+// written by the Storager has exactly one tag, so a logical path ending
+// with a tag is tagged again and can't collide. Objects without a tag were
+// not written by the Storager, they are neither listed, read nor deleted
+// through it.
+//
+// Seekable objects are zstd frames of FrameSize uncompressed bytes,
+// followed by a seek table as in the zstd seekable format. They are
+// readable by any zstd decoder, and ranged reads only fetch and decompress
+// the frames covering the range. Ranged reads of other compressed objects
+// decompress from the start.
+package compress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+// Codec is a compression format.
+type Codec string
+
+// Codecs.
+const (
+	None     Codec = "none"
+	Gzip     Codec = "gzip"
+	Zstd     Codec = "zstd"
+	Seekable Codec = "zstd-seekable"
+	// Auto sniffs the content: text is compressed with Options.Sniffed,
+	// other content is stored as is.
+	Auto Codec = "auto"
+)
+
+const (
+	gzipSuffix = "~gz"
+	zstdSuffix = "~zst"
+	rawSuffix  = "~raw"
+
+	defaultFrameSize = 1024 * 1024
+	sniffLen         = 512
+)
+
+// suffixes of stored paths, in the order they are tried by default.
+var suffixes = []string{zstdSuffix, gzipSuffix, rawSuffix}
+
+func (c Codec) suffix() string {
+	switch c {
+	case Gzip:
+		return gzipSuffix
+	case Zstd, Seekable:
+		return zstdSuffix
+	}
+	return rawSuffix
+}
+
+// Split returns the logical path of a stored path, and its codec. Zstd is
+// returned for Seekable too. ok is false if stored has no tag.
+func Split(stored string) (path string, codec Codec, ok bool) {
+	switch {
+	case strings.HasSuffix(stored, gzipSuffix):
+		return strings.TrimSuffix(stored, gzipSuffix), Gzip, true
+	case strings.HasSuffix(stored, zstdSuffix):
+		return strings.TrimSuffix(stored, zstdSuffix), Zstd, true
+	case strings.HasSuffix(stored, rawSuffix):
+		return strings.TrimSuffix(stored, rawSuffix), None, true
+	}
+	return stored, "", false
+}
+
+// Rule selects the codec of paths with Prefix.
+type Rule struct {
+	Prefix string
+	Codec  Codec
+}
+
+// Options configures a Storager.
+type Options struct {
+	// Rules select the codec by path, the longest matching prefix wins.
+	Rules []Rule
+	// Default is the codec of paths matching no rule, default to Auto.
+	Default Codec
+	// Sniffed is the codec of content found compressible by Auto, default
+	// to Zstd.
+	Sniffed Codec
+	// FrameSize is the uncompressed size of Seekable frames, default to
+	// 1 MiB. Smaller frames make ranged reads cheaper, and compression
+	// worse.
+	FrameSize int
+	// PartSize is the part size of compressed objects bigger than
+	// PartSize, which are written by multipart upload. Default to 8 MiB.
+	PartSize int64
+	// TempDir holds the compressed content on storagers without
+	// types.Multiparter and types.Appender, default to os.TempDir.
+	TempDir string
+}
+
+// Storager is a types.Storager compressing objects.
+type Storager struct {
+	types.UnimplementedStorager
+
+	store types.Storager
+	opts  Options
+}
+
+// New wraps store with compression.
+func New(store types.Storager, opts Options) *Storager {
+	if opts.Default == "" {
+		opts.Default = Auto
+	}
+	if opts.Sniffed == "" || opts.Sniffed == Auto {
+		opts.Sniffed = Zstd
+	}
+	if opts.FrameSize <= 0 {
+		opts.FrameSize = defaultFrameSize
+	}
+	return &Storager{store: store, opts: opts}
+}
+
+func (s *Storager) String() string {
+	return fmt.Sprintf("Compress {%s}", s.store)
+}
+
+func (s *Storager) Metadata(pairs ...types.Pair) *types.StorageMeta {
+	return s.store.Metadata(pairs...)
+}
+
+func (s *Storager) Create(path string, pairs ...types.Pair) *types.Object {
+	return s.store.Create(path, pairs...)
+}
+
+// codec returns the codec selected for path by the rules.
+func (s *Storager) codec(path string) Codec {
+	codec, longest := s.opts.Default, -1
+	for _, r := range s.opts.Rules {
+		if strings.HasPrefix(path, r.Prefix) && len(r.Prefix) > longest {
+			codec, longest = r.Codec, len(r.Prefix)
+		}
+	}
+	return codec
+}
+
+// sniff returns the codec of content starting with head.
+func (s *Storager) sniff(head []byte) Codec {
+	if len(head) == 0 {
+		return None
+	}
+	ct := http.DetectContentType(head)
+	if strings.HasPrefix(ct, "text/") ||
+		strings.Contains(ct, "json") ||
+		strings.Contains(ct, "xml") ||
+		strings.Contains(ct, "javascript") {
+		return s.opts.Sniffed
+	}
+	return None
+}
+
+// candidates returns the suffixes to look for path, the one of its rule
+// first.
+func (s *Storager) candidates(path string) []string {
+	codec := s.codec(path)
+	if codec == Auto {
+		codec = s.opts.Sniffed
+	}
+	first := codec.suffix()
+
+	out := []string{first}
+	for _, suffix := range suffixes {
+		if suffix != first {
+			out = append(out, suffix)
+		}
+	}
+	return out
+}
+
+// locate stats the stored object of path, and returns it with its suffix.
+func (s *Storager) locate(ctx context.Context, path string) (*types.Object, string, error) {
+	for _, suffix := range s.candidates(path) {
+		o, err := s.store.StatWithContext(ctx, path+suffix)
+		if err == nil {
+			return o, suffix, nil
+		}
+		if !errors.Is(err, services.ErrObjectNotExist) {
+			return nil, "", err
+		}
+	}
+	return nil, "", fmt.Errorf("stat %s: %w", path, services.ErrObjectNotExist)
+}
+
+func (s *Storager) Stat(path string, pairs ...types.Pair) (*types.Object, error) {
+	return s.StatWithContext(context.Background(), path, pairs...)
+}
+
+// StatWithContext stats the stored object of path. Its content length is
+// the uncompressed size for uncompressed and Seekable objects, and is
+// unset for other codecs.
+func (s *Storager) StatWithContext(ctx context.Context, path string, ps ...types.Pair) (*types.Object, error) {
+	o, suffix, err := s.locate(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	out := types.NewObject(s, true)
+	out.ID = o.ID
+	out.Path = path
+	out.Mode = o.Mode
+	if t, ok := o.GetLastModified(); ok {
+		out.SetLastModified(t)
+	}
+	if ct, ok := o.GetContentType(); ok {
+		out.SetContentType(ct)
+	}
+
+	switch suffix {
+	case rawSuffix:
+		if n, ok := o.GetContentLength(); ok {
+			out.SetContentLength(n)
+		}
+	case zstdSuffix:
+		size, _ := o.GetContentLength()
+		t, err := s.seekTable(ctx, o.Path, size)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			out.SetContentLength(t.size())
+		}
+	}
+	return out, nil
+}
+
+func (s *Storager) Delete(path string, pairs ...types.Pair) error {
+	return s.DeleteWithContext(context.Background(), path, pairs...)
+}
+
+// DeleteWithContext deletes the stored objects of path with every codec.
+func (s *Storager) DeleteWithContext(ctx context.Context, path string, pairs ...types.Pair) error {
+	return s.deleteOthers(ctx, path, "\x00", pairs)
+}
+
+// deleteOthers deletes the stored objects of path, except the one with
+// suffix keep.
+func (s *Storager) deleteOthers(ctx context.Context, path, keep string, ps []types.Pair) error {
+	for _, suffix := range suffixes {
+		if suffix == keep {
+			continue
+		}
+		err := s.store.DeleteWithContext(ctx, path+suffix, ps...)
+		if err != nil && !errors.Is(err, services.ErrObjectNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Storager) List(path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	return s.ListWithContext(context.Background(), path, pairs...)
+}
+
+// ListWithContext lists the objects written by the Storager, by their
+// logical paths. Content lengths are left unset, as they are the stored
+// sizes. Dirs are listed as is. The logical paths are kept in memory until
+// the end of the listing, to list every path once.
+func (s *Storager) ListWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	it, err := s.store.ListWithContext(ctx, path, pairs...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Variants of a path left by an interrupted Write are not always listed
+	// next to each other, `a~g~raw` sorts between `a~gz` and `a~raw`. Only
+	// the first one is kept, which takes a set of the listed paths.
+	seen := make(map[string]bool)
+	next := func(ctx context.Context, page *types.ObjectPage) error {
+		for len(page.Data) < pageSize {
+			o, err := it.Next()
+			if err != nil {
+				return err
+			}
+			if o.Mode.IsDir() {
+				page.Data = append(page.Data, o)
+				continue
+			}
+
+			p, _, ok := Split(o.Path)
+			if !ok || seen[p] {
+				continue
+			}
+			seen[p] = true
+
+			out := types.NewObject(s, true)
+			out.ID = o.ID
+			out.Path = p
+			out.Mode = o.Mode
+			if t, ok := o.GetLastModified(); ok {
+				out.SetLastModified(t)
+			}
+			page.Data = append(page.Data, out)
+		}
+		return nil
+	}
+	return types.NewObjectIterator(ctx, next, listStatus{}), nil
+}
+
+const pageSize = 100
+
+// listStatus is the status of mapped listings, which can't be continued.
+type listStatus struct{}
+
+func (listStatus) ContinuationToken() string { return "" }
+
+func splitRange(ps []types.Pair) (offset, size int64, rest []types.Pair) {
+	size = -1
+	for _, p := range ps {
+		switch p.Key {
+		case "offset":
+			offset = p.Value.(int64)
+		case "size":
+			size = p.Value.(int64)
+		default:
+			rest = append(rest, p)
+		}
+	}
+	return offset, size, rest
+}
+
+// withoutContentMD5 drops the Content-MD5 of the uncompressed content.
+func withoutContentMD5(ps []types.Pair) []types.Pair {
+	out := make([]types.Pair, 0, len(ps))
+	for _, p := range ps {
+		if p.Key != "content_md5" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
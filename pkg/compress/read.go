@@ -0,0 +1,191 @@
+package compress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+// errStopped stops the read of a stored object once the range is written.
+var errStopped = errors.New("read stopped")
+
+func (s *Storager) Read(path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	return s.ReadWithContext(context.Background(), path, w, pairs...)
+}
+
+// ReadWithContext writes the uncompressed content of path to w. Offset and
+// size are in uncompressed bytes.
+func (s *Storager) ReadWithContext(ctx context.Context, path string, w io.Writer, ps ...types.Pair) (int64, error) {
+	offset, size, rest := splitRange(ps)
+
+	for _, suffix := range s.candidates(path) {
+		n, err := s.read(ctx, path+suffix, suffix, w, offset, size, rest)
+		if err != nil && n == 0 && errors.Is(err, services.ErrObjectNotExist) {
+			continue
+		}
+		return n, err
+	}
+	return 0, fmt.Errorf("read %s: %w", path, services.ErrObjectNotExist)
+}
+
+func (s *Storager) read(ctx context.Context, stored, suffix string, w io.Writer, offset, size int64, ps []types.Pair) (int64, error) {
+	ranged := offset > 0 || size >= 0
+
+	switch {
+	case suffix == rawSuffix:
+		if offset > 0 {
+			ps = append(ps, pairs.WithOffset(offset))
+		}
+		if size >= 0 {
+			ps = append(ps, pairs.WithSize(size))
+		}
+		return s.store.ReadWithContext(ctx, stored, w, ps...)
+	case suffix == zstdSuffix && ranged:
+		o, err := s.store.StatWithContext(ctx, stored)
+		if err != nil {
+			return 0, err
+		}
+		storedSize, _ := o.GetContentLength()
+		t, err := s.seekTable(ctx, stored, storedSize)
+		if err != nil {
+			return 0, err
+		}
+		if t != nil {
+			return s.readFrames(ctx, stored, t, w, offset, size, ps)
+		}
+	}
+
+	// Decompress from the start, and discard up to offset.
+	return s.pipe(ctx, stored, ps, func(r io.Reader) (int64, error) {
+		var dr io.Reader
+		if suffix == gzipSuffix {
+			gr, err := gzip.NewReader(r)
+			if err != nil {
+				return 0, err
+			}
+			defer gr.Close()
+			dr = gr
+		} else {
+			zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return 0, err
+			}
+			defer zr.Close()
+			dr = zr
+		}
+
+		if _, err := io.CopyN(ioutil.Discard, dr, offset); err != nil {
+			if err == io.EOF {
+				return 0, nil
+			}
+			return 0, err
+		}
+		if size >= 0 {
+			n, err := io.CopyN(w, dr, size)
+			if err == io.EOF {
+				err = nil
+			}
+			return n, err
+		}
+		return io.Copy(w, dr)
+	})
+}
+
+// readFrames reads the frames of a Seekable object covering the range.
+func (s *Storager) readFrames(ctx context.Context, stored string, t *seekTable, w io.Writer, offset, size int64, ps []types.Pair) (int64, error) {
+	end := t.size()
+	if size >= 0 && offset+size < end {
+		end = offset + size
+	}
+	if offset >= end {
+		return 0, nil
+	}
+
+	first, last := -1, -1
+	for i, f := range t.frames {
+		if f.doff+f.dsize > offset && first < 0 {
+			first = i
+		}
+		if f.doff < end {
+			last = i
+		}
+	}
+	frames := t.frames[first : last+1]
+
+	cstart := frames[0].coff
+	cend := frames[len(frames)-1].coff + frames[len(frames)-1].csize
+	ps = append(ps, pairs.WithOffset(cstart), pairs.WithSize(cend-cstart))
+
+	return s.pipe(ctx, stored, ps, func(r io.Reader) (int64, error) {
+		zr, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return 0, err
+		}
+		defer zr.Close()
+
+		var (
+			written    int64
+			compressed []byte
+			data       []byte
+		)
+		for _, f := range frames {
+			if int64(cap(compressed)) < f.csize {
+				compressed = make([]byte, f.csize)
+			}
+			compressed = compressed[:f.csize]
+			if _, err := io.ReadFull(r, compressed); err != nil {
+				return written, err
+			}
+			data, err = zr.DecodeAll(compressed, data[:0])
+			if err != nil {
+				return written, err
+			}
+			if int64(len(data)) != f.dsize {
+				return written, fmt.Errorf("%s: frame at %d has %d bytes, expected %d",
+					stored, f.coff, len(data), f.dsize)
+			}
+
+			lo, hi := int64(0), f.dsize
+			if offset > f.doff {
+				lo = offset - f.doff
+			}
+			if end < f.doff+f.dsize {
+				hi = end - f.doff
+			}
+			n, err := w.Write(data[lo:hi])
+			written += int64(n)
+			if err != nil {
+				return written, err
+			}
+		}
+		return written, nil
+	})
+}
+
+// pipe reads the stored object into fn, and stops the read once fn
+// returns. The error of the read is returned if fn fails because of it.
+func (s *Storager) pipe(ctx context.Context, stored string, ps []types.Pair, fn func(r io.Reader) (int64, error)) (int64, error) {
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.store.ReadWithContext(ctx, stored, pw, ps...)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	n, err := fn(pr)
+	pr.CloseWithError(errStopped)
+	readErr := <-done
+	if err != nil && readErr != nil && !errors.Is(readErr, errStopped) {
+		return n, readErr
+	}
+	return n, err
+}
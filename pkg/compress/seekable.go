@@ -0,0 +1,131 @@
+package compress
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+
+	"go.beyondstorage.io/v5/pairs"
+)
+
+// The seek table is a skippable frame at the end of the object:
+//
+//	header:  skippable magic u32, size of the rest u32
+//	entries: compressed size u32, decompressed size u32, [checksum u32]
+//	footer:  number of frames u32, descriptor u8, seekable magic u32
+//
+// All integers are little endian. Checksums are never written, and skipped
+// when read.
+const (
+	skippableMagic = 0x184D2A5E
+	seekableMagic  = 0x8F92EAB1
+	headerSize     = 8
+	footerSize     = 9
+	checksumFlag   = 1 << 7
+	reservedBits   = 0x7c
+)
+
+type frame struct {
+	coff, csize int64
+	doff, dsize int64
+}
+
+type seekTable struct {
+	frames []frame
+}
+
+// size returns the uncompressed size.
+func (t *seekTable) size() int64 {
+	if len(t.frames) == 0 {
+		return 0
+	}
+	last := t.frames[len(t.frames)-1]
+	return last.doff + last.dsize
+}
+
+func (t *seekTable) add(csize, dsize int) {
+	f := frame{csize: int64(csize), dsize: int64(dsize)}
+	if n := len(t.frames); n > 0 {
+		f.coff = t.frames[n-1].coff + t.frames[n-1].csize
+		f.doff = t.frames[n-1].doff + t.frames[n-1].dsize
+	}
+	t.frames = append(t.frames, f)
+}
+
+func (t *seekTable) marshal() []byte {
+	n := len(t.frames)
+	b := make([]byte, headerSize+n*8+footerSize)
+	le := binary.LittleEndian
+
+	le.PutUint32(b, skippableMagic)
+	le.PutUint32(b[4:], uint32(len(b)-headerSize))
+	for i, f := range t.frames {
+		le.PutUint32(b[headerSize+i*8:], uint32(f.csize))
+		le.PutUint32(b[headerSize+i*8+4:], uint32(f.dsize))
+	}
+	footer := b[len(b)-footerSize:]
+	le.PutUint32(footer, uint32(n))
+	footer[4] = 0
+	le.PutUint32(footer[5:], seekableMagic)
+	return b
+}
+
+// seekTable reads the seek table of a stored zstd object of size bytes, or
+// returns nil if the object has none.
+func (s *Storager) seekTable(ctx context.Context, stored string, size int64) (*seekTable, error) {
+	if size < headerSize+footerSize {
+		return nil, nil
+	}
+	le := binary.LittleEndian
+
+	footer, err := s.readAt(ctx, stored, size-footerSize, footerSize)
+	if err != nil {
+		return nil, err
+	}
+	if le.Uint32(footer[5:]) != seekableMagic || footer[4]&reservedBits != 0 {
+		return nil, nil
+	}
+	entrySize := int64(8)
+	if footer[4]&checksumFlag != 0 {
+		entrySize = 12
+	}
+	n := int64(le.Uint32(footer))
+	tableSize := headerSize + n*entrySize + footerSize
+	if tableSize > size {
+		return nil, nil
+	}
+
+	b, err := s.readAt(ctx, stored, size-tableSize, tableSize)
+	if err != nil {
+		return nil, err
+	}
+	if le.Uint32(b) != skippableMagic || int64(le.Uint32(b[4:])) != tableSize-headerSize {
+		return nil, nil
+	}
+
+	t := &seekTable{frames: make([]frame, 0, n)}
+	for i := int64(0); i < n; i++ {
+		e := b[headerSize+i*entrySize:]
+		t.add(int(le.Uint32(e)), int(le.Uint32(e[4:])))
+	}
+	if n > 0 {
+		last := t.frames[n-1]
+		if last.coff+last.csize != size-tableSize {
+			return nil, nil
+		}
+	}
+	return t, nil
+}
+
+func (s *Storager) readAt(ctx context.Context, stored string, offset, size int64) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := s.store.ReadWithContext(ctx, stored, &buf, pairs.WithOffset(offset), pairs.WithSize(size))
+	if err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) != size {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,190 @@
+package compress
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/stream"
+)
+
+func (s *Storager) Write(path string, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	return s.WriteWithContext(context.Background(), path, r, size, pairs...)
+}
+
+// WriteWithContext compresses r with the codec selected for path, then
+// deletes the objects of path stored with other codecs.
+//
+// The compressed size is unknown until the end, objects bigger than
+// PartSize once compressed are written by multipart upload or append. On
+// storagers supporting neither, the compressed content is written to a
+// temporary file first. The number of uncompressed bytes written is
+// returned.
+func (s *Storager) WriteWithContext(ctx context.Context, path string, r io.Reader, size int64, ps ...types.Pair) (int64, error) {
+	src := &exactReader{r: r, left: size}
+
+	codec := s.codec(path)
+	var body io.Reader = src
+	if codec == Auto {
+		head := make([]byte, sniffLen)
+		n, err := io.ReadFull(src, head)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		codec = s.sniff(head[:n])
+		body = io.MultiReader(bytes.NewReader(head[:n]), src)
+	}
+
+	var err error
+	if codec == None {
+		_, err = s.store.WriteWithContext(ctx, path+rawSuffix, body, size, ps...)
+	} else {
+		err = s.compress(ctx, path+codec.suffix(), codec, body, withoutContentMD5(ps))
+	}
+	if err != nil {
+		return src.n, err
+	}
+	return size, s.deleteOthers(ctx, path, codec.suffix(), nil)
+}
+
+func (s *Storager) compress(ctx context.Context, stored string, codec Codec, r io.Reader, ps []types.Pair) error {
+	_, mp := s.store.(types.Multiparter)
+	_, ap := s.store.(types.Appender)
+	if !mp && !ap {
+		return s.spool(ctx, stored, codec, r, ps)
+	}
+
+	pr, pw := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		err := s.encode(pw, codec, r)
+		pw.CloseWithError(err)
+		done <- err
+	}()
+
+	_, err := stream.Write(ctx, s.store, stored, pr, stream.Options{PartSize: s.opts.PartSize}, ps...)
+	// Unblock the encoder if the upload failed.
+	pr.Close()
+	encodeErr := <-done
+	if err != nil {
+		return err
+	}
+	return encodeErr
+}
+
+// spool compresses r into a temporary file, and writes it with a single
+// Write once its size is known.
+func (s *Storager) spool(ctx context.Context, stored string, codec Codec, r io.Reader, ps []types.Pair) error {
+	f, err := ioutil.TempFile(s.opts.TempDir, "compress-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+
+	if err := s.encode(f, codec, r); err != nil {
+		return err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = s.store.WriteWithContext(ctx, stored, f, size, ps...)
+	return err
+}
+
+func (s *Storager) encode(w io.Writer, codec Codec, r io.Reader) error {
+	switch codec {
+	case Gzip:
+		gw := gzip.NewWriter(w)
+		if _, err := io.Copy(gw, r); err != nil {
+			return err
+		}
+		return gw.Close()
+	case Zstd:
+		zw, err := zstd.NewWriter(w)
+		if err != nil {
+			return err
+		}
+		if _, err := zw.ReadFrom(r); err != nil {
+			zw.Close()
+			return err
+		}
+		return zw.Close()
+	}
+	return s.encodeFrames(w, r)
+}
+
+// encodeFrames writes r as independent zstd frames of FrameSize, followed
+// by the seek table.
+func (s *Storager) encodeFrames(w io.Writer, r io.Reader) error {
+	zw, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return err
+	}
+	defer zw.Close()
+
+	t := &seekTable{}
+	buf := make([]byte, s.opts.FrameSize)
+	var frame []byte
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 {
+			frame = zw.EncodeAll(buf[:n], frame[:0])
+			if _, err := w.Write(frame); err != nil {
+				return err
+			}
+			t.add(len(frame), n)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = w.Write(t.marshal())
+	return err
+}
+
+// errShortRead means the reader ended before size bytes. Unlike
+// io.ErrUnexpectedEOF, it's not taken for the end of the content by
+// io.ReadFull callers.
+var errShortRead = errors.New("reader ended before size bytes")
+
+// exactReader reads exactly left bytes, and fails with errShortRead if r
+// ends before.
+type exactReader struct {
+	r    io.Reader
+	left int64
+	n    int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	if e.left <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > e.left {
+		p = p[:e.left]
+	}
+	n, err := e.r.Read(p)
+	e.left -= int64(n)
+	e.n += int64(n)
+	if err == io.EOF && e.left > 0 {
+		err = errShortRead
+	}
+	return n, err
+}
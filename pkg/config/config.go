@@ -0,0 +1,233 @@
+// Package config loads named storage profiles from a YAML, TOML or JSON file
+// and creates ready to use types.Storager from them.
+//
+// A config file looks like:
+//
+//	profiles:
+//	  backups:
+//	    type: s3
+//	    credential: hmac:${S3_ACCESS_KEY}:${S3_SECRET_KEY}
+//	    location: ap-east-1
+//	    name: backups
+//	    work_dir: /daily/
+//	    features: [virtual_dir]
+//	    default_pairs:
+//	      write:
+//	        server_side_encryption: AES256
+//	  scratch:
+//	    type: fs
+//	    work_dir: ${SCRATCH_DIR:-/tmp/scratch}/
+//
+// String values support `${ENV}` and `${ENV:-default}` interpolation, `$$`
+// escapes a literal `$`.
+//
+// Storagers are created by services.NewStorager, so the service packages
+// must be imported (for registration) by the caller.
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pelletier/go-toml"
+	"gopkg.in/yaml.v3"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+// Format is the format of a config file.
+type Format string
+
+// Supported formats.
+const (
+	FormatYAML Format = "yaml"
+	FormatTOML Format = "toml"
+	FormatJSON Format = "json"
+)
+
+// Config is the content of a config file.
+type Config struct {
+	Profiles map[string]*Profile `json:"profiles" yaml:"profiles" toml:"profiles"`
+}
+
+// Profile describes how to create a storager.
+type Profile struct {
+	// Type is the service type, like s3 or fs.
+	Type       string `json:"type" yaml:"type" toml:"type"`
+	Credential string `json:"credential,omitempty" yaml:"credential,omitempty" toml:"credential,omitempty"`
+	Endpoint   string `json:"endpoint,omitempty" yaml:"endpoint,omitempty" toml:"endpoint,omitempty"`
+	Location   string `json:"location,omitempty" yaml:"location,omitempty" toml:"location,omitempty"`
+	Name       string `json:"name,omitempty" yaml:"name,omitempty" toml:"name,omitempty"`
+	WorkDir    string `json:"work_dir,omitempty" yaml:"work_dir,omitempty" toml:"work_dir,omitempty"`
+	// Features are enabled by `enable_<feature>` pairs, like virtual_dir.
+	Features []string `json:"features,omitempty" yaml:"features,omitempty" toml:"features,omitempty"`
+	// DefaultPairs maps an operation, like write, to the default pairs used
+	// by this operation. They are converted by the DefaultPairsFunc
+	// registered for the profile's type.
+	DefaultPairs map[string]map[string]string `json:"default_pairs,omitempty" yaml:"default_pairs,omitempty" toml:"default_pairs,omitempty"`
+}
+
+// DefaultPairsFunc converts the default pairs of a profile into the
+// service-specific default storage pairs, like s3.WithDefaultStoragePairs.
+type DefaultPairsFunc func(ops map[string]map[string]string) (types.Pair, error)
+
+var (
+	defaultPairsLock  sync.RWMutex
+	defaultPairsFuncs = map[string]DefaultPairsFunc{}
+)
+
+// RegisterDefaultPairs registers the DefaultPairsFunc of a service type.
+//
+// Default pairs are typed differently by every service, so profiles of a
+// type without registered func can't have default pairs.
+func RegisterDefaultPairs(ty string, fn DefaultPairsFunc) {
+	defaultPairsLock.Lock()
+	defer defaultPairsLock.Unlock()
+
+	defaultPairsFuncs[ty] = fn
+}
+
+func getDefaultPairsFunc(ty string) (DefaultPairsFunc, bool) {
+	defaultPairsLock.RLock()
+	defer defaultPairsLock.RUnlock()
+
+	fn, ok := defaultPairsFuncs[ty]
+	return fn, ok
+}
+
+// Load reads, interpolates and validates the config file at path. The format
+// is detected by the file extension.
+func Load(path string) (*Config, error) {
+	var format Format
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		format = FormatYAML
+	case ".toml":
+		format = FormatTOML
+	case ".json":
+		format = FormatJSON
+	default:
+		return nil, fmt.Errorf("config %s: unsupported file extension", path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+
+	c, err := Parse(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse decodes, interpolates and validates a config. Unknown fields are
+// rejected.
+func Parse(data []byte, format Format) (*Config, error) {
+	c := &Config{}
+
+	var err error
+	switch format {
+	case FormatYAML:
+		d := yaml.NewDecoder(bytes.NewReader(data))
+		d.KnownFields(true)
+		err = d.Decode(c)
+	case FormatTOML:
+		err = toml.NewDecoder(bytes.NewReader(data)).Strict(true).Decode(c)
+	case FormatJSON:
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.DisallowUnknownFields()
+		err = d.Decode(c)
+	default:
+		err = fmt.Errorf("unsupported format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+
+	if err := c.expand(); err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Names returns the sorted profile names.
+func (c *Config) Names() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Open creates storagers for all profiles, keyed by profile name.
+func (c *Config) Open() (map[string]types.Storager, error) {
+	stores := make(map[string]types.Storager, len(c.Profiles))
+	for _, name := range c.Names() {
+		store, err := c.Profiles[name].NewStorager()
+		if err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		stores[name] = store
+	}
+	return stores, nil
+}
+
+// NewStorager creates a storager from the profile.
+func (p *Profile) NewStorager() (types.Storager, error) {
+	ps, err := p.Pairs()
+	if err != nil {
+		return nil, err
+	}
+	return services.NewStorager(p.Type, ps...)
+}
+
+// Pairs converts the profile into the pairs for services.NewStorager.
+func (p *Profile) Pairs() ([]types.Pair, error) {
+	var ps []types.Pair
+	if p.Credential != "" {
+		ps = append(ps, pairs.WithCredential(p.Credential))
+	}
+	if p.Endpoint != "" {
+		ps = append(ps, pairs.WithEndpoint(p.Endpoint))
+	}
+	if p.Location != "" {
+		ps = append(ps, pairs.WithLocation(p.Location))
+	}
+	if p.Name != "" {
+		ps = append(ps, pairs.WithName(p.Name))
+	}
+	if p.WorkDir != "" {
+		ps = append(ps, pairs.WithWorkDir(p.WorkDir))
+	}
+	for _, f := range p.Features {
+		// Feature pairs are generated as `enable_<feature>` with a bool value.
+		ps = append(ps, types.Pair{Key: "enable_" + f, Value: true})
+	}
+
+	if len(p.DefaultPairs) > 0 {
+		fn, ok := getDefaultPairsFunc(p.Type)
+		if !ok {
+			return nil, fmt.Errorf("default pairs of type %s: %w", p.Type, ErrNotRegistered)
+		}
+		pair, err := fn(p.DefaultPairs)
+		if err != nil {
+			return nil, fmt.Errorf("default pairs: %w", err)
+		}
+		ps = append(ps, pair)
+	}
+	return ps, nil
+}
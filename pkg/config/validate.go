@@ -0,0 +1,128 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.beyondstorage.io/example/pkg/connstr"
+)
+
+var (
+	// ErrNotRegistered means no DefaultPairsFunc is registered for the type.
+	ErrNotRegistered = errors.New("default pairs func not registered")
+	// ErrInvalidConfig is wrapped by all validation errors.
+	ErrInvalidConfig = errors.New("invalid config")
+)
+
+// Validate checks every profile against the schema of its type. All problems
+// are reported at once.
+func (c *Config) Validate() error {
+	var problems []string
+	if len(c.Profiles) == 0 {
+		problems = append(problems, "no profiles defined")
+	}
+
+	for _, name := range c.Names() {
+		p := c.Profiles[name]
+		if p == nil {
+			problems = append(problems, fmt.Sprintf("profile %s: empty", name))
+			continue
+		}
+		for _, v := range p.validate() {
+			problems = append(problems, fmt.Sprintf("profile %s: %s", name, v))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (p *Profile) validate() []string {
+	var problems []string
+	for _, v := range connstr.Check(p.Type, map[string]string{
+		connstr.PairCredential: p.Credential,
+		connstr.PairEndpoint:   p.Endpoint,
+		connstr.PairLocation:   p.Location,
+		connstr.PairName:       p.Name,
+		connstr.PairWorkDir:    p.WorkDir,
+	}, p.Features) {
+		problems = append(problems, v.Msg)
+	}
+	if _, ok := connstr.LookupSchema(p.Type); !ok {
+		return problems
+	}
+
+	if len(p.DefaultPairs) > 0 {
+		if _, ok := getDefaultPairsFunc(p.Type); !ok {
+			problems = append(problems, fmt.Sprintf("default_pairs is not supported by %s", p.Type))
+		}
+	}
+	return problems
+}
+
+var envPattern = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces `${ENV}` and `${ENV:-default}` with the environment
+// value. It's an error to refer to an unset variable without default, so
+// that a missing variable doesn't silently produce a broken config.
+func expandEnv(s string) (string, error) {
+	var missing []string
+	out := envPattern.ReplaceAllStringFunc(s, func(m string) string {
+		if m == "$$" {
+			return "$"
+		}
+		sub := envPattern.FindStringSubmatch(m)
+		if v, ok := os.LookupEnv(sub[1]); ok && v != "" {
+			return v
+		}
+		if sub[2] != "" {
+			return sub[3]
+		}
+		missing = append(missing, sub[1])
+		return ""
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("%w: environment variable %s is not set", ErrInvalidConfig, strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// expand interpolates all string values of the config.
+func (c *Config) expand() error {
+	for _, name := range c.Names() {
+		p := c.Profiles[name]
+		if p == nil {
+			continue
+		}
+
+		for _, v := range []*string{&p.Type, &p.Credential, &p.Endpoint, &p.Location, &p.Name, &p.WorkDir} {
+			s, err := expandEnv(*v)
+			if err != nil {
+				return fmt.Errorf("profile %s: %w", name, err)
+			}
+			*v = s
+		}
+		for i := range p.Features {
+			s, err := expandEnv(p.Features[i])
+			if err != nil {
+				return fmt.Errorf("profile %s: %w", name, err)
+			}
+			p.Features[i] = s
+		}
+		for _, kv := range p.DefaultPairs {
+			for k, v := range kv {
+				s, err := expandEnv(v)
+				if err != nil {
+					return fmt.Errorf("profile %s: %w", name, err)
+				}
+				kv[k] = s
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,288 @@
+// Package connstr builds and parses connection strings like:
+//
+//	s3://bucket/work/dir/?credential=hmac:ak:sk&location=ap-east-1&enable_virtual_dir
+//
+// The name and work dir are path escaped, and the values are query escaped
+// with `%20` for spaces, so credentials containing `&`, `:`, `/`, `=` or `+`
+// survive the round trip. A `+` is taken as is, not as a space.
+//
+// services.NewStoragerFromString splits the query on `&` and `=` as is and
+// ignores unknown keys, use NewStorager in this package instead to get the
+// escaping and validation.
+package connstr
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+const featurePrefix = "enable_"
+
+var (
+	// ErrInvalidConnStr is wrapped by all errors returned by Parse and Build.
+	ErrInvalidConnStr = errors.New("invalid connection string")
+	// ErrUnknownPair means the connection string contains a pair not
+	// supported by the service.
+	ErrUnknownPair = errors.New("unknown pair")
+)
+
+// ConnStr is the structured form of a connection string.
+type ConnStr struct {
+	// Type is the service type, like s3 or fs.
+	Type       string
+	Name       string
+	WorkDir    string
+	Credential string
+	Endpoint   string
+	Location   string
+	// Features are enabled by `enable_<feature>`, like virtual_dir.
+	Features []string
+}
+
+// Build validates c and returns the escaped connection string.
+//
+// The values are escaped, which services.NewStoragerFromString doesn't
+// undo: parse the result with Parse, or create the storager with
+// NewStorager in this package.
+func (c ConnStr) Build() (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
+
+// String returns the escaped connection string without validation.
+func (c ConnStr) String() string {
+	var b strings.Builder
+	b.WriteString(c.Type)
+	b.WriteString("://")
+	b.WriteString(url.PathEscape(c.Name))
+	b.WriteString(escapePath(c.WorkDir))
+
+	q := make([]string, 0, 3+len(c.Features))
+	for _, kv := range [][2]string{
+		{PairCredential, c.Credential},
+		{PairEndpoint, c.Endpoint},
+		{PairLocation, c.Location},
+	} {
+		if kv[1] != "" {
+			q = append(q, kv[0]+"="+escapeValue(kv[1]))
+		}
+	}
+	features := append([]string(nil), c.Features...)
+	sort.Strings(features)
+	for _, f := range features {
+		q = append(q, featurePrefix+escapeValue(f))
+	}
+
+	if len(q) > 0 {
+		b.WriteByte('?')
+		b.WriteString(strings.Join(q, "&"))
+	}
+	return b.String()
+}
+
+// Validate checks c against the schema of its type, see Check.
+func (c ConnStr) Validate() error {
+	problems := Check(c.Type, map[string]string{
+		PairCredential: c.Credential,
+		PairEndpoint:   c.Endpoint,
+		PairLocation:   c.Location,
+		PairName:       c.Name,
+		PairWorkDir:    c.WorkDir,
+	}, c.Features)
+	if len(problems) > 0 {
+		return problems[0].err()
+	}
+	return nil
+}
+
+// Parse parses and validates a connection string in the format of
+// `<type>://[<name>][<work_dir>][?<key>=<value>&<feature>...]`.
+//
+// Unknown or misspelled keys are rejected, with a suggestion when a known
+// key is close enough.
+func Parse(s string) (*ConnStr, error) {
+	colon := strings.Index(s, "://")
+	if colon < 1 {
+		return nil, fmt.Errorf("%w: %q has no type", ErrInvalidConnStr, s)
+	}
+	c := &ConnStr{Type: s[:colon]}
+	schema, ok := LookupSchema(c.Type)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidConnStr, c.Type)
+	}
+
+	rest, query := s[colon+3:], ""
+	if i := strings.IndexByte(rest, '?'); i >= 0 {
+		rest, query = rest[:i], rest[i+1:]
+	}
+
+	name, workDir := rest, ""
+	if i := strings.IndexByte(rest, '/'); i >= 0 {
+		name, workDir = rest[:i], rest[i:]
+	}
+	var err error
+	if c.Name, err = url.PathUnescape(name); err != nil {
+		return nil, fmt.Errorf("%w: name: %v", ErrInvalidConnStr, err)
+	}
+	if c.WorkDir, err = url.PathUnescape(workDir); err != nil {
+		return nil, fmt.Errorf("%w: work_dir: %v", ErrInvalidConnStr, err)
+	}
+
+	seen := make(map[string]bool)
+	for _, kv := range strings.Split(query, "&") {
+		if kv == "" {
+			continue
+		}
+		k, v, hasValue := kv, "", false
+		if i := strings.IndexByte(kv, '='); i >= 0 {
+			k, v, hasValue = kv[:i], kv[i+1:], true
+		}
+		// PathUnescape keeps `+`, which is common in secret keys.
+		if k, err = url.PathUnescape(k); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidConnStr, err)
+		}
+		if v, err = url.PathUnescape(v); err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidConnStr, k, err)
+		}
+		if seen[k] {
+			return nil, fmt.Errorf("%w: duplicate %s", ErrInvalidConnStr, k)
+		}
+		seen[k] = true
+
+		if strings.HasPrefix(k, featurePrefix) && schema.HasFeature(strings.TrimPrefix(k, featurePrefix)) {
+			if hasValue && v != "true" {
+				return nil, fmt.Errorf("%w: %s=%s, features take no value", ErrInvalidConnStr, k, v)
+			}
+			c.Features = append(c.Features, strings.TrimPrefix(k, featurePrefix))
+			continue
+		}
+
+		switch {
+		case k == PairCredential && schema.Allows(k):
+			c.Credential = v
+		case k == PairEndpoint && schema.Allows(k):
+			c.Endpoint = v
+		case k == PairLocation && schema.Allows(k):
+			c.Location = v
+		default:
+			if hint := suggest(k, schema); hint != "" {
+				return nil, fmt.Errorf("%w: %s for %s, did you mean %s?", ErrUnknownPair, k, c.Type, hint)
+			}
+			return nil, fmt.Errorf("%w: %s for %s", ErrUnknownPair, k, c.Type)
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Pairs converts c into the pairs for services.NewStorager.
+func (c ConnStr) Pairs() []types.Pair {
+	var ps []types.Pair
+	if c.Name != "" {
+		ps = append(ps, pairs.WithName(c.Name))
+	}
+	if c.WorkDir != "" {
+		ps = append(ps, pairs.WithWorkDir(c.WorkDir))
+	}
+	if c.Credential != "" {
+		ps = append(ps, pairs.WithCredential(c.Credential))
+	}
+	if c.Endpoint != "" {
+		ps = append(ps, pairs.WithEndpoint(c.Endpoint))
+	}
+	if c.Location != "" {
+		ps = append(ps, pairs.WithLocation(c.Location))
+	}
+	for _, f := range c.Features {
+		ps = append(ps, types.Pair{Key: featurePrefix + f, Value: true})
+	}
+	return ps
+}
+
+// NewStorager parses the connection string and creates the storager.
+//
+// The service package must be imported for registration.
+func NewStorager(s string, ps ...types.Pair) (types.Storager, error) {
+	c, err := Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return services.NewStorager(c.Type, append(c.Pairs(), ps...)...)
+}
+
+// escapePath escapes every segment of a work dir but keeps the `/`.
+func escapePath(p string) string {
+	segs := strings.Split(p, "/")
+	for i := range segs {
+		segs[i] = url.PathEscape(segs[i])
+	}
+	return strings.Join(segs, "/")
+}
+
+// escapeValue query escapes v, with `%20` instead of `+` for spaces so that
+// a `+` is never ambiguous.
+func escapeValue(v string) string {
+	return strings.ReplaceAll(url.QueryEscape(v), "+", "%20")
+}
+
+// suggest returns the known key closest to k, or empty if none is close.
+func suggest(k string, s Schema) string {
+	candidates := []string{PairCredential, PairEndpoint, PairLocation}
+	for _, f := range s.Features {
+		candidates = append(candidates, featurePrefix+f)
+	}
+
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if !strings.HasPrefix(c, featurePrefix) && !s.Allows(c) {
+			continue
+		}
+		if d := distance(k, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+// distance returns the Levenshtein distance between a and b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min(v ...int) int {
+	m := v[0]
+	for _, x := range v[1:] {
+		if x < m {
+			m = x
+		}
+	}
+	return m
+}
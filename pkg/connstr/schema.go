@@ -0,0 +1,144 @@
+package connstr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Schema describes the pairs accepted by a service type.
+type Schema struct {
+	// Required pairs must be set, like name for object storage services.
+	Required []string
+	// Optional pairs could be set.
+	Optional []string
+	// Features could be enabled by `enable_<feature>`.
+	Features []string
+}
+
+// Pairs that could be set in a connection string.
+const (
+	PairCredential = "credential"
+	PairEndpoint   = "endpoint"
+	PairLocation   = "location"
+	PairName       = "name"
+	PairWorkDir    = "work_dir"
+)
+
+// schemas follows the New* examples of every service.
+var schemas = map[string]Schema{
+	"bos": {
+		Required: []string{PairCredential, PairEndpoint, PairName},
+		Optional: []string{PairWorkDir},
+	},
+	"cos": {
+		Required: []string{PairCredential, PairLocation, PairName},
+		Optional: []string{PairWorkDir},
+	},
+	"fs": {
+		Required: []string{PairWorkDir},
+	},
+	"ftp": {
+		Required: []string{PairEndpoint},
+		Optional: []string{PairCredential, PairWorkDir},
+	},
+	"gdrive": {
+		Required: []string{PairCredential, PairName},
+		Optional: []string{PairWorkDir},
+	},
+	"hdfs": {
+		Required: []string{PairEndpoint},
+		Optional: []string{PairWorkDir},
+	},
+	"ipfs": {
+		Required: []string{PairEndpoint},
+		Optional: []string{PairWorkDir},
+	},
+	"minio": {
+		Required: []string{PairCredential, PairEndpoint, PairName},
+		Optional: []string{PairWorkDir},
+	},
+	"s3": {
+		Required: []string{PairCredential, PairName},
+		Optional: []string{PairEndpoint, PairLocation, PairWorkDir},
+		Features: []string{"virtual_dir", "virtual_link"},
+	},
+}
+
+// LookupSchema returns the schema of a service type.
+func LookupSchema(ty string) (Schema, bool) {
+	s, ok := schemas[ty]
+	return s, ok
+}
+
+// Allows reports whether the pair could be set for this service.
+func (s Schema) Allows(pair string) bool {
+	return contains(s.Required, pair) || contains(s.Optional, pair)
+}
+
+// HasFeature reports whether the feature could be enabled for this service.
+func (s Schema) HasFeature(feature string) bool {
+	return contains(s.Features, feature)
+}
+
+func contains(list []string, v string) bool {
+	for _, s := range list {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Problem is a value which doesn't fit the schema of its service type.
+type Problem struct {
+	// Unknown is set for pairs and features not supported by the type.
+	Unknown bool
+	Msg     string
+}
+
+func (p Problem) err() error {
+	if p.Unknown {
+		return fmt.Errorf("%w: %s", ErrUnknownPair, p.Msg)
+	}
+	return fmt.Errorf("%w: %s", ErrInvalidConnStr, p.Msg)
+}
+
+// Check checks the values, keyed by pair, and the features of a service
+// type, and returns all problems found. ConnStr.Validate and the config
+// package share these rules.
+func Check(ty string, values map[string]string, features []string) []Problem {
+	s, ok := LookupSchema(ty)
+	if !ok {
+		return []Problem{{Msg: fmt.Sprintf("unknown type %q", ty)}}
+	}
+
+	var problems []Problem
+	for _, k := range s.Required {
+		if values[k] == "" {
+			problems = append(problems, Problem{Msg: fmt.Sprintf("%s is required by %s", k, ty)})
+		}
+	}
+	for _, k := range []string{PairCredential, PairEndpoint, PairLocation, PairName, PairWorkDir} {
+		if values[k] != "" && !s.Allows(k) {
+			problems = append(problems, Problem{Unknown: true, Msg: fmt.Sprintf("%s is not supported by %s", k, ty)})
+		}
+	}
+
+	if strings.ContainsRune(values[PairName], '/') {
+		problems = append(problems, Problem{Msg: fmt.Sprintf("name %q contains /", values[PairName])})
+	}
+	// Work dirs of all services are absolute dirs.
+	if v := values[PairWorkDir]; v != "" && (!strings.HasPrefix(v, "/") || !strings.HasSuffix(v, "/")) {
+		problems = append(problems, Problem{Msg: fmt.Sprintf("work_dir %q must be an absolute path ending with /", v)})
+	}
+	if v := values[PairCredential]; v != "" && !strings.Contains(v, ":") {
+		problems = append(problems, Problem{Msg: "credential must be <protocol>:<value>, like hmac:ak:sk"})
+	}
+
+	for _, f := range features {
+		if !s.HasFeature(f) {
+			problems = append(problems, Problem{Unknown: true, Msg: fmt.Sprintf("feature %q is not supported by %s", f, ty)})
+		}
+	}
+	return problems
+}
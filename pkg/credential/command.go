@@ -0,0 +1,54 @@
+package credential
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Command is a provider running an external command, like the AWS
+// credential_process. The command prints either the credential or a JSON
+// document to stdout.
+//
+// The output is cached until 5 minutes before `Expiration`, or for 15
+// minutes without it. Output with a `SessionToken` fails with
+// ErrSessionToken.
+type Command struct {
+	name string
+	args []string
+
+	cache cache
+}
+
+// NewCommand creates a Command provider.
+func NewCommand(name string, args ...string) *Command {
+	c := &Command{name: name, args: args}
+	c.cache.fn = c.run
+	return c
+}
+
+// Retrieve implements Provider.
+func (c *Command) Retrieve(ctx context.Context) (*Credential, error) {
+	return c.cache.get(ctx)
+}
+
+func (c *Command) run(ctx context.Context) (*Credential, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, c.name, c.args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		msg := strings.TrimSpace(stderr.String())
+		if msg != "" {
+			return nil, fmt.Errorf("credential command %s: %w: %s", c.name, err, msg)
+		}
+		return nil, fmt.Errorf("credential command %s: %w", c.name, err)
+	}
+	if stdout.Len() > maxDocumentSize {
+		return nil, fmt.Errorf("credential command %s: output too large", c.name)
+	}
+	return parseDocument(stdout.Bytes())
+}
@@ -0,0 +1,65 @@
+package credential
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// File is a provider reading a file, the file is read again once its
+// modification time or size changes.
+//
+// The file contains either the credential, like `hmac:ak:sk`, or a JSON
+// document with `AccessKeyId`, `SecretAccessKey` and optional `Expiration`.
+type File struct {
+	path string
+
+	mu      sync.Mutex
+	cred    *Credential
+	modTime time.Time
+	size    int64
+}
+
+// NewFile creates a File provider.
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Retrieve implements Provider.
+func (f *File) Retrieve(ctx context.Context) (*Credential, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fi, err := os.Stat(f.path)
+	if err != nil {
+		return f.stale(err)
+	}
+	if f.cred != nil && fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+		return f.cred, nil
+	}
+
+	data, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return f.stale(err)
+	}
+	cred, err := parseDocument(data)
+	if err != nil {
+		// The file may be in the middle of being rewritten.
+		return f.stale(err)
+	}
+
+	f.cred, f.modTime, f.size = cred, fi.ModTime(), fi.Size()
+	return cred, nil
+}
+
+// stale returns the last credential if it's not expired, so that a file
+// being replaced doesn't fail operations.
+func (f *File) stale(err error) (*Credential, error) {
+	if f.cred != nil && (f.cred.Expires.IsZero() || time.Now().Before(f.cred.Expires)) {
+		return f.cred, nil
+	}
+	return nil, fmt.Errorf("credential file %s: %w", f.path, err)
+}
@@ -0,0 +1,71 @@
+package credential
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// maxDocumentSize limits the response of endpoints and commands.
+const maxDocumentSize = 64 * 1024
+
+// HTTP is a provider fetching credentials from a local metadata-style
+// endpoint, like the ECS container credentials endpoint.
+//
+// The response is cached until 5 minutes before `Expiration`, or for 15
+// minutes without it. Responses with a session token, like the temporary
+// credentials of the ECS endpoint, fail with ErrSessionToken.
+type HTTP struct {
+	url    string
+	header http.Header
+	client *http.Client
+
+	cache cache
+}
+
+// NewHTTP creates an HTTP provider. The header is sent with every request,
+// for example an Authorization token.
+func NewHTTP(url string, header http.Header) *HTTP {
+	h := &HTTP{
+		url:    url,
+		header: header,
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+	h.cache.fn = h.fetch
+	return h
+}
+
+// Retrieve implements Provider.
+func (h *HTTP) Retrieve(ctx context.Context) (*Credential, error) {
+	return h.cache.get(ctx)
+}
+
+func (h *HTTP) fetch(ctx context.Context) (*Credential, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range h.header {
+		req.Header[k] = v
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("credential endpoint: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		_, _ = io.Copy(ioutil.Discard, io.LimitReader(resp.Body, maxDocumentSize))
+		return nil, fmt.Errorf("credential endpoint %s: unexpected status %s", h.url, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+	if err != nil {
+		return nil, fmt.Errorf("credential endpoint: %w", err)
+	}
+	return parseDocument(data)
+}
@@ -0,0 +1,244 @@
+// Package credential provides credentials from the environment, files,
+// metadata-style HTTP endpoints and external commands, and a Storager which
+// is rebuilt whenever the credential is rotated.
+//
+// A credential is the value of pairs.WithCredential, like `hmac:ak:sk`.
+package credential
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTTL is used for credentials without expiration.
+	defaultTTL = 15 * time.Minute
+	// expiryWindow is how early a credential is refreshed before it expires.
+	expiryWindow = 5 * time.Minute
+	// retryInterval is how long a failed fetch is reported before fetching
+	// again.
+	retryInterval = 10 * time.Second
+)
+
+var (
+	// ErrNoCredential means the provider has no credential.
+	ErrNoCredential = errors.New("no credential")
+	// ErrSessionToken means the credential is temporary and needs a session
+	// token, which can't be carried by a credential value.
+	ErrSessionToken = errors.New("session token not supported")
+)
+
+// Credential is a credential with optional expiration.
+type Credential struct {
+	// Value is the value for pairs.WithCredential, like `hmac:ak:sk`.
+	Value string
+	// Expires is when the credential expires, zero means never.
+	Expires time.Time
+}
+
+// Provider retrieves the current credential.
+//
+// Retrieve is called before every operation of Storager, so implementations
+// are expected to cache the credential until it changes.
+type Provider interface {
+	Retrieve(ctx context.Context) (*Credential, error)
+}
+
+// Static is a provider returning a fixed credential until Set is called. It's
+// mostly used as stand-in for tests.
+type Static struct {
+	mu    sync.Mutex
+	value string
+}
+
+// NewStatic creates a Static provider.
+func NewStatic(value string) *Static {
+	return &Static{value: value}
+}
+
+// Set replaces the credential, as if it was rotated.
+func (s *Static) Set(value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.value = value
+}
+
+// Retrieve implements Provider.
+func (s *Static) Retrieve(ctx context.Context) (*Credential, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.value == "" {
+		return nil, ErrNoCredential
+	}
+	return &Credential{Value: s.value}, nil
+}
+
+// Env is a provider reading environment variables on every call.
+type Env struct {
+	// Protocol is the credential protocol, like hmac.
+	Protocol string
+	// Keys are the names of environment variables joined with `:` after
+	// the protocol.
+	Keys []string
+}
+
+// NewEnv creates an Env provider, for example
+// NewEnv("hmac", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY").
+func NewEnv(protocol string, keys ...string) *Env {
+	return &Env{Protocol: protocol, Keys: keys}
+}
+
+// Retrieve implements Provider.
+func (e *Env) Retrieve(ctx context.Context) (*Credential, error) {
+	parts := make([]string, 0, len(e.Keys)+1)
+	parts = append(parts, e.Protocol)
+	for _, k := range e.Keys {
+		v := os.Getenv(k)
+		if v == "" {
+			return nil, fmt.Errorf("env %s: %w", k, ErrNoCredential)
+		}
+		parts = append(parts, v)
+	}
+	return &Credential{Value: strings.Join(parts, ":")}, nil
+}
+
+// cache caches the credential fetched by fn until it's about to expire.
+//
+// Only one fetch runs at a time, other callers get the old credential while
+// it's not expired, or wait for the fetch. A failure is kept for
+// retryInterval, so that an unavailable endpoint isn't hammered.
+type cache struct {
+	fn func(ctx context.Context) (*Credential, error)
+
+	mu       sync.Mutex
+	cred     *Credential
+	refresh  time.Time
+	err      error
+	retry    time.Time
+	fetching chan struct{}
+}
+
+func (c *cache) get(ctx context.Context) (*Credential, error) {
+	c.mu.Lock()
+	for {
+		now := time.Now()
+		if c.cred != nil && now.Before(c.refresh) {
+			cred := c.cred
+			c.mu.Unlock()
+			return cred, nil
+		}
+		if now.Before(c.retry) || (c.fetching != nil && c.valid(now)) {
+			cred, err := c.fallback(now)
+			c.mu.Unlock()
+			return cred, err
+		}
+		if c.fetching == nil {
+			break
+		}
+
+		fetching := c.fetching
+		c.mu.Unlock()
+		select {
+		case <-fetching:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		c.mu.Lock()
+	}
+	fetching := make(chan struct{})
+	c.fetching = fetching
+	c.mu.Unlock()
+
+	cred, err := c.fn(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.fetching = nil
+	close(fetching)
+
+	now := time.Now()
+	if err != nil {
+		// A canceled caller is not a failure of the endpoint.
+		if ctx.Err() == nil {
+			c.err, c.retry = err, now.Add(retryInterval)
+		}
+		if c.valid(now) {
+			return c.cred, nil
+		}
+		return nil, err
+	}
+
+	c.cred, c.err, c.retry = cred, nil, time.Time{}
+	if cred.Expires.IsZero() {
+		c.refresh = now.Add(defaultTTL)
+	} else {
+		c.refresh = cred.Expires.Add(-expiryWindow)
+	}
+	return cred, nil
+}
+
+// valid reports whether the old credential can still be used.
+func (c *cache) valid(now time.Time) bool {
+	return c.cred != nil && (c.cred.Expires.IsZero() || now.Before(c.cred.Expires))
+}
+
+// fallback returns the old credential while it's valid, or the last error.
+func (c *cache) fallback(now time.Time) (*Credential, error) {
+	if c.valid(now) {
+		return c.cred, nil
+	}
+	return nil, c.err
+}
+
+// document is the output of HTTP endpoints and commands. Both the AWS
+// container credentials and credential_process formats are accepted.
+type document struct {
+	Credential      string    `json:"Credential"`
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	SessionToken    string    `json:"SessionToken"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// parseDocument parses a JSON document, or takes the trimmed text as the
+// credential value.
+//
+// Documents with a session token are rejected with ErrSessionToken: signing
+// with the keys alone would make every request fail.
+func parseDocument(data []byte) (*Credential, error) {
+	text := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(text, "{") {
+		if text == "" {
+			return nil, ErrNoCredential
+		}
+		return &Credential{Value: text}, nil
+	}
+
+	var doc document
+	if err := json.Unmarshal([]byte(text), &doc); err != nil {
+		return nil, fmt.Errorf("parse credential: %w", err)
+	}
+
+	if doc.Token != "" || doc.SessionToken != "" {
+		return nil, fmt.Errorf("parse credential: %w", ErrSessionToken)
+	}
+
+	cred := &Credential{Value: doc.Credential, Expires: doc.Expiration}
+	if cred.Value == "" && doc.AccessKeyID != "" && doc.SecretAccessKey != "" {
+		cred.Value = "hmac:" + doc.AccessKeyID + ":" + doc.SecretAccessKey
+	}
+	if cred.Value == "" {
+		return nil, ErrNoCredential
+	}
+	return cred, nil
+}
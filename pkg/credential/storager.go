@@ -0,0 +1,169 @@
+package credential
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"go.beyondstorage.io/v5/types"
+)
+
+// NewStoragerFunc creates a storager with the given credential.
+type NewStoragerFunc func(credential string) (types.Storager, error)
+
+// Storager retrieves the credential before every operation, and rebuilds the
+// underlying storager once the credential has been rotated.
+//
+// If the provider fails, the current storager is kept until the credential
+// it was created with expires, so that an unavailable endpoint doesn't break
+// operations before that.
+//
+// Only the Storager interface is forwarded. Use Current to access optional
+// interfaces like Multiparter, but note it could be replaced by a later
+// rotation.
+type Storager struct {
+	types.UnimplementedStorager
+
+	provider Provider
+	fn       NewStoragerFunc
+
+	mu      sync.Mutex
+	value   string
+	expires time.Time
+	store   types.Storager
+}
+
+// NewStorager creates a Storager, the underlying storager is created
+// immediately so that a bad credential is reported early.
+func NewStorager(ctx context.Context, p Provider, fn NewStoragerFunc) (*Storager, error) {
+	s := &Storager{provider: p, fn: fn}
+	if _, err := s.current(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Current returns the storager created with the latest credential.
+func (s *Storager) Current(ctx context.Context) (types.Storager, error) {
+	return s.current(ctx)
+}
+
+func (s *Storager) current(ctx context.Context) (types.Storager, error) {
+	cred, err := s.provider.Retrieve(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		if s.valid() {
+			return s.store, nil
+		}
+		return nil, err
+	}
+	if s.store != nil && cred.Value == s.value {
+		s.expires = cred.Expires
+		return s.store, nil
+	}
+
+	store, err := s.fn(cred.Value)
+	if err != nil {
+		if s.valid() {
+			return s.store, nil
+		}
+		return nil, err
+	}
+	s.store, s.value, s.expires = store, cred.Value, cred.Expires
+	return store, nil
+}
+
+// valid reports whether the current storager exists and its credential has
+// not expired.
+func (s *Storager) valid() bool {
+	return s.store != nil && (s.expires.IsZero() || time.Now().Before(s.expires))
+}
+
+// last returns the current storager without retrieving the credential, for
+// operations which can't return an error.
+func (s *Storager) last() types.Storager {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.store
+}
+
+func (s *Storager) String() string {
+	return s.last().String()
+}
+
+func (s *Storager) Metadata(pairs ...types.Pair) *types.StorageMeta {
+	return s.last().Metadata(pairs...)
+}
+
+func (s *Storager) Create(path string, pairs ...types.Pair) *types.Object {
+	store, err := s.current(context.Background())
+	if err != nil {
+		store = s.last()
+	}
+	return store.Create(path, pairs...)
+}
+
+func (s *Storager) Delete(path string, pairs ...types.Pair) error {
+	return s.DeleteWithContext(context.Background(), path, pairs...)
+}
+
+func (s *Storager) DeleteWithContext(ctx context.Context, path string, pairs ...types.Pair) error {
+	store, err := s.current(ctx)
+	if err != nil {
+		return err
+	}
+	return store.DeleteWithContext(ctx, path, pairs...)
+}
+
+func (s *Storager) List(path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	return s.ListWithContext(context.Background(), path, pairs...)
+}
+
+func (s *Storager) ListWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	store, err := s.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.ListWithContext(ctx, path, pairs...)
+}
+
+func (s *Storager) Read(path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	return s.ReadWithContext(context.Background(), path, w, pairs...)
+}
+
+func (s *Storager) ReadWithContext(ctx context.Context, path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	store, err := s.current(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return store.ReadWithContext(ctx, path, w, pairs...)
+}
+
+func (s *Storager) Stat(path string, pairs ...types.Pair) (*types.Object, error) {
+	return s.StatWithContext(context.Background(), path, pairs...)
+}
+
+func (s *Storager) StatWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.Object, error) {
+	store, err := s.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.StatWithContext(ctx, path, pairs...)
+}
+
+func (s *Storager) Write(path string, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	return s.WriteWithContext(context.Background(), path, r, size, pairs...)
+}
+
+func (s *Storager) WriteWithContext(ctx context.Context, path string, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	store, err := s.current(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return store.WriteWithContext(ctx, path, r, size, pairs...)
+}
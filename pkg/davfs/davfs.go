@@ -0,0 +1,319 @@
+//go:build go1.16
+// +build go1.16
+
+// Package davfs exposes a types.Storager over WebDAV.
+//
+// FileSystem implements webdav.FileSystem on top of pkg/iofs, so it works
+// with golang.org/x/net/webdav.Handler:
+//
+//   - PROPFIND lists directories with types.ListModeDir.
+//   - GET supports Range requests via ranged Read calls.
+//   - PUT uploads with a single Write, or with multipart for large bodies if
+//     the storager implements types.Multiparter.
+//   - MKCOL creates a dir via types.Direr, or a dir marker object.
+//   - MOVE copies then deletes every object and recreates the dirs, COPY
+//     streams the content.
+package davfs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/net/webdav"
+
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/iofs"
+)
+
+// DefaultPartSize is the part size used for multipart uploads.
+const DefaultPartSize = 16 * 1024 * 1024
+
+// FileSystem implements webdav.FileSystem on top of types.Storager.
+type FileSystem struct {
+	store types.Storager
+	fsys  *iofs.FS
+
+	// PartSize is the size of buffered data before starting a multipart
+	// upload, and the size of every part.
+	PartSize int64
+}
+
+var _ webdav.FileSystem = (*FileSystem)(nil)
+
+// NewFileSystem creates a FileSystem for store's work dir.
+func NewFileSystem(store types.Storager) *FileSystem {
+	return &FileSystem{
+		store:    store,
+		fsys:     iofs.New(store),
+		PartSize: DefaultPartSize,
+	}
+}
+
+// NewHandler creates a WebDAV handler serving store under prefix.
+func NewHandler(store types.Storager, prefix string) *webdav.Handler {
+	return &webdav.Handler{
+		Prefix:     prefix,
+		FileSystem: NewFileSystem(store),
+		LockSystem: webdav.NewMemLS(),
+	}
+}
+
+// Mkdir implements webdav.FileSystem.
+func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	key, fname := clean(name)
+	if fname == "." {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	}
+
+	if _, err := f.fsys.Stat(fname); err == nil {
+		return &fs.PathError{Op: "mkdir", Path: name, Err: fs.ErrExist}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	if err := f.checkParent("mkdir", fname); err != nil {
+		return err
+	}
+	return f.mkdir(ctx, key)
+}
+
+// mkdir creates the dir key.
+func (f *FileSystem) mkdir(ctx context.Context, key string) error {
+	if d, ok := f.store.(types.Direr); ok {
+		_, err := d.CreateDirWithContext(ctx, key)
+		return err
+	}
+
+	// Object storages have no dir, an empty object ending with "/" is the
+	// marker used by most clients and by services' virtual dir support.
+	_, err := f.store.WriteWithContext(ctx, key+"/", strings.NewReader(""), 0)
+	return err
+}
+
+// rmdir deletes the empty dir key: the dir itself for services with native
+// dir support, and its marker.
+func (f *FileSystem) rmdir(ctx context.Context, key string) error {
+	if _, ok := f.store.(types.Direr); ok {
+		if err := f.store.DeleteWithContext(ctx, key); err != nil {
+			return err
+		}
+	}
+	return f.store.DeleteWithContext(ctx, key+"/")
+}
+
+// OpenFile implements webdav.FileSystem.
+func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	key, fname := clean(name)
+
+	if flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		file, err := f.fsys.Open(fname)
+		if err != nil {
+			return nil, err
+		}
+		return &readFile{File: file, name: fname}, nil
+	}
+
+	// Objects can only be rewritten as a whole.
+	if flag&os.O_APPEND != 0 {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	info, err := f.fsys.Stat(fname)
+	switch {
+	case err == nil && info.IsDir():
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errIsDir}
+	case err == nil && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case err != nil && !errors.Is(err, fs.ErrNotExist):
+		return nil, err
+	case err != nil && flag&os.O_CREATE == 0:
+		return nil, err
+	}
+	if err := f.checkParent("open", fname); err != nil {
+		return nil, err
+	}
+
+	return newWriteFile(ctx, f, key), nil
+}
+
+// RemoveAll implements webdav.FileSystem.
+func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	key, fname := clean(name)
+	if fname == "." {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrPermission}
+	}
+
+	info, err := f.fsys.Stat(fname)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return f.store.DeleteWithContext(ctx, key)
+	}
+
+	entries, err := f.entries(fname)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.dir {
+			continue
+		}
+		if err := f.store.DeleteWithContext(ctx, e.name); err != nil {
+			return err
+		}
+	}
+	// Delete the dirs once empty, the deepest first.
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].dir {
+			continue
+		}
+		if err := f.rmdir(ctx, entries[i].name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rename implements webdav.FileSystem.
+//
+// Objects are copied to the new path then deleted. Dirs are renamed object by
+// object: every dir, empty ones included, is created at the new path before
+// its content is moved, and the old dirs are deleted at last.
+func (f *FileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	oldKey, oldFname := clean(oldName)
+	newKey, newFname := clean(newName)
+	if oldFname == "." || newFname == "." {
+		return &fs.PathError{Op: "rename", Path: oldName, Err: fs.ErrPermission}
+	}
+
+	info, err := f.fsys.Stat(oldFname)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return f.move(ctx, oldKey, newKey, info.Size())
+	}
+
+	if strings.HasPrefix(newKey+"/", oldKey+"/") {
+		return &fs.PathError{Op: "rename", Path: newName, Err: fs.ErrInvalid}
+	}
+
+	entries, err := f.entries(oldFname)
+	if err != nil {
+		return err
+	}
+
+	// Dirs come before their content.
+	for _, e := range entries {
+		dst := newKey + strings.TrimPrefix(e.name, oldFname)
+		if e.dir {
+			err = f.mkdir(ctx, dst)
+		} else {
+			err = f.move(ctx, e.name, dst, e.size)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !entries[i].dir {
+			continue
+		}
+		if err := f.rmdir(ctx, entries[i].name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stat implements webdav.FileSystem.
+func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	_, fname := clean(name)
+	return f.fsys.Stat(fname)
+}
+
+// move copies src to dst and then deletes src.
+func (f *FileSystem) move(ctx context.Context, src, dst string, size int64) error {
+	if c, ok := f.store.(types.Copier); ok {
+		if err := c.CopyWithContext(ctx, src, dst); err != nil {
+			return err
+		}
+		return f.store.DeleteWithContext(ctx, src)
+	}
+
+	r, w := io.Pipe()
+	go func() {
+		_, err := f.store.ReadWithContext(ctx, src, w)
+		w.CloseWithError(err)
+	}()
+	_, err := f.store.WriteWithContext(ctx, dst, r, size)
+	// Unblock the reader if Write returned early.
+	r.CloseWithError(err)
+	if err != nil {
+		return err
+	}
+	return f.store.DeleteWithContext(ctx, src)
+}
+
+type entry struct {
+	name string
+	dir  bool
+	size int64
+}
+
+// entries returns the dir fname and everything under it, dirs before their
+// content. They're collected first, mutating while listing is not safe on
+// every service.
+func (f *FileSystem) entries(fname string) ([]entry, error) {
+	var entries []entry
+	err := fs.WalkDir(f.fsys, fname, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		e := entry{name: name, dir: d.IsDir()}
+		if !e.dir {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			e.size = info.Size()
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// checkParent returns fs.ErrNotExist if the parent dir of name is missing,
+// which the webdav handler reports as 409 Conflict.
+func (f *FileSystem) checkParent(op, name string) error {
+	parent := path.Dir(name)
+	info, err := f.fsys.Stat(parent)
+	if err != nil {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !info.IsDir() {
+		return &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	return nil
+}
+
+// clean converts a WebDAV name into the storager path and the io/fs name.
+func clean(name string) (key, fname string) {
+	key = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if key == "" {
+		return "", "."
+	}
+	return key, key
+}
+
+var (
+	errIsDir  = errors.New("is a directory")
+	errNotDir = errors.New("not a directory")
+)
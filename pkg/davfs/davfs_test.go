@@ -0,0 +1,103 @@
+//go:build go1.16
+// +build go1.16
+
+package davfs
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	fs "go.beyondstorage.io/services/fs/v4"
+	"go.beyondstorage.io/v5/pairs"
+)
+
+// serve serves a fs storager in a temp dir, and returns the dir and a func
+// doing a request which must respond with want.
+func serve(t *testing.T) (string, func(method, name, body string, header map[string]string, want int)) {
+	dir := t.TempDir()
+	store, err := fs.NewStorager(pairs.WithWorkDir(dir + "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(NewHandler(store, ""))
+	t.Cleanup(srv.Close)
+
+	return dir, func(method, name, body string, header map[string]string, want int) {
+		t.Helper()
+
+		if v, ok := header["Destination"]; ok {
+			header["Destination"] = srv.URL + v
+		}
+		req, err := http.NewRequest(method, srv.URL+name, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("%s %s: got status %d, want %d", method, name, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestRenameDir(t *testing.T) {
+	dir, do := serve(t)
+
+	do("MKCOL", "/a", "", nil, http.StatusCreated)
+	do("MKCOL", "/a/empty", "", nil, http.StatusCreated)
+	do("MKCOL", "/a/sub", "", nil, http.StatusCreated)
+	do("PUT", "/a/sub/f.txt", "hello", nil, http.StatusCreated)
+	do("MOVE", "/a", "", map[string]string{"Destination": "/b"}, http.StatusCreated)
+
+	if _, err := os.Stat(filepath.Join(dir, "a")); !os.IsNotExist(err) {
+		t.Errorf("source dir: got %v, want not exist", err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "b", "empty")); err != nil || !fi.IsDir() {
+		t.Errorf("empty dir: got %v, want a dir", err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "b", "sub", "f.txt"))
+	if err != nil || string(content) != "hello" {
+		t.Errorf("moved file: got %q, %v, want %q", content, err, "hello")
+	}
+}
+
+func TestRemoveAll(t *testing.T) {
+	dir, do := serve(t)
+
+	do("MKCOL", "/a", "", nil, http.StatusCreated)
+	do("MKCOL", "/a/empty", "", nil, http.StatusCreated)
+	do("MKCOL", "/a/sub", "", nil, http.StatusCreated)
+	do("PUT", "/a/sub/f.txt", "hello", nil, http.StatusCreated)
+	do("PUT", "/a/g.txt", "world", nil, http.StatusCreated)
+	do("DELETE", "/a", "", nil, http.StatusNoContent)
+
+	if _, err := os.Stat(filepath.Join(dir, "a")); !os.IsNotExist(err) {
+		t.Errorf("deleted dir: got %v, want not exist", err)
+	}
+
+	// Overwriting a dir removes it first.
+	do("MKCOL", "/c", "", nil, http.StatusCreated)
+	do("PUT", "/c/f.txt", "hello", nil, http.StatusCreated)
+	do("MKCOL", "/d", "", nil, http.StatusCreated)
+	do("PUT", "/d/old.txt", "old", nil, http.StatusCreated)
+	do("MOVE", "/c", "", map[string]string{"Destination": "/d", "Overwrite": "T"}, http.StatusNoContent)
+
+	if _, err := os.Stat(filepath.Join(dir, "d", "old.txt")); !os.IsNotExist(err) {
+		t.Errorf("overwritten file: got %v, want not exist", err)
+	}
+	content, err := ioutil.ReadFile(filepath.Join(dir, "d", "f.txt"))
+	if err != nil || string(content) != "hello" {
+		t.Errorf("moved file: got %q, %v, want %q", content, err, "hello")
+	}
+}
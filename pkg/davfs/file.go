@@ -0,0 +1,210 @@
+//go:build go1.16
+// +build go1.16
+
+package davfs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/types"
+)
+
+// readFile adapts a file opened by iofs to webdav.File.
+type readFile struct {
+	fs.File
+	name string
+}
+
+func (f *readFile) Readdir(count int) ([]os.FileInfo, error) {
+	d, ok := f.File.(fs.ReadDirFile)
+	if !ok {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: errNotDir}
+	}
+
+	entries, err := d.ReadDir(count)
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil {
+			return infos, err
+		}
+		infos = append(infos, info)
+	}
+	return infos, err
+}
+
+func (f *readFile) Seek(offset int64, whence int) (int64, error) {
+	s, ok := f.File.(io.Seeker)
+	if !ok {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: errIsDir}
+	}
+	return s.Seek(offset, whence)
+}
+
+func (f *readFile) Write([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+}
+
+// writeFile uploads the written content on Close.
+//
+// Content is buffered in memory up to PartSize. If more is written and the
+// storager implements types.Multiparter, every full buffer is uploaded as a
+// part, so memory usage is bounded. Otherwise, the content is spooled into a
+// temp file since Write needs to know the size in advance.
+type writeFile struct {
+	ctx   context.Context
+	fsys  *FileSystem
+	key   string
+	size  int64
+	buf   bytes.Buffer
+	since time.Time
+
+	mp    types.Multiparter
+	o     *types.Object
+	parts []*types.Part
+
+	spool *os.File
+	err   error
+}
+
+func newWriteFile(ctx context.Context, fsys *FileSystem, key string) *writeFile {
+	f := &writeFile{ctx: ctx, fsys: fsys, key: key, since: time.Now()}
+	f.mp, _ = fsys.store.(types.Multiparter)
+	return f
+}
+
+func (f *writeFile) Write(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+
+	if f.spool != nil {
+		n, err := f.spool.Write(p)
+		f.size += int64(n)
+		f.err = err
+		return n, err
+	}
+
+	n, _ := f.buf.Write(p)
+	f.size += int64(n)
+	for int64(f.buf.Len()) > f.fsys.PartSize {
+		if f.err = f.flush(); f.err != nil {
+			return n, f.err
+		}
+	}
+	return n, nil
+}
+
+// flush uploads a full part, or moves the buffered content into the spool
+// file if multipart is not supported.
+func (f *writeFile) flush() error {
+	if f.mp == nil {
+		spool, err := ioutil.TempFile("", "davfs-")
+		if err != nil {
+			return err
+		}
+		f.spool = spool
+		_, err = f.buf.WriteTo(spool)
+		return err
+	}
+
+	if f.o == nil {
+		o, err := f.mp.CreateMultipartWithContext(f.ctx, f.key)
+		if err != nil {
+			return err
+		}
+		f.o = o
+	}
+
+	size := f.fsys.PartSize
+	if int64(f.buf.Len()) < size {
+		size = int64(f.buf.Len())
+	}
+	_, part, err := f.mp.WriteMultipartWithContext(f.ctx, f.o,
+		bytes.NewReader(f.buf.Next(int(size))), size, len(f.parts))
+	if err != nil {
+		return err
+	}
+	f.parts = append(f.parts, part)
+	return nil
+}
+
+func (f *writeFile) Close() error {
+	err := f.close()
+	if err != nil && f.o != nil {
+		// Abort the upload so that no uploaded parts are left behind.
+		_ = f.fsys.store.DeleteWithContext(f.ctx, f.key, pairs.WithMultipartID(f.o.MustGetMultipartID()))
+	}
+	if f.spool != nil {
+		f.spool.Close()
+		os.Remove(f.spool.Name())
+	}
+	return err
+}
+
+func (f *writeFile) close() error {
+	if f.err != nil {
+		return f.err
+	}
+
+	switch {
+	case f.spool != nil:
+		if _, err := f.spool.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		_, err := f.fsys.store.WriteWithContext(f.ctx, f.key, f.spool, f.size)
+		return err
+	case f.o != nil:
+		for f.buf.Len() > 0 {
+			if err := f.flush(); err != nil {
+				return err
+			}
+		}
+		return f.mp.CompleteMultipartWithContext(f.ctx, f.o, f.parts)
+	default:
+		_, err := f.fsys.store.WriteWithContext(f.ctx, f.key, &f.buf, int64(f.buf.Len()))
+		return err
+	}
+}
+
+func (f *writeFile) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: f.key, Err: fs.ErrPermission}
+}
+
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	// Writes are sequential, only reporting the current position is supported.
+	if offset == 0 && whence == io.SeekCurrent {
+		return f.size, nil
+	}
+	return 0, &fs.PathError{Op: "seek", Path: f.key, Err: fs.ErrInvalid}
+}
+
+func (f *writeFile) Readdir(int) ([]os.FileInfo, error) {
+	return nil, &fs.PathError{Op: "readdir", Path: f.key, Err: errNotDir}
+}
+
+func (f *writeFile) Stat() (os.FileInfo, error) {
+	return &writeInfo{name: path.Base(f.key), size: f.size, modTime: f.since}, nil
+}
+
+// writeInfo is the info of a file being written.
+type writeInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi *writeInfo) Name() string       { return fi.name }
+func (fi *writeInfo) Size() int64        { return fi.size }
+func (fi *writeInfo) Mode() fs.FileMode  { return 0o644 }
+func (fi *writeInfo) ModTime() time.Time { return fi.modTime }
+func (fi *writeInfo) IsDir() bool        { return false }
+func (fi *writeInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,294 @@
+// Package etag computes and verifies the ETags of objects written by
+// multipart uploads.
+//
+// The ETag of a multipart object on s3, cos, bos and compatible services is
+// not the MD5 of the content but the MD5 of the concatenated binary MD5s of
+// its parts, followed by "-" and the number of parts. It depends on the part
+// sizes, which can be inferred from the ETag and the size of the object.
+package etag
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.beyondstorage.io/v5/types"
+)
+
+const (
+	mib = 1024 * 1024
+	// maxCandidates bounds the part sizes tried by Verify, each costs a
+	// full read of the content.
+	maxCandidates = 16
+)
+
+// ErrInvalid means the ETag is neither an MD5 nor a multipart ETag.
+var ErrInvalid = errors.New("invalid etag")
+
+// ETag is a parsed ETag.
+type ETag struct {
+	// Digest is the hex encoded MD5, of the content or of the part MD5s.
+	Digest string
+	// Parts is the number of parts, 0 if the ETag is the MD5 of the
+	// content.
+	Parts int
+}
+
+// Parse parses an ETag, quoted or not.
+func Parse(s string) (ETag, error) {
+	s = strings.Trim(s, `"`)
+	digest, parts := s, 0
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		n, err := strconv.Atoi(s[i+1:])
+		if err != nil || n <= 0 {
+			return ETag{}, fmt.Errorf("%q: %w", s, ErrInvalid)
+		}
+		digest, parts = s[:i], n
+	}
+	if b, err := hex.DecodeString(digest); err != nil || len(b) != md5.Size {
+		return ETag{}, fmt.Errorf("%q: %w", s, ErrInvalid)
+	}
+	return ETag{Digest: strings.ToLower(digest), Parts: parts}, nil
+}
+
+// IsMultipart reports whether the ETag is of a multipart object.
+func (e ETag) IsMultipart() bool {
+	return e.Parts > 0
+}
+
+func (e ETag) String() string {
+	if e.Parts == 0 {
+		return e.Digest
+	}
+	return e.Digest + "-" + strconv.Itoa(e.Parts)
+}
+
+// Compute computes the ETag of r uploaded in parts of partSize, the last
+// part being smaller. With partSize <= 0, it's the MD5 of r, as for objects
+// written by Write. It also returns the size of r.
+func Compute(r io.Reader, partSize int64) (ETag, int64, error) {
+	if partSize <= 0 {
+		h := md5.New()
+		n, err := io.Copy(h, r)
+		if err != nil {
+			return ETag{}, n, err
+		}
+		return ETag{Digest: hex.EncodeToString(h.Sum(nil))}, n, nil
+	}
+
+	sum := newSum()
+	var total int64
+	for {
+		n, err := sum.part(r, partSize)
+		total += n
+		if err != nil {
+			return ETag{}, total, err
+		}
+		if n < partSize {
+			break
+		}
+	}
+	return sum.etag(), total, nil
+}
+
+// ComputeParts computes the ETag of r uploaded in parts of the given sizes,
+// like parts of a resumed upload.
+func ComputeParts(r io.Reader, sizes []int64) (ETag, error) {
+	sum := newSum()
+	for i, size := range sizes {
+		n, err := sum.part(r, size)
+		if err != nil {
+			return ETag{}, err
+		}
+		if n != size {
+			return ETag{}, fmt.Errorf("part %d: got %d bytes, expected %d: %w", i, n, size, io.ErrUnexpectedEOF)
+		}
+	}
+	return sum.etag(), nil
+}
+
+// ComputeFile computes the ETag of a local file uploaded in parts of
+// partSize.
+func ComputeFile(path string, partSize int64) (ETag, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return ETag{}, err
+	}
+	defer f.Close()
+
+	e, _, err := Compute(f, partSize)
+	return e, err
+}
+
+// FromParts computes the ETag of an object completed with parts, from the
+// ETags returned by WriteMultipart.
+func FromParts(parts []*types.Part) (ETag, error) {
+	sum := newSum()
+	for _, p := range parts {
+		e, err := Parse(p.ETag)
+		if err != nil || e.IsMultipart() {
+			return ETag{}, fmt.Errorf("part %d: %q: %w", p.Index, p.ETag, ErrInvalid)
+		}
+		b, _ := hex.DecodeString(e.Digest)
+		sum.digests = append(sum.digests, b...)
+		sum.parts++
+	}
+	return sum.etag(), nil
+}
+
+// sum accumulates the MD5s of parts.
+type sum struct {
+	digests []byte
+	parts   int
+}
+
+func newSum() *sum {
+	return &sum{}
+}
+
+// part reads up to size bytes of r as a part. A part of 0 byte is only
+// counted if it's the first, as an empty object has one part.
+func (s *sum) part(r io.Reader, size int64) (int64, error) {
+	h := md5.New()
+	n, err := io.Copy(h, io.LimitReader(r, size))
+	if err != nil {
+		return n, err
+	}
+	if n > 0 || s.parts == 0 {
+		s.digests = h.Sum(s.digests)
+		s.parts++
+	}
+	return n, nil
+}
+
+func (s *sum) etag() ETag {
+	d := md5.Sum(s.digests)
+	return ETag{Digest: hex.EncodeToString(d[:]), Parts: s.parts}
+}
+
+// PartSizes returns the part sizes which give e.Parts parts for an object
+// of size, the most likely first: sizes used by default by common tools,
+// then other multiples of 1 MiB, then the smallest possible size.
+//
+// A multipart ETag of one part fits any part size from size.
+func PartSizes(e ETag, size int64) []int64 {
+	n := int64(e.Parts)
+	if n <= 0 || size < 0 {
+		return nil
+	}
+	if n == 1 {
+		if size == 0 {
+			return []int64{1}
+		}
+		return []int64{size}
+	}
+
+	// Parts of p bytes give n parts if (n-1)*p < size <= n*p.
+	lo := (size + n - 1) / n
+	hi := (size - 1) / (n - 1)
+	if lo > hi {
+		return nil
+	}
+
+	var sizes []int64
+	seen := make(map[int64]bool)
+	add := func(p int64) {
+		if p >= lo && p <= hi && !seen[p] {
+			seen[p] = true
+			sizes = append(sizes, p)
+		}
+	}
+
+	for _, p := range []int64{8, 5, 16, 10, 15, 32, 64, 100, 128, 256, 512, 1024} {
+		add(p * mib)
+	}
+	for p := (lo + mib - 1) / mib * mib; p <= hi && len(sizes) < maxCandidates; p += mib {
+		add(p)
+	}
+	add(lo)
+	return sizes
+}
+
+// Match is the result of a verification.
+type Match struct {
+	OK bool
+	// PartSize is the part size matching the ETag, 0 if the ETag is an MD5.
+	PartSize int64
+}
+
+// Verify checks that r of size has the ETag remote. For a multipart ETag,
+// the part sizes from PartSizes are tried in order, up to 16 of them, each
+// costing a full read of r.
+func Verify(r io.ReaderAt, size int64, remote string) (Match, error) {
+	want, err := Parse(remote)
+	if err != nil {
+		return Match{}, err
+	}
+
+	if !want.IsMultipart() {
+		got, _, err := Compute(io.NewSectionReader(r, 0, size), 0)
+		if err != nil {
+			return Match{}, err
+		}
+		return Match{OK: got == want}, nil
+	}
+
+	candidates := PartSizes(want, size)
+	if len(candidates) > maxCandidates {
+		candidates = candidates[:maxCandidates]
+	}
+	for _, p := range candidates {
+		got, _, err := Compute(io.NewSectionReader(r, 0, size), p)
+		if err != nil {
+			return Match{}, err
+		}
+		if got == want {
+			return Match{OK: true, PartSize: p}, nil
+		}
+	}
+	return Match{}, nil
+}
+
+// VerifyFile checks that the local file at path has the ETag remote.
+func VerifyFile(path string, remote string) (Match, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Match{}, err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return Match{}, err
+	}
+	return Verify(f, fi.Size(), remote)
+}
+
+// VerifyObject checks that the local file at local is the same as the
+// object at path, by size and ETag.
+func VerifyObject(ctx context.Context, store types.Storager, path, local string) (Match, error) {
+	o, err := store.StatWithContext(ctx, path)
+	if err != nil {
+		return Match{}, err
+	}
+	remote, ok := o.GetEtag()
+	if !ok {
+		return Match{}, fmt.Errorf("stat %s: no etag", path)
+	}
+	size, _ := o.GetContentLength()
+
+	fi, err := os.Stat(local)
+	if err != nil {
+		return Match{}, err
+	}
+	if fi.Size() != size {
+		return Match{}, nil
+	}
+	return VerifyFile(local, remote)
+}
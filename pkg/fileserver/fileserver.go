@@ -0,0 +1,275 @@
+//go:build go1.16
+// +build go1.16
+
+// Package fileserver serves the content of a types.Storager over HTTP.
+//
+// Compared with http.FileServer(fswrap.HttpFs(store)), Handler adds:
+//
+//   - ETag and If-None-Match support based on the object's etag.
+//   - A configurable index file.
+//   - Directory listings as HTML or JSON.
+//   - Redirecting large objects to a presigned URL instead of proxying them.
+//
+// Range requests and Last-Modified are handled by http.ServeContent on top of
+// the seekable files provided by pkg/iofs.
+package fileserver
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/iofs"
+)
+
+// Options controls the behavior of Handler.
+type Options struct {
+	// IndexFile is served instead of the directory listing if it exists in
+	// the requested directory. Leave it empty to always list directories.
+	IndexFile string
+	// DisableListing makes directory requests without an index file return
+	// 404 instead of a listing.
+	DisableListing bool
+	// RedirectSize is the minimum object size to redirect to a presigned URL.
+	// It only takes effect if the storager implements types.StorageHTTPSigner,
+	// zero disables redirecting.
+	RedirectSize int64
+	// RedirectExpire is the validity of the presigned URL, default to 15 minutes.
+	RedirectExpire time.Duration
+	// ErrorLog is used to log unexpected storage errors, default to log.Printf.
+	ErrorLog func(format string, args ...interface{})
+}
+
+// Handler serves a types.Storager over HTTP.
+type Handler struct {
+	store  types.Storager
+	fsys   *iofs.FS
+	signer types.StorageHTTPSigner
+	opts   Options
+}
+
+// New creates a Handler serving the work dir of store.
+func New(store types.Storager, opts Options) *Handler {
+	if opts.RedirectExpire == 0 {
+		opts.RedirectExpire = 15 * time.Minute
+	}
+	if opts.ErrorLog == nil {
+		opts.ErrorLog = log.Printf
+	}
+
+	h := &Handler{
+		store: store,
+		fsys:  iofs.New(store),
+		opts:  opts,
+	}
+	if opts.RedirectSize > 0 {
+		h.signer, _ = store.(types.StorageHTTPSigner)
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	upath := r.URL.Path
+	if !strings.HasPrefix(upath, "/") {
+		upath = "/" + upath
+	}
+	name := strings.TrimPrefix(path.Clean(upath), "/")
+	if name == "" {
+		name = "."
+	}
+
+	info, err := h.fsys.Stat(name)
+	if err != nil {
+		h.serveError(w, r, err)
+		return
+	}
+
+	if !info.IsDir() {
+		h.serveFile(w, r, name, info)
+		return
+	}
+
+	// Redirect to the canonical dir path, so that relative links in the
+	// listing and in the index file work.
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		localRedirect(w, r, path.Base(upath)+"/")
+		return
+	}
+
+	if h.opts.IndexFile != "" {
+		index := path.Join(name, h.opts.IndexFile)
+		info, err := h.fsys.Stat(index)
+		if err == nil && !info.IsDir() {
+			h.serveFile(w, r, index, info)
+			return
+		}
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			h.serveError(w, r, err)
+			return
+		}
+	}
+
+	if h.opts.DisableListing {
+		http.NotFound(w, r)
+		return
+	}
+	h.serveDir(w, r, name)
+}
+
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, name string, info fs.FileInfo) {
+	if o, ok := info.Sys().(*types.Object); ok {
+		if etag, ok := o.GetEtag(); ok && etag != "" {
+			// http.ServeContent checks If-None-Match and If-Range against it.
+			w.Header().Set("ETag", quoteETag(etag))
+		}
+	}
+
+	if h.signer != nil && info.Size() >= h.opts.RedirectSize {
+		req, err := h.signer.QuerySignHTTPRead(name, h.opts.RedirectExpire)
+		if err == nil {
+			http.Redirect(w, r, req.URL.String(), http.StatusTemporaryRedirect)
+			return
+		}
+		// Fall back to proxying, the object is still readable.
+		h.opts.ErrorLog("fileserver: sign %s: %v", name, err)
+	}
+
+	f, err := h.fsys.Open(name)
+	if err != nil {
+		h.serveError(w, r, err)
+		return
+	}
+	defer f.Close()
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f.(io.ReadSeeker))
+}
+
+// Entry is an item of the JSON directory listing.
+type Entry struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	IsDir   bool      `json:"is_dir"`
+}
+
+func (h *Handler) serveDir(w http.ResponseWriter, r *http.Request, name string) {
+	list, err := h.fsys.ReadDir(name)
+	if err != nil {
+		h.serveError(w, r, err)
+		return
+	}
+
+	entries := make([]Entry, 0, len(list))
+	for _, v := range list {
+		info, err := v.Info()
+		if err != nil {
+			h.serveError(w, r, err)
+			return
+		}
+		entries = append(entries, Entry{
+			Name:    v.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			IsDir:   v.IsDir(),
+		})
+	}
+
+	if wantJSON(r) {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if r.Method == http.MethodHead {
+			return
+		}
+		_ = json.NewEncoder(w).Encode(entries)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if r.Method == http.MethodHead {
+		return
+	}
+	err = listingTemplate.Execute(w, struct {
+		Path    string
+		Entries []Entry
+	}{"/" + strings.TrimPrefix(name, "."), entries})
+	if err != nil {
+		h.opts.ErrorLog("fileserver: render %s: %v", name, err)
+	}
+}
+
+func (h *Handler) serveError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.NotFound(w, r)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "403 Forbidden", http.StatusForbidden)
+	case errors.Is(err, fs.ErrInvalid):
+		http.Error(w, "400 Bad Request", http.StatusBadRequest)
+	default:
+		h.opts.ErrorLog("fileserver: %s %s: %v", r.Method, r.URL.Path, err)
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+	}
+}
+
+// wantJSON reports whether the client asked for a JSON listing, either by
+// `?format=json` or by the Accept header.
+func wantJSON(r *http.Request) bool {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f == "json"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// quoteETag makes sure the etag is a quoted string as required by RFC 7232,
+// some services return it without quotes.
+func quoteETag(etag string) string {
+	if strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, `W/"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
+
+// localRedirect is the same as the one in net/http, which keeps the query.
+func localRedirect(w http.ResponseWriter, r *http.Request, newPath string) {
+	if q := r.URL.RawQuery; q != "" {
+		newPath += "?" + q
+	}
+	w.Header().Set("Location", newPath)
+	w.WriteHeader(http.StatusMovedPermanently)
+}
+
+var listingTemplate = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Last Modified</th></tr>
+{{- range .Entries}}
+<tr>
+{{- if .IsDir}}
+<td><a href="./{{.Name}}/">{{.Name}}/</a></td><td>-</td><td>-</td>
+{{- else}}
+<td><a href="./{{.Name}}">{{.Name}}</a></td><td>{{.Size}}</td><td>{{.ModTime.UTC.Format "2006-01-02 15:04:05"}}</td>
+{{- end}}
+</tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,244 @@
+// Package integrity verifies the content of objects end to end.
+//
+// Checksums are computed while streaming Write and WriteMultipart, compared
+// to the ETag returned by the service, and kept in a manifest object next to
+// the object. Read verifies the content against the manifest, or the ETag if
+// there is no manifest, and fails with a *MismatchError.
+//
+// The manifest also has a CRC-32C of every block, so that ranged reads are
+// verified block by block, and no unverified byte is written to the caller.
+package integrity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+// Checksum algorithms.
+const (
+	MD5    = "md5"
+	CRC32C = "crc32c"
+	SHA256 = "sha256"
+)
+
+const (
+	defaultBlockSize = 1024 * 1024
+	defaultSuffix    = ".integrity"
+)
+
+// ErrMismatch is matched by *MismatchError via errors.Is.
+var ErrMismatch = errors.New("checksum mismatch")
+
+// MismatchError reports content which doesn't match its checksum.
+type MismatchError struct {
+	Path      string
+	Algorithm string
+	// Offset and Size are the range which has been verified.
+	Offset   int64
+	Size     int64
+	Expected string
+	Actual   string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%s %s [%d, %d): expected %s, got %s: %v",
+		e.Path, e.Algorithm, e.Offset, e.Offset+e.Size, e.Expected, e.Actual, ErrMismatch)
+}
+
+func (e *MismatchError) Is(target error) bool {
+	return target == ErrMismatch
+}
+
+// Options configures a Storager.
+type Options struct {
+	// Algorithms are the whole object checksums kept in the manifest,
+	// default to MD5 and CRC32C. Block checksums are always CRC32C.
+	Algorithms []string
+	// BlockSize is the size of the blocks verified by ranged reads,
+	// default to 1 MiB.
+	BlockSize int64
+	// ContentMD5 sends the Content-MD5 of Write and WriteMultipart, for
+	// services which check it. It's only sent when the reader is an
+	// io.Seeker, since the MD5 is computed before sending.
+	ContentMD5 bool
+	// IgnoreETag disables comparing the ETag to the MD5, for services
+	// whose ETag is a 32 digits hex but not the MD5, like s3 with SSE-KMS.
+	IgnoreETag bool
+	// Suffix is appended to the path of the manifest, default to
+	// ".integrity". Manifests are hidden from List.
+	Suffix string
+}
+
+// Manifest holds the checksums of an object.
+type Manifest struct {
+	Size int64 `json:"size"`
+	// ETag is the ETag of the object when the manifest was written, a
+	// manifest with another ETag is stale.
+	ETag string `json:"etag,omitempty"`
+	// Sums are hex encoded checksums of the whole object by algorithm.
+	Sums map[string]string `json:"sums"`
+	// Blocks are the CRC-32C of every BlockSize bytes.
+	BlockSize int64    `json:"block_size,omitempty"`
+	Blocks    []uint32 `json:"blocks,omitempty"`
+}
+
+// Storager is a types.Storager verifying the content of objects. Use
+// Storager.Storager for multipart uploads.
+type Storager struct {
+	types.UnimplementedStorager
+
+	store types.Storager
+	opts  Options
+
+	parts *partSums
+}
+
+// New wraps store with integrity checks.
+func New(store types.Storager, opts Options) *Storager {
+	if len(opts.Algorithms) == 0 {
+		opts.Algorithms = []string{MD5, CRC32C}
+	}
+	if opts.BlockSize <= 0 {
+		opts.BlockSize = defaultBlockSize
+	}
+	if opts.Suffix == "" {
+		opts.Suffix = defaultSuffix
+	}
+	return &Storager{store: store, opts: opts, parts: newPartSums()}
+}
+
+func (s *Storager) String() string {
+	return fmt.Sprintf("Integrity {%s}", s.store)
+}
+
+func (s *Storager) Metadata(pairs ...types.Pair) *types.StorageMeta {
+	return s.store.Metadata(pairs...)
+}
+
+func (s *Storager) Create(path string, pairs ...types.Pair) *types.Object {
+	return s.store.Create(path, pairs...)
+}
+
+func (s *Storager) Stat(path string, pairs ...types.Pair) (*types.Object, error) {
+	return s.StatWithContext(context.Background(), path, pairs...)
+}
+
+func (s *Storager) StatWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.Object, error) {
+	return s.store.StatWithContext(ctx, path, pairs...)
+}
+
+func (s *Storager) Delete(path string, pairs ...types.Pair) error {
+	return s.DeleteWithContext(context.Background(), path, pairs...)
+}
+
+// DeleteWithContext deletes the object and its manifest.
+func (s *Storager) DeleteWithContext(ctx context.Context, path string, pairs ...types.Pair) error {
+	if err := s.store.DeleteWithContext(ctx, path, pairs...); err != nil {
+		return err
+	}
+	if isMultipart(pairs) {
+		s.parts.forget(pairs)
+		return nil
+	}
+	err := s.store.DeleteWithContext(ctx, s.manifestPath(path))
+	if err != nil && !errors.Is(err, services.ErrObjectNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Storager) List(path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	return s.ListWithContext(context.Background(), path, pairs...)
+}
+
+// ListWithContext lists the objects, without manifests.
+func (s *Storager) ListWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	it, err := s.store.ListWithContext(ctx, path, pairs...)
+	if err != nil {
+		return nil, err
+	}
+
+	next := func(ctx context.Context, page *types.ObjectPage) error {
+		for len(page.Data) < pageSize {
+			o, err := it.Next()
+			if err != nil {
+				return err
+			}
+			if !o.Mode.IsDir() && strings.HasSuffix(o.Path, s.opts.Suffix) {
+				continue
+			}
+			page.Data = append(page.Data, o)
+		}
+		return nil
+	}
+	return types.NewObjectIterator(ctx, next, listStatus{}), nil
+}
+
+const pageSize = 100
+
+// listStatus is the status of filtered listings, which can't be continued.
+type listStatus struct{}
+
+func (listStatus) ContinuationToken() string { return "" }
+
+func (s *Storager) manifestPath(path string) string {
+	return path + s.opts.Suffix
+}
+
+// Manifest returns the manifest of path, or services.ErrObjectNotExist.
+func (s *Storager) Manifest(ctx context.Context, path string) (*Manifest, error) {
+	var buf bytes.Buffer
+	if _, err := s.store.ReadWithContext(ctx, s.manifestPath(path), &buf); err != nil {
+		return nil, err
+	}
+	m := &Manifest{}
+	if err := json.Unmarshal(buf.Bytes(), m); err != nil {
+		return nil, fmt.Errorf("manifest of %s: %w", path, err)
+	}
+	return m, nil
+}
+
+func (s *Storager) writeManifest(ctx context.Context, path string, m *Manifest) error {
+	content, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	_, err = s.store.WriteWithContext(ctx, s.manifestPath(path), bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return fmt.Errorf("write manifest of %s: %w", path, err)
+	}
+	return nil
+}
+
+// etag returns the current ETag of path, unquoted.
+func (s *Storager) etag(ctx context.Context, path string) (string, int64, error) {
+	o, err := s.store.StatWithContext(ctx, path)
+	if err != nil {
+		return "", 0, err
+	}
+	etag, _ := o.GetEtag()
+	size, _ := o.GetContentLength()
+	return strings.Trim(etag, `"`), size, nil
+}
+
+// etagMD5 returns the ETag if it's the MD5 of the content, which is the
+// case for most services unless the object was uploaded by multipart or
+// encrypted.
+func etagMD5(etag string) (string, bool) {
+	if len(etag) != 32 {
+		return "", false
+	}
+	for _, c := range etag {
+		if !strings.ContainsRune("0123456789abcdefABCDEF", c) {
+			return "", false
+		}
+	}
+	return strings.ToLower(etag), true
+}
@@ -0,0 +1,172 @@
+package integrity
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.beyondstorage.io/v5/types"
+)
+
+// partSum is the checksums of an uploaded part.
+type partSum struct {
+	size   int64
+	blocks []uint32
+}
+
+// partSums keeps the checksums of parts until the upload is completed.
+// They're kept in memory, an upload resumed by another process has no
+// block checksums.
+type partSums struct {
+	mu      sync.Mutex
+	uploads map[string]map[int]partSum
+}
+
+func newPartSums() *partSums {
+	return &partSums{uploads: make(map[string]map[int]partSum)}
+}
+
+func (p *partSums) add(id string, index int, sum partSum) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.uploads[id] == nil {
+		p.uploads[id] = make(map[int]partSum)
+	}
+	p.uploads[id][index] = sum
+}
+
+func (p *partSums) take(id string) map[int]partSum {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	parts := p.uploads[id]
+	delete(p.uploads, id)
+	return parts
+}
+
+// forget drops the parts of an aborted upload.
+func (p *partSums) forget(ps []types.Pair) {
+	for _, pair := range ps {
+		if id, ok := pair.Value.(string); ok && pair.Key == "multipart_id" {
+			p.take(id)
+		}
+	}
+}
+
+func isMultipart(ps []types.Pair) bool {
+	for _, p := range ps {
+		if p.Key == "multipart_id" {
+			return true
+		}
+	}
+	return false
+}
+
+// multiparter is the Storager of a wrapped storager implementing
+// types.Multiparter, returned by Storager.Storager.
+type multiparter struct {
+	*Storager
+	types.UnimplementedMultiparter
+
+	mp types.Multiparter
+}
+
+// Storager returns s as a types.Storager which implements types.Multiparter
+// if the wrapped storager does, and only then, so that a type assertion
+// tells whether multipart uploads are supported.
+func (s *Storager) Storager() types.Storager {
+	if mp, ok := s.store.(types.Multiparter); ok {
+		return multiparter{Storager: s, mp: mp}
+	}
+	return s
+}
+
+func (s multiparter) CreateMultipart(path string, pairs ...types.Pair) (*types.Object, error) {
+	return s.CreateMultipartWithContext(context.Background(), path, pairs...)
+}
+
+func (s multiparter) CreateMultipartWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.Object, error) {
+	return s.mp.CreateMultipartWithContext(ctx, path, pairs...)
+}
+
+func (s multiparter) WriteMultipart(o *types.Object, r io.Reader, size int64, index int, pairs ...types.Pair) (int64, *types.Part, error) {
+	return s.WriteMultipartWithContext(context.Background(), o, r, size, index, pairs...)
+}
+
+// WriteMultipartWithContext writes the part, and compares its ETag to the
+// MD5 of the content.
+func (s multiparter) WriteMultipartWithContext(ctx context.Context, o *types.Object, r io.Reader, size int64, index int, ps ...types.Pair) (int64, *types.Part, error) {
+	ps, err := s.contentMD5(r, size, ps)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	sum := newSummer([]string{MD5}, s.opts.BlockSize)
+	n, part, err := s.mp.WriteMultipartWithContext(ctx, o, io.TeeReader(r, sum), size, index, ps...)
+	if err != nil {
+		return n, part, err
+	}
+
+	m := sum.manifest()
+	if err := s.checkETag(o.Path, 0, m.Size, strings.Trim(part.ETag, `"`), m.Sums[MD5]); err != nil {
+		err.(*MismatchError).Algorithm = fmt.Sprintf("etag of part %d", index)
+		return n, part, err
+	}
+	if id, ok := o.GetMultipartID(); ok {
+		s.parts.add(id, index, partSum{size: m.Size, blocks: m.Blocks})
+	}
+	return n, part, nil
+}
+
+func (s multiparter) CompleteMultipart(o *types.Object, parts []*types.Part, pairs ...types.Pair) error {
+	return s.CompleteMultipartWithContext(context.Background(), o, parts, pairs...)
+}
+
+// CompleteMultipartWithContext completes the upload, and writes a manifest
+// with block checksums if all parts but the last are a multiple of
+// BlockSize. Whole object checksums can't be derived from parts, they're
+// not in the manifest.
+func (s multiparter) CompleteMultipartWithContext(ctx context.Context, o *types.Object, parts []*types.Part, pairs ...types.Pair) error {
+	if err := s.mp.CompleteMultipartWithContext(ctx, o, parts, pairs...); err != nil {
+		return err
+	}
+
+	id, _ := o.GetMultipartID()
+	sums := s.parts.take(id)
+
+	sorted := make([]*types.Part, len(parts))
+	copy(sorted, parts)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Index < sorted[j].Index })
+
+	m := &Manifest{BlockSize: s.opts.BlockSize, Sums: map[string]string{}}
+	for i, p := range sorted {
+		sum, ok := sums[p.Index]
+		if !ok || (i < len(sorted)-1 && sum.size%s.opts.BlockSize != 0) {
+			m.Blocks = nil
+			m.BlockSize = 0
+			break
+		}
+		m.Size += sum.size
+		m.Blocks = append(m.Blocks, sum.blocks...)
+	}
+
+	etag, size, err := s.etag(ctx, o.Path)
+	if err != nil {
+		return err
+	}
+	m.Size = size
+	m.ETag = etag
+	return s.writeManifest(ctx, o.Path, m)
+}
+
+func (s multiparter) ListMultipart(o *types.Object, pairs ...types.Pair) (*types.PartIterator, error) {
+	return s.ListMultipartWithContext(context.Background(), o, pairs...)
+}
+
+func (s multiparter) ListMultipartWithContext(ctx context.Context, o *types.Object, pairs ...types.Pair) (*types.PartIterator, error) {
+	return s.mp.ListMultipartWithContext(ctx, o, pairs...)
+}
@@ -0,0 +1,161 @@
+package integrity
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+func (s *Storager) Read(path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	return s.ReadWithContext(context.Background(), path, w, pairs...)
+}
+
+// ReadWithContext reads and verifies the object, which costs a Stat and a
+// read of the manifest in addition.
+//
+// With block checksums in the manifest, every block is verified before
+// being written to w, ranges are read from block boundaries. Otherwise, the
+// content is verified against the whole object checksums, or the ETag,
+// after being written to w, and ranges are not verified.
+func (s *Storager) ReadWithContext(ctx context.Context, path string, w io.Writer, ps ...types.Pair) (int64, error) {
+	etag, objSize, err := s.etag(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	m, err := s.Manifest(ctx, path)
+	if err != nil && !errors.Is(err, services.ErrObjectNotExist) {
+		return 0, err
+	}
+	if m != nil && (m.Size != objSize || m.ETag != etag) {
+		// Written without the manifest being updated.
+		m = nil
+	}
+
+	offset, size, rest := splitRange(ps)
+	if offset > objSize {
+		offset = objSize
+	}
+	if size < 0 || offset+size > objSize {
+		size = objSize - offset
+	}
+	whole := offset == 0 && size == objSize
+
+	switch {
+	case m != nil && m.BlockSize > 0 && int64(len(m.Blocks)) == (m.Size+m.BlockSize-1)/m.BlockSize:
+		return s.readBlocks(ctx, path, w, m, offset, size, rest)
+	case whole && m != nil:
+		sum := newSummer(s.opts.Algorithms, s.opts.BlockSize)
+		n, err := s.store.ReadWithContext(ctx, path, io.MultiWriter(w, sum), rest...)
+		if err != nil {
+			return n, err
+		}
+		return n, compare(path, 0, n, m.Sums, sum.sums())
+	case whole && !s.opts.IgnoreETag:
+		h := md5.New()
+		n, err := s.store.ReadWithContext(ctx, path, io.MultiWriter(w, h), rest...)
+		if err != nil {
+			return n, err
+		}
+		return n, s.checkETag(path, 0, n, etag, hex.EncodeToString(h.Sum(nil)))
+	}
+	return s.store.ReadWithContext(ctx, path, w, append(rest, pairs.WithOffset(offset), pairs.WithSize(size))...)
+}
+
+// readBlocks reads the blocks covering the range, and writes the range once
+// the blocks are verified.
+func (s *Storager) readBlocks(ctx context.Context, path string, w io.Writer, m *Manifest, offset, size int64, ps []types.Pair) (int64, error) {
+	if size == 0 {
+		return 0, nil
+	}
+
+	bs := m.BlockSize
+	first, last := offset/bs, (offset+size-1)/bs
+	start, end := first*bs, (last+1)*bs
+	if end > m.Size {
+		end = m.Size
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	go func() {
+		_, err := s.store.ReadWithContext(ctx, path, pw, append(ps, pairs.WithOffset(start), pairs.WithSize(end-start))...)
+		pw.CloseWithError(err)
+	}()
+
+	whole := offset == 0 && size == m.Size
+	sum := newSummer(s.opts.Algorithms, bs)
+
+	var written int64
+	buf := make([]byte, bs)
+	for idx := first; idx <= last; idx++ {
+		blockStart := idx * bs
+		blockLen := bs
+		if blockStart+blockLen > m.Size {
+			blockLen = m.Size - blockStart
+		}
+		b := buf[:blockLen]
+		if _, err := io.ReadFull(pr, b); err != nil {
+			return written, fmt.Errorf("read %s at %d: %w", path, blockStart, err)
+		}
+
+		if crc := crc32.Checksum(b, castagnoli); crc != m.Blocks[idx] {
+			return written, &MismatchError{
+				Path:      path,
+				Algorithm: CRC32C,
+				Offset:    blockStart,
+				Size:      blockLen,
+				Expected:  fmt.Sprintf("%08x", m.Blocks[idx]),
+				Actual:    fmt.Sprintf("%08x", crc),
+			}
+		}
+		if whole {
+			sum.Write(b)
+		}
+
+		lo, hi := int64(0), blockLen
+		if offset > blockStart {
+			lo = offset - blockStart
+		}
+		if offset+size < blockStart+blockLen {
+			hi = offset + size - blockStart
+		}
+		n, err := w.Write(b[lo:hi])
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	if whole {
+		return written, compare(path, 0, written, m.Sums, sum.sums())
+	}
+	return written, nil
+}
+
+// splitRange returns the offset and size pairs, and the other pairs. The size
+// is -1 if not set.
+func splitRange(ps []types.Pair) (offset, size int64, rest []types.Pair) {
+	size = -1
+	for _, p := range ps {
+		switch p.Key {
+		case "offset":
+			offset = p.Value.(int64)
+		case "size":
+			size = p.Value.(int64)
+		default:
+			rest = append(rest, p)
+		}
+	}
+	return offset, size, rest
+}
@@ -0,0 +1,114 @@
+package integrity
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"hash/crc32"
+	"sort"
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case MD5:
+		return md5.New()
+	case CRC32C:
+		return crc32.New(castagnoli)
+	case SHA256:
+		return sha256.New()
+	}
+	return nil
+}
+
+// summer computes the checksums of the content written to it.
+type summer struct {
+	hashes    map[string]hash.Hash
+	blockSize int64
+	block     hash.Hash32
+	blockLen  int64
+	blocks    []uint32
+	size      int64
+}
+
+func newSummer(algorithms []string, blockSize int64) *summer {
+	s := &summer{
+		hashes:    make(map[string]hash.Hash),
+		blockSize: blockSize,
+		block:     crc32.New(castagnoli),
+	}
+	for _, a := range algorithms {
+		if h := newHash(a); h != nil {
+			s.hashes[a] = h
+		}
+	}
+	return s
+}
+
+func (s *summer) Write(p []byte) (int, error) {
+	n := len(p)
+	for _, h := range s.hashes {
+		h.Write(p)
+	}
+	s.size += int64(n)
+
+	for len(p) > 0 {
+		take := s.blockSize - s.blockLen
+		if int64(len(p)) < take {
+			take = int64(len(p))
+		}
+		s.block.Write(p[:take])
+		s.blockLen += take
+		p = p[take:]
+		if s.blockLen == s.blockSize {
+			s.blocks = append(s.blocks, s.block.Sum32())
+			s.block.Reset()
+			s.blockLen = 0
+		}
+	}
+	return n, nil
+}
+
+// sums returns the hex encoded checksums.
+func (s *summer) sums() map[string]string {
+	m := make(map[string]string, len(s.hashes))
+	for a, h := range s.hashes {
+		m[a] = hex.EncodeToString(h.Sum(nil))
+	}
+	return m
+}
+
+// manifest returns the manifest of the content written.
+func (s *summer) manifest() *Manifest {
+	blocks := s.blocks
+	if s.blockLen > 0 {
+		blocks = append(blocks, s.block.Sum32())
+	}
+	return &Manifest{
+		Size:      s.size,
+		Sums:      s.sums(),
+		BlockSize: s.blockSize,
+		Blocks:    blocks,
+	}
+}
+
+// compare returns a *MismatchError for the first algorithm whose checksum
+// differs from expected. Algorithms missing in either are skipped.
+func compare(path string, offset, size int64, expected, actual map[string]string) error {
+	algorithms := make([]string, 0, len(expected))
+	for a := range expected {
+		algorithms = append(algorithms, a)
+	}
+	sort.Strings(algorithms)
+
+	for _, a := range algorithms {
+		got, ok := actual[a]
+		if !ok || got == expected[a] {
+			continue
+		}
+		return &MismatchError{Path: path, Algorithm: a, Offset: offset, Size: size, Expected: expected[a], Actual: got}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package integrity
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/types"
+)
+
+func (s *Storager) Write(path string, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	return s.WriteWithContext(context.Background(), path, r, size, pairs...)
+}
+
+// WriteWithContext writes the object and its manifest. If the ETag shows
+// that the service has other content, a *MismatchError is returned and no
+// manifest is written. The object is left alone: the ETag is read by a Stat
+// after the write, and may be the one of a concurrent write by someone
+// else.
+func (s *Storager) WriteWithContext(ctx context.Context, path string, r io.Reader, size int64, ps ...types.Pair) (int64, error) {
+	ps, err := s.contentMD5(r, size, ps)
+	if err != nil {
+		return 0, err
+	}
+
+	sum := newSummer(s.algorithms(), s.opts.BlockSize)
+	n, err := s.store.WriteWithContext(ctx, path, io.TeeReader(r, sum), size, ps...)
+	if err != nil {
+		return n, err
+	}
+
+	m := sum.manifest()
+	etag, _, err := s.etag(ctx, path)
+	if err != nil {
+		return n, err
+	}
+	if err := s.checkETag(path, 0, m.Size, etag, m.Sums[MD5]); err != nil {
+		return n, err
+	}
+
+	m.ETag = etag
+	return n, s.writeManifest(ctx, path, m)
+}
+
+// algorithms returns the configured algorithms and MD5, which is needed to
+// check the ETag.
+func (s *Storager) algorithms() []string {
+	for _, a := range s.opts.Algorithms {
+		if a == MD5 {
+			return s.opts.Algorithms
+		}
+	}
+	return append([]string{MD5}, s.opts.Algorithms...)
+}
+
+// checkETag compares an MD5 ETag to the MD5 computed.
+func (s *Storager) checkETag(path string, offset, size int64, etag, sum string) error {
+	want, ok := etagMD5(etag)
+	if !ok || s.opts.IgnoreETag || sum == "" || want == sum {
+		return nil
+	}
+	return &MismatchError{Path: path, Algorithm: "etag", Offset: offset, Size: size, Expected: sum, Actual: want}
+}
+
+// contentMD5 adds the Content-MD5 of a seekable r to ps.
+func (s *Storager) contentMD5(r io.Reader, size int64, ps []types.Pair) ([]types.Pair, error) {
+	if !s.opts.ContentMD5 {
+		return ps, nil
+	}
+	for _, p := range ps {
+		if p.Key == "content_md5" {
+			return ps, nil
+		}
+	}
+	rs, ok := r.(io.Seeker)
+	if !ok {
+		return ps, nil
+	}
+
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, io.LimitReader(r, size)); err != nil {
+		return nil, err
+	}
+	if _, err := rs.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return append(ps, pairs.WithContentMd5(base64.StdEncoding.EncodeToString(h.Sum(nil)))), nil
+}
@@ -0,0 +1,57 @@
+// Package walk lists storagers recursively.
+package walk
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+// Walk calls fn for every object below dir, "" being the work dir, with the
+// trailing "/" of dir markers removed. A missing dir is empty.
+//
+// It lists dir by dir with types.ListModeDir, which is supported by file
+// systems and object storages alike, unlike types.ListModePrefix.
+func Walk(ctx context.Context, store types.Storager, dir string, fn func(o *types.Object) error) error {
+	prefix := ""
+	if dir != "" {
+		prefix = strings.TrimSuffix(dir, "/") + "/"
+	}
+	it, err := store.ListWithContext(ctx, prefix, pairs.WithListMode(types.ListModeDir))
+	if err != nil && errors.Is(err, services.ErrObjectNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		o, err := it.Next()
+		if err != nil && errors.Is(err, types.IterateDone) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// Object storages may list the marker of the dir itself.
+		if o.Path == prefix {
+			continue
+		}
+
+		p := strings.TrimSuffix(o.Path, "/")
+		if o.Mode.IsDir() {
+			if err := Walk(ctx, store, p, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		o.Path = p
+		if err := fn(o); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,249 @@
+//go:build go1.16
+// +build go1.16
+
+package iofs
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"sync"
+
+	"go.beyondstorage.io/v5/pairs"
+)
+
+// readAheadSize is the minimum size of a ranged Read issued by file.
+//
+// Small reads, like the ones done by archive/zip or bufio, are served from
+// the read-ahead buffer instead of sending one request each.
+const readAheadSize = 1024 * 1024
+
+// file is a regular file opened for reading.
+//
+// Every read is served by a ranged Read call with pairs.WithOffset and
+// pairs.WithSize, which makes Seek and ReadAt cheap on all services.
+type file struct {
+	fsys *FS
+	name string
+	info *fileInfo
+
+	offset int64
+	closed bool
+
+	// mu protects the read-ahead buffer, ReadAt could be called concurrently.
+	mu     sync.Mutex
+	buf    []byte
+	bufOff int64
+}
+
+var (
+	_ io.ReaderAt = (*file)(nil)
+	_ io.Seeker   = (*file)(nil)
+)
+
+func newFile(fsys *FS, name string, info *fileInfo) *file {
+	return &file{fsys: fsys, name: name, info: info}
+}
+
+func (f *file) Stat() (fs.FileInfo, error) {
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	return f.info, nil
+}
+
+func (f *file) Read(p []byte) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	n, err := f.readAt("read", p, f.offset)
+	f.offset += int64(n)
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+	return n, err
+}
+
+// ReadAt implements io.ReaderAt.
+func (f *file) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	return f.readAt("read", p, off)
+}
+
+// Seek implements io.Seeker.
+func (f *file) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.size
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *file) Close() error {
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+
+	f.mu.Lock()
+	f.buf = nil
+	f.mu.Unlock()
+	return nil
+}
+
+// readAt reads len(p) bytes at off, it returns io.EOF if the end of file is
+// reached before p is filled.
+func (f *file) readAt(op string, p []byte, off int64) (int, error) {
+	size := f.info.size
+	if off >= size {
+		return 0, io.EOF
+	}
+
+	want := int64(len(p))
+	if off+want > size {
+		want = size - off
+	}
+
+	var n int
+	var err error
+	if want >= readAheadSize {
+		// Large reads go straight into p, buffering them would only add a copy.
+		n, err = f.fetch(p[:want], off)
+	} else {
+		n, err = f.readBuffered(p[:want], off)
+	}
+	if err != nil {
+		return n, &fs.PathError{Op: op, Path: f.name, Err: err}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *file) readBuffered(p []byte, off int64) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	end := off + int64(len(p))
+	if off < f.bufOff || end > f.bufOff+int64(len(f.buf)) {
+		size := int64(readAheadSize)
+		if off+size > f.info.size {
+			size = f.info.size - off
+		}
+		if cap(f.buf) < int(size) {
+			f.buf = make([]byte, size)
+		}
+
+		n, err := f.fetch(f.buf[:size], off)
+		f.buf, f.bufOff = f.buf[:n], off
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return copy(p, f.buf[off-f.bufOff:]), nil
+}
+
+// fetch fills p with the content starting at off by a single ranged Read.
+func (f *file) fetch(p []byte, off int64) (int, error) {
+	// The writer reuses p's backing array, so no extra copy is made as long as
+	// the service doesn't return more data than requested.
+	w := bytes.NewBuffer(p[:0])
+
+	_, err := f.fsys.store.Read(f.fsys.key(f.name), w,
+		pairs.WithOffset(off),
+		pairs.WithSize(int64(len(p))),
+	)
+	if err != nil {
+		return 0, formatError(err)
+	}
+
+	n := copy(p, w.Bytes())
+	if n < len(p) {
+		// The object was truncated after Stat.
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, nil
+}
+
+// dir is a directory opened for reading.
+type dir struct {
+	fsys *FS
+	name string
+	info *fileInfo
+
+	entries []fs.DirEntry
+	listed  bool
+	offset  int
+	closed  bool
+}
+
+func (d *dir) Stat() (fs.FileInfo, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "stat", Path: d.name, Err: fs.ErrClosed}
+	}
+	return d.info, nil
+}
+
+func (d *dir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errIsDir}
+}
+
+// ReadDir implements fs.ReadDirFile.
+func (d *dir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if d.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrClosed}
+	}
+
+	if !d.listed {
+		entries, err := d.fsys.readDir(d.name)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+		d.listed = true
+	}
+
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
+
+func (d *dir) Close() error {
+	if d.closed {
+		return &fs.PathError{Op: "close", Path: d.name, Err: fs.ErrClosed}
+	}
+	d.closed = true
+	return nil
+}
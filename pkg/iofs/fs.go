@@ -0,0 +1,244 @@
+//go:build go1.16
+// +build go1.16
+
+// Package iofs provides an io/fs.FS on top of types.Storager.
+//
+// Unlike fswrap.Fs, the returned FS implements all optional io/fs interfaces
+// statically and passes testing/fstest.TestFS:
+//
+//   - ReadDir returns entries sorted by name.
+//   - Sub returns an FS rooted at the sub directory.
+//   - Virtual directories (prefixes without a backing object) report
+//     fs.ModeDir with a zero ModTime, both from Stat and from ReadDir.
+//   - Glob follows path.Match semantics, including path.ErrBadPattern.
+//
+// Opened files also implement io.ReaderAt and io.Seeker. Reads are served by
+// ranged Read calls with a read-ahead buffer, so random access into a large
+// remote object only transfers the bytes around the accessed offsets.
+package iofs
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+// FS is an io/fs.FS backed by a types.Storager.
+type FS struct {
+	store types.Storager
+	root  string
+}
+
+var (
+	_ fs.FS         = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+	_ fs.GlobFS     = (*FS)(nil)
+	_ fs.SubFS      = (*FS)(nil)
+)
+
+// New returns an FS rooted at store's work dir.
+func New(store types.Storager) *FS {
+	return &FS{store: store}
+}
+
+// Open implements fs.FS.
+func (f *FS) Open(name string) (fs.File, error) {
+	info, err := f.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &dir{fsys: f, name: name, info: info}, nil
+	}
+	return newFile(f, name, info), nil
+}
+
+// Stat implements fs.StatFS.
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	return f.stat("stat", name)
+}
+
+// ReadDir implements fs.ReadDirFS.
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	info, err := f.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+
+	return f.readDir(name)
+}
+
+// ReadFile implements fs.ReadFileFS.
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	info, err := f.stat("read", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, info.Size()))
+
+	_, err = f.store.Read(f.key(name), buf)
+	if err != nil {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: formatError(err)}
+	}
+	return buf.Bytes(), nil
+}
+
+// Glob implements fs.GlobFS.
+//
+// Matching is delegated to fs.Glob over ReadDir, so the pattern syntax and
+// errors are exactly those of path.Match.
+func (f *FS) Glob(pattern string) ([]string, error) {
+	return fs.Glob(readDirFS{f}, pattern)
+}
+
+// Sub implements fs.SubFS.
+func (f *FS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if dir == "." {
+		return f, nil
+	}
+	return &FS{store: f.store, root: f.key(dir)}, nil
+}
+
+// key converts a slash-separated io/fs name into a storager path.
+func (f *FS) key(name string) string {
+	if name == "." {
+		return f.root
+	}
+	if f.root == "" {
+		return name
+	}
+	return f.root + "/" + name
+}
+
+// dirKey returns the storager path used to list the children of name.
+func (f *FS) dirKey(name string) string {
+	k := f.key(name)
+	if k == "" {
+		return ""
+	}
+	return k + "/"
+}
+
+func (f *FS) stat(op, name string) (*fileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return newDirInfo("."), nil
+	}
+
+	o, err := f.store.Stat(f.key(name))
+	if err == nil {
+		return newFileInfo(path.Base(name), o), nil
+	}
+	if !errors.Is(err, services.ErrObjectNotExist) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: formatError(err)}
+	}
+
+	// There is no object at this path, but there could be objects under it,
+	// which makes it a virtual directory.
+	it, err := f.store.List(f.dirKey(name), pairs.WithListMode(types.ListModeDir))
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: formatError(err)}
+	}
+	_, err = it.Next()
+	if err != nil {
+		if errors.Is(err, types.IterateDone) {
+			err = fs.ErrNotExist
+		}
+		return nil, &fs.PathError{Op: op, Path: name, Err: formatError(err)}
+	}
+	return newDirInfo(path.Base(name)), nil
+}
+
+// readDir lists the direct children of name sorted by file name.
+func (f *FS) readDir(name string) ([]fs.DirEntry, error) {
+	prefix := f.dirKey(name)
+
+	it, err := f.store.List(prefix, pairs.WithListMode(types.ListModeDir))
+	if err != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: formatError(err)}
+	}
+
+	seen := make(map[string]bool)
+	var entries []fs.DirEntry
+	for {
+		o, err := it.Next()
+		if err != nil && errors.Is(err, types.IterateDone) {
+			break
+		}
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: name, Err: formatError(err)}
+		}
+
+		// Services return dir paths with or without the trailing slash, and
+		// object storages may return a marker object for the dir itself.
+		rel := strings.TrimSuffix(strings.TrimPrefix(o.Path, prefix), "/")
+		if rel == "" || strings.Contains(rel, "/") || seen[rel] {
+			continue
+		}
+		seen[rel] = true
+
+		if o.Mode.IsDir() {
+			entries = append(entries, newDirInfo(rel))
+			continue
+		}
+		entries = append(entries, &dirEntry{fsys: f, name: path.Join(name, rel), o: o})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// readDirFS hides FS.Glob so that fs.Glob falls back to ReadDir.
+type readDirFS struct {
+	f *FS
+}
+
+func (r readDirFS) Open(name string) (fs.File, error) {
+	return r.f.Open(name)
+}
+
+func (r readDirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return r.f.ReadDir(name)
+}
+
+var (
+	errIsDir  = errors.New("is a directory")
+	errNotDir = errors.New("not a directory")
+)
+
+// formatError maps storager errors to their io/fs counterparts so that
+// callers can use errors.Is(err, fs.ErrNotExist).
+func formatError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrObjectNotExist):
+		return fs.ErrNotExist
+	case errors.Is(err, services.ErrPermissionDenied):
+		return fs.ErrPermission
+	default:
+		return err
+	}
+}
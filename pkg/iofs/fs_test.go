@@ -0,0 +1,255 @@
+//go:build go1.16
+// +build go1.16
+
+package iofs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	fs "go.beyondstorage.io/services/fs/v4"
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+// files are written to every tested storager, "empty" is an empty dir.
+var files = map[string]string{
+	"a.txt":         "hello",
+	"b/c.txt":       "world",
+	"b/d/e.txt":     strings.Repeat("0123456789", 1000),
+	"b/d/f.txt":     "",
+	"g/h/i/j.txt":   "deep",
+	"g/k.txt":       "k",
+	"z.txt":         "last",
+	"b/d/.hidden":   "hidden",
+	"b/space x.txt": "space",
+}
+
+func expected() []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestFSOnFs(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "empty"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := fs.NewStorager(pairs.WithWorkDir(dir + "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(New(store), append(expected(), "empty")...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFSOnMemory(t *testing.T) {
+	store := newMemory()
+	for name, content := range files {
+		if _, err := store.Write(name, strings.NewReader(content), int64(len(content))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fsys := New(store)
+	if err := fstest.TestFS(fsys, expected()...); err != nil {
+		t.Fatal(err)
+	}
+
+	sub, err := fsys.Sub("b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(sub, "c.txt", "d/e.txt", "d/f.txt", "d/.hidden", "space x.txt"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// memory is an in-memory storager without native dirs, like an object
+// storage: dirs only exist as prefixes of objects.
+type memory struct {
+	types.UnimplementedStorager
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	modTime time.Time
+}
+
+func newMemory() *memory {
+	return &memory{
+		objects: make(map[string][]byte),
+		modTime: time.Now().Truncate(time.Second),
+	}
+}
+
+func (m *memory) String() string {
+	return "memory"
+}
+
+func (m *memory) Metadata(pairs ...types.Pair) *types.StorageMeta {
+	return &types.StorageMeta{Name: "memory", WorkDir: "/"}
+}
+
+func (m *memory) Create(path string, pairs ...types.Pair) *types.Object {
+	o := types.NewObject(m, false)
+	o.ID = path
+	o.Path = path
+	return o
+}
+
+func (m *memory) object(path string, size int64) *types.Object {
+	o := types.NewObject(m, true)
+	o.ID = path
+	o.Path = path
+	o.Mode = types.ModeRead
+	o.SetContentLength(size)
+	o.SetLastModified(m.modTime)
+	return o
+}
+
+func (m *memory) Delete(path string, pairs ...types.Pair) error {
+	return m.DeleteWithContext(context.Background(), path, pairs...)
+}
+
+func (m *memory) DeleteWithContext(ctx context.Context, path string, pairs ...types.Pair) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.objects, path)
+	return nil
+}
+
+func (m *memory) List(path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	return m.ListWithContext(context.Background(), path, pairs...)
+}
+
+// ListWithContext only supports types.ListModeDir.
+func (m *memory) ListWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var objects []*types.Object
+	for p, content := range m.objects {
+		if !strings.HasPrefix(p, path) {
+			continue
+		}
+		rel := strings.TrimPrefix(p, path)
+		if i := strings.Index(rel, "/"); i >= 0 {
+			dir := path + rel[:i+1]
+			if !seen[dir] {
+				seen[dir] = true
+				o := types.NewObject(m, true)
+				o.ID = dir
+				o.Path = dir
+				o.Mode = types.ModeDir
+				objects = append(objects, o)
+			}
+			continue
+		}
+		objects = append(objects, m.object(p, int64(len(content))))
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Path < objects[j].Path
+	})
+
+	next := func(ctx context.Context, page *types.ObjectPage) error {
+		page.Data = append(page.Data, objects...)
+		objects = nil
+		return types.IterateDone
+	}
+	return types.NewObjectIterator(ctx, next, listStatus{}), nil
+}
+
+type listStatus struct{}
+
+func (listStatus) ContinuationToken() string { return "" }
+
+func (m *memory) Read(path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	return m.ReadWithContext(context.Background(), path, w, pairs...)
+}
+
+func (m *memory) ReadWithContext(ctx context.Context, path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	m.mu.Lock()
+	content, ok := m.objects[path]
+	m.mu.Unlock()
+	if !ok {
+		return 0, services.ErrObjectNotExist
+	}
+
+	var offset int64
+	size := int64(-1)
+	for _, p := range pairs {
+		switch p.Key {
+		case "offset":
+			offset = p.Value.(int64)
+		case "size":
+			size = p.Value.(int64)
+		}
+	}
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	content = content[offset:]
+	if size >= 0 && size < int64(len(content)) {
+		content = content[:size]
+	}
+	return io.Copy(w, bytes.NewReader(content))
+}
+
+func (m *memory) Stat(path string, pairs ...types.Pair) (*types.Object, error) {
+	return m.StatWithContext(context.Background(), path, pairs...)
+}
+
+func (m *memory) StatWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.Object, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	content, ok := m.objects[path]
+	if !ok {
+		return nil, services.ErrObjectNotExist
+	}
+	return m.object(path, int64(len(content))), nil
+}
+
+func (m *memory) Write(path string, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	return m.WriteWithContext(context.Background(), path, r, size, pairs...)
+}
+
+func (m *memory) WriteWithContext(ctx context.Context, path string, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	content, err := ioutil.ReadAll(io.LimitReader(r, size))
+	if err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.objects[path] = content
+	return int64(len(content)), nil
+}
@@ -0,0 +1,88 @@
+//go:build go1.16
+// +build go1.16
+
+package iofs
+
+import (
+	"io/fs"
+	"path"
+	"time"
+
+	"go.beyondstorage.io/v5/types"
+)
+
+const (
+	fileMode = 0o444
+	dirMode  = fs.ModeDir | 0o555
+)
+
+// fileInfo implements both fs.FileInfo and fs.DirEntry.
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	sys     interface{}
+}
+
+// newDirInfo returns the info of a directory.
+//
+// Most services don't keep any metadata for directories, so the ModTime is
+// always the zero time. Using the same value for real and virtual dirs keeps
+// Stat and ReadDir consistent with each other.
+func newDirInfo(name string) *fileInfo {
+	return &fileInfo{name: name, mode: dirMode}
+}
+
+func newFileInfo(name string, o *types.Object) *fileInfo {
+	if o.Mode.IsDir() {
+		fi := newDirInfo(name)
+		fi.sys = o
+		return fi
+	}
+
+	fi := &fileInfo{name: name, mode: fileMode, sys: o}
+	if v, ok := o.GetContentLength(); ok {
+		fi.size = v
+	}
+	if v, ok := o.GetLastModified(); ok {
+		fi.modTime = v
+	}
+	return fi
+}
+
+func (fi *fileInfo) Name() string               { return fi.name }
+func (fi *fileInfo) Size() int64                { return fi.size }
+func (fi *fileInfo) Mode() fs.FileMode          { return fi.mode }
+func (fi *fileInfo) ModTime() time.Time         { return fi.modTime }
+func (fi *fileInfo) IsDir() bool                { return fi.mode.IsDir() }
+func (fi *fileInfo) Sys() interface{}           { return fi.sys }
+func (fi *fileInfo) Type() fs.FileMode          { return fi.mode.Type() }
+func (fi *fileInfo) Info() (fs.FileInfo, error) { return fi, nil }
+
+// dirEntry is a file entry returned by List.
+//
+// Listed objects may miss metadata that Stat would return, Info falls back to
+// Stat in that case so that it always agrees with FS.Stat.
+type dirEntry struct {
+	fsys *FS
+	name string
+	o    *types.Object
+}
+
+func (e *dirEntry) Name() string      { return e.info().name }
+func (e *dirEntry) IsDir() bool       { return false }
+func (e *dirEntry) Type() fs.FileMode { return 0 }
+
+func (e *dirEntry) Info() (fs.FileInfo, error) {
+	_, hasSize := e.o.GetContentLength()
+	_, hasTime := e.o.GetLastModified()
+	if hasSize && hasTime {
+		return e.info(), nil
+	}
+	return e.fsys.Stat(e.name)
+}
+
+func (e *dirEntry) info() *fileInfo {
+	return newFileInfo(path.Base(e.name), e.o)
+}
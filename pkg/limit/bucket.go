@@ -0,0 +1,118 @@
+package limit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Bucket is a token bucket, safe for concurrent use. A Bucket can be shared
+// by several Storagers to limit them together.
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket creates a Bucket refilled with rate tokens per second, holding
+// up to burst tokens. A rate <= 0 doesn't limit.
+//
+// For bytes, a burst of about a second of rate keeps streams smooth.
+func NewBucket(rate float64, burst int64) *Bucket {
+	b := &Bucket{last: time.Now()}
+	b.SetLimit(rate, burst)
+	b.tokens = float64(b.burst)
+	return b
+}
+
+// SetLimit changes the rate and burst, it applies to the next waits.
+func (b *Bucket) SetLimit(rate float64, burst int64) {
+	if burst <= 0 {
+		burst = 1
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	b.rate = rate
+	b.burst = burst
+	if b.tokens > float64(burst) {
+		b.tokens = float64(burst)
+	}
+}
+
+// Limit returns the rate and burst.
+func (b *Bucket) Limit() (float64, int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.rate, b.burst
+}
+
+// Wait blocks until n tokens are taken, or ctx is done. n larger than the
+// burst is taken in several rounds.
+func (b *Bucket) Wait(ctx context.Context, n int64) error {
+	for n > 0 {
+		b.mu.Lock()
+		take := n
+		if take > b.burst {
+			take = b.burst
+		}
+		d := b.reserve(time.Now(), take)
+		b.mu.Unlock()
+
+		if err := sleep(ctx, d); err != nil {
+			b.mu.Lock()
+			b.tokens += float64(take)
+			b.mu.Unlock()
+			return err
+		}
+		n -= take
+	}
+	return nil
+}
+
+// reserve takes n tokens, and returns how long until they're available.
+// Tokens go negative, so that waiters are served in order.
+func (b *Bucket) reserve(now time.Time, n int64) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+	b.refill(now)
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(-b.tokens / b.rate * float64(time.Second)))
+}
+
+func (b *Bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last)
+	b.last = now
+	if b.rate <= 0 {
+		b.tokens = float64(b.burst)
+		return
+	}
+	if elapsed > 0 {
+		b.tokens = math.Min(float64(b.burst), b.tokens+elapsed.Seconds()*b.rate)
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
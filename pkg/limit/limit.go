@@ -0,0 +1,171 @@
+// Package limit limits the bandwidth and the request rate of storagers.
+//
+// Limits are token buckets: bytes are taken from a Bucket while streaming,
+// and an operation takes one token before it's sent. The same Bucket can be
+// given to several Storagers to share a limit, and adjusted at runtime with
+// Bucket.SetLimit.
+package limit
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.beyondstorage.io/v5/types"
+)
+
+// Operation types in Limits.Ops.
+const (
+	OpRead   = "read"
+	OpWrite  = "write"
+	OpStat   = "stat"
+	OpDelete = "delete"
+	OpList   = "list"
+)
+
+// Limits are the buckets a Storager takes tokens from. Nil buckets don't
+// limit.
+type Limits struct {
+	// ReadBytes limits the bytes of Read, WriteBytes the bytes of Write.
+	// Give the same Bucket to limit both together.
+	ReadBytes  *Bucket
+	WriteBytes *Bucket
+	// Ops limits the operations per second by type, like OpWrite.
+	Ops map[string]*Bucket
+	// AllOps limits the operations per second of all types.
+	AllOps *Bucket
+}
+
+// Storager is a types.Storager limited by Limits.
+type Storager struct {
+	types.UnimplementedStorager
+
+	store  types.Storager
+	limits Limits
+}
+
+// New wraps store with limits.
+func New(store types.Storager, limits Limits) *Storager {
+	return &Storager{store: store, limits: limits}
+}
+
+// op takes a token of the operation type.
+func (s *Storager) op(ctx context.Context, op string) error {
+	if b := s.limits.Ops[op]; b != nil {
+		if err := b.Wait(ctx, 1); err != nil {
+			return fmt.Errorf("limit %s: %w", op, err)
+		}
+	}
+	if b := s.limits.AllOps; b != nil {
+		if err := b.Wait(ctx, 1); err != nil {
+			return fmt.Errorf("limit %s: %w", op, err)
+		}
+	}
+	return nil
+}
+
+func (s *Storager) String() string {
+	return fmt.Sprintf("Limit {%s}", s.store)
+}
+
+func (s *Storager) Metadata(pairs ...types.Pair) *types.StorageMeta {
+	return s.store.Metadata(pairs...)
+}
+
+func (s *Storager) Create(path string, pairs ...types.Pair) *types.Object {
+	return s.store.Create(path, pairs...)
+}
+
+func (s *Storager) Read(path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	return s.ReadWithContext(context.Background(), path, w, pairs...)
+}
+
+func (s *Storager) ReadWithContext(ctx context.Context, path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	if err := s.op(ctx, OpRead); err != nil {
+		return 0, err
+	}
+	if b := s.limits.ReadBytes; b != nil {
+		w = &writer{ctx: ctx, w: w, b: b}
+	}
+	return s.store.ReadWithContext(ctx, path, w, pairs...)
+}
+
+func (s *Storager) Write(path string, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	return s.WriteWithContext(context.Background(), path, r, size, pairs...)
+}
+
+func (s *Storager) WriteWithContext(ctx context.Context, path string, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	if err := s.op(ctx, OpWrite); err != nil {
+		return 0, err
+	}
+	if b := s.limits.WriteBytes; b != nil {
+		r = &reader{ctx: ctx, r: r, b: b}
+	}
+	return s.store.WriteWithContext(ctx, path, r, size, pairs...)
+}
+
+func (s *Storager) Stat(path string, pairs ...types.Pair) (*types.Object, error) {
+	return s.StatWithContext(context.Background(), path, pairs...)
+}
+
+func (s *Storager) StatWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.Object, error) {
+	if err := s.op(ctx, OpStat); err != nil {
+		return nil, err
+	}
+	return s.store.StatWithContext(ctx, path, pairs...)
+}
+
+func (s *Storager) Delete(path string, pairs ...types.Pair) error {
+	return s.DeleteWithContext(context.Background(), path, pairs...)
+}
+
+func (s *Storager) DeleteWithContext(ctx context.Context, path string, pairs ...types.Pair) error {
+	if err := s.op(ctx, OpDelete); err != nil {
+		return err
+	}
+	return s.store.DeleteWithContext(ctx, path, pairs...)
+}
+
+func (s *Storager) List(path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	return s.ListWithContext(context.Background(), path, pairs...)
+}
+
+// ListWithContext takes a token when listing starts, the pages fetched by
+// the iterator are not limited.
+func (s *Storager) ListWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	if err := s.op(ctx, OpList); err != nil {
+		return nil, err
+	}
+	return s.store.ListWithContext(ctx, path, pairs...)
+}
+
+// reader takes a token per byte read.
+type reader struct {
+	ctx context.Context
+	r   io.Reader
+	b   *Bucket
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if werr := r.b.Wait(r.ctx, int64(n)); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// writer takes a token per byte before writing it.
+type writer struct {
+	ctx context.Context
+	w   io.Writer
+	b   *Bucket
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if err := w.b.Wait(w.ctx, int64(len(p))); err != nil {
+		return 0, err
+	}
+	return w.w.Write(p)
+}
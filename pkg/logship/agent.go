@@ -0,0 +1,342 @@
+// Package logship tails local log files, and ships new lines to append
+// objects.
+//
+// Every file is shipped to its own object, which is rolled over to a new
+// one by size or age, and committed by CommitAppend. Progress is kept in a
+// checkpoint file. On restart, the length of the remote object is compared
+// to the checkpoint, so data appended just before a crash is not shipped
+// again.
+package logship
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+const (
+	defaultPollInterval  = time.Second
+	defaultMaxObjectSize = 64 * 1024 * 1024
+	defaultMaxObjectAge  = time.Hour
+	defaultMaxChunk      = 1024 * 1024
+)
+
+// Options configures an Agent.
+type Options struct {
+	// Files are the local files to tail.
+	Files []string
+	// Checkpoint is the local file keeping the progress.
+	Checkpoint string
+	// Name returns the name of a new object for file, default to
+	// <base of file>/<time>.log.
+	Name func(file string, t time.Time) string
+	// PollInterval is the delay between checks of the files, default
+	// to 1s.
+	PollInterval time.Duration
+	// MaxObjectSize and MaxObjectAge roll over to a new object, default
+	// to 64 MiB and 1h.
+	MaxObjectSize int64
+	MaxObjectAge  time.Duration
+	// MaxChunk is the largest WriteAppend, default to 1 MiB.
+	MaxChunk int
+	// ErrorLog logs failures, default to discard.
+	ErrorLog func(format string, v ...interface{})
+}
+
+// State is the progress of a file in the checkpoint.
+type State struct {
+	// Fingerprint identifies the file by the CRC-32 of its first
+	// FingerprintSize bytes, so that a file replaced while the agent was
+	// down is detected.
+	Fingerprint     uint32 `json:"fingerprint"`
+	FingerprintSize int64  `json:"fingerprint_size"`
+	// Offset is the position shipped in the file.
+	Offset int64 `json:"offset"`
+	// Object is the object being appended, empty if none.
+	Object        string    `json:"object,omitempty"`
+	ObjectOffset  int64     `json:"object_offset"`
+	ObjectCreated time.Time `json:"object_created"`
+}
+
+// Agent ships files to a storager implementing types.Appender.
+type Agent struct {
+	store types.Storager
+	a     types.Appender
+	opts  Options
+
+	mu      sync.Mutex
+	sources []*source
+	states  map[string]*State
+}
+
+// New creates an Agent, and loads the checkpoint.
+func New(store types.Storager, opts Options) (*Agent, error) {
+	a, ok := store.(types.Appender)
+	if !ok {
+		return nil, fmt.Errorf("logship: %s: %w", store, services.ErrCapabilityInsufficient)
+	}
+	if opts.Checkpoint == "" {
+		return nil, errors.New("logship: no checkpoint")
+	}
+	if opts.Name == nil {
+		opts.Name = defaultName
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = defaultPollInterval
+	}
+	if opts.MaxObjectSize <= 0 {
+		opts.MaxObjectSize = defaultMaxObjectSize
+	}
+	if opts.MaxObjectAge <= 0 {
+		opts.MaxObjectAge = defaultMaxObjectAge
+	}
+	if opts.MaxChunk <= 0 {
+		opts.MaxChunk = defaultMaxChunk
+	}
+	if opts.ErrorLog == nil {
+		opts.ErrorLog = func(string, ...interface{}) {}
+	}
+
+	ag := &Agent{store: store, a: a, opts: opts, states: make(map[string]*State)}
+	if err := ag.load(); err != nil {
+		return nil, fmt.Errorf("logship: load checkpoint: %w", err)
+	}
+	for _, file := range opts.Files {
+		st, ok := ag.states[file]
+		if !ok {
+			st = &State{}
+			ag.states[file] = st
+		}
+		ag.sources = append(ag.sources, &source{path: file, state: st})
+	}
+	return ag, nil
+}
+
+func defaultName(file string, t time.Time) string {
+	return path.Join(filepath.Base(file), t.UTC().Format("20060102T150405.000000000Z")+".log")
+}
+
+// States returns a copy of the progress of all files.
+func (ag *Agent) States() map[string]State {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+
+	m := make(map[string]State, len(ag.states))
+	for file, st := range ag.states {
+		m[file] = *st
+	}
+	return m
+}
+
+// Run polls the files until ctx is done. The current objects are not
+// committed, they're appended again after restart. Use Flush to commit them.
+func (ag *Agent) Run(ctx context.Context) error {
+	t := time.NewTicker(ag.opts.PollInterval)
+	defer t.Stop()
+
+	for {
+		if err := ag.Poll(ctx); err != nil && ctx.Err() == nil {
+			ag.opts.ErrorLog("logship: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			ag.close()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Poll ships the new lines of all files once.
+func (ag *Agent) Poll(ctx context.Context) error {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+
+	var first error
+	for _, src := range ag.sources {
+		if err := ag.poll(ctx, src); err != nil {
+			ag.opts.ErrorLog("logship: %s: %v", src.path, err)
+			if first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// Flush commits the current objects of all files, new lines go to new
+// objects.
+func (ag *Agent) Flush(ctx context.Context) error {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+
+	var first error
+	for _, src := range ag.sources {
+		if err := ag.roll(ctx, src); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (ag *Agent) close() {
+	ag.mu.Lock()
+	defer ag.mu.Unlock()
+
+	for _, src := range ag.sources {
+		src.close()
+	}
+}
+
+// ship appends chunk, read at src.state.Offset, to the object of src.
+func (ag *Agent) ship(ctx context.Context, src *source, chunk []byte) error {
+	st := src.state
+	if st.Object != "" && st.ObjectOffset+int64(len(chunk)) > ag.opts.MaxObjectSize && st.ObjectOffset > 0 {
+		if err := ag.roll(ctx, src); err != nil {
+			return err
+		}
+	}
+	if st.Object == "" {
+		if err := ag.create(ctx, src); err != nil {
+			return err
+		}
+	}
+
+	src.o.SetAppendOffset(st.ObjectOffset)
+	_, err := ag.a.WriteAppendWithContext(ctx, src.o, bytes.NewReader(chunk), int64(len(chunk)))
+	if err != nil {
+		// A part of the chunk may have landed.
+		if rerr := ag.reconcile(ctx, src); rerr != nil {
+			ag.opts.ErrorLog("logship: %s: %v", src.path, rerr)
+		}
+		return fmt.Errorf("append to %s: %w", st.Object, err)
+	}
+
+	st.Offset += int64(len(chunk))
+	st.ObjectOffset += int64(len(chunk))
+	return ag.save()
+}
+
+// create starts a new object.
+func (ag *Agent) create(ctx context.Context, src *source) error {
+	now := time.Now()
+	name := ag.opts.Name(src.path, now)
+	o, err := ag.a.CreateAppendWithContext(ctx, name)
+	if err != nil {
+		return fmt.Errorf("create append %s: %w", name, err)
+	}
+
+	src.o = o
+	src.state.Object = name
+	src.state.ObjectOffset = 0
+	src.state.ObjectCreated = now
+	return ag.save()
+}
+
+// roll commits the object of src, the next lines go to a new object.
+func (ag *Agent) roll(ctx context.Context, src *source) error {
+	st := src.state
+	if st.Object == "" {
+		return nil
+	}
+	if src.o == nil {
+		if err := ag.reconcile(ctx, src); err != nil {
+			return err
+		}
+		if st.Object == "" {
+			return nil
+		}
+	}
+	if err := ag.a.CommitAppendWithContext(ctx, src.o); err != nil {
+		return fmt.Errorf("commit append %s: %w", st.Object, err)
+	}
+
+	src.o = nil
+	st.Object = ""
+	st.ObjectOffset = 0
+	return ag.save()
+}
+
+// reconcile compares the object to the checkpoint. Bytes found in the
+// object beyond the checkpoint have been shipped, and are skipped in the
+// file. If the object is gone or shorter, a new object is started.
+func (ag *Agent) reconcile(ctx context.Context, src *source) error {
+	st := src.state
+	o, err := ag.store.StatWithContext(ctx, st.Object)
+	if err != nil && errors.Is(err, services.ErrObjectNotExist) {
+		ag.opts.ErrorLog("logship: %s is gone, starting a new object", st.Object)
+		src.o, st.Object, st.ObjectOffset = nil, "", 0
+		return ag.save()
+	}
+	if err != nil {
+		return err
+	}
+
+	length, ok := o.GetAppendOffset()
+	if !ok {
+		length, _ = o.GetContentLength()
+	}
+	switch {
+	case length < st.ObjectOffset:
+		ag.opts.ErrorLog("logship: %s has %d bytes, expected %d, starting a new object", st.Object, length, st.ObjectOffset)
+		src.o, st.Object, st.ObjectOffset = nil, "", 0
+	case length > st.ObjectOffset:
+		st.Offset += length - st.ObjectOffset
+		st.ObjectOffset = length
+		src.o = o
+	default:
+		src.o = o
+	}
+	return ag.save()
+}
+
+func (ag *Agent) load() error {
+	content, err := ioutil.ReadFile(ag.opts.Checkpoint)
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(content, &ag.states)
+}
+
+// save writes the checkpoint atomically.
+func (ag *Agent) save() error {
+	content, err := json.MarshalIndent(ag.states, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(ag.opts.Checkpoint), filepath.Base(ag.opts.Checkpoint)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), ag.opts.Checkpoint)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return fmt.Errorf("save checkpoint: %w", err)
+	}
+	return nil
+}
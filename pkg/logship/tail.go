@@ -0,0 +1,202 @@
+package logship
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"go.beyondstorage.io/v5/types"
+)
+
+const maxFingerprintSize = 1024
+
+// source is a tailed file.
+type source struct {
+	path  string
+	state *State
+
+	// reconciled is set once the object is compared to the checkpoint.
+	reconciled bool
+	f          *os.File
+	fi         os.FileInfo
+	o          *types.Object
+}
+
+func (src *source) close() {
+	if src.f != nil {
+		src.f.Close()
+		src.f, src.fi = nil, nil
+	}
+}
+
+// reset starts shipping the file from the beginning.
+func (src *source) reset() {
+	src.state.Offset = 0
+	src.state.Fingerprint = 0
+	src.state.FingerprintSize = 0
+}
+
+// fingerprint returns the CRC-32 of the first size bytes.
+func (src *source) fingerprint(size int64) (uint32, error) {
+	buf := make([]byte, size)
+	if _, err := src.f.ReadAt(buf, 0); err != nil {
+		return 0, err
+	}
+	return crc32.ChecksumIEEE(buf), nil
+}
+
+// replaced reports whether the open file isn't the one in the checkpoint,
+// like a file truncated and written again.
+func (src *source) replaced(size int64) (bool, error) {
+	st := src.state
+	if st.FingerprintSize == 0 {
+		return false, nil
+	}
+	if size < st.FingerprintSize {
+		return true, nil
+	}
+	sum, err := src.fingerprint(st.FingerprintSize)
+	if err != nil {
+		return false, err
+	}
+	return sum != st.Fingerprint, nil
+}
+
+// updateFingerprint extends the fingerprint while the file is short.
+func (src *source) updateFingerprint(size int64) error {
+	st := src.state
+	if st.FingerprintSize >= maxFingerprintSize || size <= st.FingerprintSize {
+		return nil
+	}
+	if size > maxFingerprintSize {
+		size = maxFingerprintSize
+	}
+	sum, err := src.fingerprint(size)
+	if err != nil {
+		return err
+	}
+	st.Fingerprint, st.FingerprintSize = sum, size
+	return nil
+}
+
+func (ag *Agent) poll(ctx context.Context, src *source) error {
+	if !src.reconciled {
+		// Appends may have landed after the last checkpoint.
+		if src.state.Object != "" {
+			if err := ag.reconcile(ctx, src); err != nil {
+				return err
+			}
+		}
+		src.reconciled = true
+	}
+
+	if src.f == nil {
+		f, err := os.Open(src.path)
+		if err != nil && errors.Is(err, os.ErrNotExist) {
+			return ag.rollOld(ctx, src)
+		}
+		if err != nil {
+			return err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return err
+		}
+		src.f, src.fi = f, fi
+	}
+
+	// After a rotation, the path refers to another file. The rest of the
+	// old file is shipped, including a last line without newline.
+	fi, err := os.Stat(src.path)
+	if (err == nil && !os.SameFile(fi, src.fi)) || errors.Is(err, os.ErrNotExist) {
+		if err := ag.read(ctx, src, true); err != nil {
+			return err
+		}
+		src.close()
+		src.reset()
+		if err := ag.save(); err != nil {
+			return err
+		}
+		return ag.poll(ctx, src)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := ag.read(ctx, src, false); err != nil {
+		return err
+	}
+	return ag.rollOld(ctx, src)
+}
+
+// rollOld rolls the object over once it's older than MaxObjectAge.
+func (ag *Agent) rollOld(ctx context.Context, src *source) error {
+	st := src.state
+	if st.Object == "" || time.Since(st.ObjectCreated) < ag.opts.MaxObjectAge {
+		return nil
+	}
+	return ag.roll(ctx, src)
+}
+
+// read ships the file from the checkpoint to the last complete line, or to
+// the end if final.
+func (ag *Agent) read(ctx context.Context, src *source, final bool) error {
+	st := src.state
+	for {
+		fi, err := src.f.Stat()
+		if err != nil {
+			return err
+		}
+		size := fi.Size()
+
+		replaced, err := src.replaced(size)
+		if err != nil {
+			return err
+		}
+		if replaced || size < st.Offset {
+			ag.opts.ErrorLog("logship: %s has been truncated, shipping from the beginning", src.path)
+			src.reset()
+		}
+		if size == st.Offset {
+			return nil
+		}
+
+		n := size - st.Offset
+		if n > int64(ag.opts.MaxChunk) {
+			n = int64(ag.opts.MaxChunk)
+		}
+		chunk := make([]byte, n)
+		m, err := src.f.ReadAt(chunk, st.Offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if m == 0 {
+			return nil
+		}
+		chunk = chunk[:m]
+
+		if !final {
+			i := bytes.LastIndexByte(chunk, '\n')
+			if i < 0 && int64(m) < int64(ag.opts.MaxChunk) {
+				// Wait for the rest of the line.
+				return nil
+			}
+			// A line longer than MaxChunk is shipped in pieces.
+			if i >= 0 {
+				chunk = chunk[:i+1]
+			}
+		}
+
+		if err := src.updateFingerprint(size); err != nil {
+			return err
+		}
+		if err := ag.ship(ctx, src, chunk); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package mirror
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.beyondstorage.io/v5/types"
+)
+
+const (
+	// unhealthyAfter is the number of consecutive failures after which a
+	// replica is skipped.
+	unhealthyAfter = 3
+	// retryAfter is how long an unhealthy replica is skipped.
+	retryAfter = 30 * time.Second
+)
+
+// replica tracks the latency and health of a storager.
+type replica struct {
+	index int
+	store types.Storager
+
+	mu       sync.Mutex
+	latency  time.Duration // Moving average of successful calls.
+	failures int
+	failedAt time.Time
+}
+
+func (r *replica) observe(start time.Time, err error) {
+	d := time.Since(start)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err != nil {
+		r.failures++
+		r.failedAt = time.Now()
+		return
+	}
+	r.failures = 0
+	if r.latency == 0 {
+		r.latency = d
+	} else {
+		r.latency = (r.latency*7 + d) / 8
+	}
+}
+
+// healthy reports whether the replica should be used. An unhealthy replica
+// is tried again after retryAfter.
+func (r *replica) healthy() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.failures < unhealthyAfter || time.Since(r.failedAt) > retryAfter
+}
+
+func (r *replica) averageLatency() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.latency
+}
+
+// ordered returns healthy replicas by latency, followed by unhealthy ones as
+// a last resort. Replicas with a recorded repair for path are left out, as
+// they may be outdated, unless no replica is up to date.
+func (m *Mirror) ordered(path string) []*replica {
+	type candidate struct {
+		r       *replica
+		healthy bool
+		latency time.Duration
+	}
+	current := make([]*replica, 0, len(m.replicas))
+	for _, r := range m.replicas {
+		if !m.isStale(r.index, path) {
+			current = append(current, r)
+		}
+	}
+	if len(current) == 0 {
+		current = m.replicas
+	}
+
+	cs := make([]candidate, 0, len(current))
+	for _, r := range current {
+		cs = append(cs, candidate{r: r, healthy: r.healthy(), latency: r.averageLatency()})
+	}
+	sort.SliceStable(cs, func(i, j int) bool {
+		if cs[i].healthy != cs[j].healthy {
+			return cs[i].healthy
+		}
+		return cs[i].latency < cs[j].latency
+	})
+
+	rs := make([]*replica, 0, len(cs))
+	for _, c := range cs {
+		rs = append(rs, c.r)
+	}
+	return rs
+}
+
+// staleKey is a path on a replica.
+type staleKey struct {
+	replica int
+	path    string
+}
+
+// push records r, the replica is stale for the path until r is removed.
+func (m *Mirror) push(r Repair) error {
+	if err := m.opts.Queue.Push(r); err != nil {
+		return err
+	}
+	m.staleMu.Lock()
+	defer m.staleMu.Unlock()
+
+	m.stale[staleKey{r.Replica, r.Path}]++
+	return nil
+}
+
+// unmark forgets the repairs removed from the queue.
+func (m *Mirror) unmark(done []Repair) {
+	m.staleMu.Lock()
+	defer m.staleMu.Unlock()
+
+	for _, r := range done {
+		k := staleKey{r.Replica, r.Path}
+		if m.stale[k]--; m.stale[k] <= 0 {
+			delete(m.stale, k)
+		}
+	}
+}
+
+func (m *Mirror) isStale(replica int, path string) bool {
+	m.staleMu.Lock()
+	defer m.staleMu.Unlock()
+
+	return m.stale[staleKey{replica, path}] > 0
+}
@@ -0,0 +1,339 @@
+// Package mirror replicates writes to several storagers.
+//
+// Write and Delete are sent to all replicas concurrently and succeed once
+// Options.Quorum replicas succeeded. Replicas which failed are recorded in a
+// RepairQueue, and reconciled later by Mirror.Repair.
+//
+// Read and Stat go to the healthy replica with the lowest latency, and fall
+// back to the next replica on failure. Replicas with a recorded repair for
+// the path are skipped until it's repaired.
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+// ErrQuorum means fewer replicas than the quorum succeeded.
+var ErrQuorum = errors.New("quorum not reached")
+
+// errAllFailed is returned by fanout once no replica is receiving data.
+var errAllFailed = errors.New("all replicas failed")
+
+// Options configures a Mirror.
+type Options struct {
+	// Quorum is the number of replicas which must succeed, default to all.
+	Quorum int
+	// Queue records failed replicas, default to an in-memory queue.
+	Queue RepairQueue
+	// ErrorLog logs failed replicas, default to discard.
+	ErrorLog func(format string, v ...interface{})
+}
+
+// Mirror is a types.Storager replicating to several storagers.
+type Mirror struct {
+	types.UnimplementedStorager
+
+	replicas []*replica
+	opts     Options
+
+	staleMu sync.Mutex
+	// stale counts the recorded repairs of every replica and path.
+	stale map[staleKey]int
+}
+
+// New creates a Mirror over stores, the first store is preferred for List
+// as long as it's healthy. The repairs already in opts.Queue are loaded, so
+// that outdated replicas are not read from.
+func New(stores []types.Storager, opts Options) (*Mirror, error) {
+	if len(stores) == 0 {
+		return nil, errors.New("mirror: no storager")
+	}
+	if opts.Quorum <= 0 {
+		opts.Quorum = len(stores)
+	}
+	if opts.Quorum > len(stores) {
+		return nil, fmt.Errorf("mirror: quorum %d larger than %d storagers", opts.Quorum, len(stores))
+	}
+	if opts.Queue == nil {
+		opts.Queue = NewMemoryQueue()
+	}
+	if opts.ErrorLog == nil {
+		opts.ErrorLog = func(string, ...interface{}) {}
+	}
+
+	m := &Mirror{opts: opts, stale: make(map[staleKey]int)}
+	for i, store := range stores {
+		m.replicas = append(m.replicas, &replica{index: i, store: store})
+	}
+
+	rs, err := opts.Queue.List()
+	if err != nil {
+		return nil, fmt.Errorf("mirror: load repairs: %w", err)
+	}
+	for _, r := range rs {
+		m.stale[staleKey{r.Replica, r.Path}]++
+	}
+	return m, nil
+}
+
+// Queue returns the repair queue.
+func (m *Mirror) Queue() RepairQueue {
+	return m.opts.Queue
+}
+
+func (m *Mirror) String() string {
+	s := make([]string, 0, len(m.replicas))
+	for _, r := range m.replicas {
+		s = append(s, r.store.String())
+	}
+	return fmt.Sprintf("Mirror {Quorum: %d, Replicas: [%s]}", m.opts.Quorum, strings.Join(s, ", "))
+}
+
+func (m *Mirror) Metadata(pairs ...types.Pair) *types.StorageMeta {
+	return m.replicas[0].store.Metadata(pairs...)
+}
+
+func (m *Mirror) Create(path string, pairs ...types.Pair) *types.Object {
+	o := types.NewObject(m, false)
+	o.ID = path
+	o.Path = path
+	return o
+}
+
+func (m *Mirror) Write(path string, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	return m.WriteWithContext(context.Background(), path, r, size, pairs...)
+}
+
+// WriteWithContext streams r to all replicas at once. A replica which fails
+// stops receiving data while the others continue.
+//
+// If reading r fails, every replica has been sent part of the content, and
+// they may differ depending on the storager: a repair is recorded for all of
+// them.
+func (m *Mirror) WriteWithContext(ctx context.Context, path string, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	readers := make([]*io.PipeReader, len(m.replicas))
+	fw := &fanout{}
+	for i := range m.replicas {
+		pr, pw := io.Pipe()
+		readers[i] = pr
+		fw.writers = append(fw.writers, pw)
+	}
+
+	errs := make([]error, len(m.replicas))
+	var wg sync.WaitGroup
+	for i, rep := range m.replicas {
+		wg.Add(1)
+		go func(i int, rep *replica) {
+			defer wg.Done()
+
+			start := time.Now()
+			_, err := rep.store.WriteWithContext(ctx, path, readers[i], size, pairs...)
+			if err == nil {
+				// Drain what the storager didn't read, so that the
+				// others won't be blocked.
+				_, _ = io.Copy(ioutil.Discard, readers[i])
+			}
+			readers[i].CloseWithError(fmt.Errorf("replica %d: closed", i))
+			rep.observe(start, err)
+			errs[i] = err
+		}(i, rep)
+	}
+
+	n, err := io.Copy(fw, io.LimitReader(r, size))
+	if err == nil && n < size {
+		err = io.ErrUnexpectedEOF
+	}
+	fw.close(err)
+	wg.Wait()
+
+	if err != nil && !errors.Is(err, errAllFailed) {
+		// The source failed, all replicas got incomplete data.
+		for i := range m.replicas {
+			m.record(OpWrite, path, i, fmt.Errorf("read source: %w", err))
+		}
+		return n, err
+	}
+	return n, m.settle(OpWrite, path, errs, false)
+}
+
+func (m *Mirror) Delete(path string, pairs ...types.Pair) error {
+	return m.DeleteWithContext(context.Background(), path, pairs...)
+}
+
+// DeleteWithContext deletes path from all replicas. A replica without the
+// object counts as success.
+func (m *Mirror) DeleteWithContext(ctx context.Context, path string, pairs ...types.Pair) error {
+	errs := make([]error, len(m.replicas))
+	var wg sync.WaitGroup
+	for i, rep := range m.replicas {
+		wg.Add(1)
+		go func(i int, rep *replica) {
+			defer wg.Done()
+
+			start := time.Now()
+			err := rep.store.DeleteWithContext(ctx, path, pairs...)
+			rep.observe(start, err)
+			errs[i] = err
+		}(i, rep)
+	}
+	wg.Wait()
+
+	return m.settle(OpDelete, path, errs, true)
+}
+
+// settle records failed replicas and checks the quorum.
+func (m *Mirror) settle(op, path string, errs []error, notExistOK bool) error {
+	ok := 0
+	var first error
+	for i, err := range errs {
+		if err == nil || (notExistOK && errors.Is(err, services.ErrObjectNotExist)) {
+			ok++
+			continue
+		}
+		if first == nil {
+			first = err
+		}
+
+		m.record(op, path, i, err)
+	}
+
+	if ok < m.opts.Quorum {
+		return fmt.Errorf("%s %s: %d of %d replicas succeeded: %w: %v", op, path, ok, len(errs), ErrQuorum, first)
+	}
+	return nil
+}
+
+// record logs the failure of replica i, and queues its repair.
+func (m *Mirror) record(op, path string, i int, err error) {
+	m.opts.ErrorLog("mirror: %s %s on replica %d (%s): %v", op, path, i, m.replicas[i].store, err)
+	qerr := m.push(Repair{
+		Replica: i,
+		Op:      op,
+		Path:    path,
+		Error:   err.Error(),
+		Time:    time.Now(),
+	})
+	if qerr != nil {
+		m.opts.ErrorLog("mirror: record repair of %s: %v", path, qerr)
+	}
+}
+
+func (m *Mirror) Read(path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	return m.ReadWithContext(context.Background(), path, w, pairs...)
+}
+
+// ReadWithContext reads from the fastest healthy replica. The next replica is
+// tried if a replica fails before anything has been written to w.
+func (m *Mirror) ReadWithContext(ctx context.Context, path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	var err error
+	for _, rep := range m.ordered(path) {
+		cw := &countWriter{w: w}
+
+		start := time.Now()
+		var n int64
+		n, err = rep.store.ReadWithContext(ctx, path, cw, pairs...)
+		rep.observe(start, notExistOK(err))
+		if err == nil || cw.n > 0 || ctx.Err() != nil {
+			return n, err
+		}
+	}
+	return 0, err
+}
+
+func (m *Mirror) Stat(path string, pairs ...types.Pair) (*types.Object, error) {
+	return m.StatWithContext(context.Background(), path, pairs...)
+}
+
+func (m *Mirror) StatWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.Object, error) {
+	var err error
+	for _, rep := range m.ordered(path) {
+		start := time.Now()
+		var o *types.Object
+		o, err = rep.store.StatWithContext(ctx, path, pairs...)
+		rep.observe(start, notExistOK(err))
+		if err == nil || ctx.Err() != nil {
+			return o, err
+		}
+	}
+	return nil, err
+}
+
+func (m *Mirror) List(path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	return m.ListWithContext(context.Background(), path, pairs...)
+}
+
+// ListWithContext lists the first healthy replica in the order given to New,
+// so that paging is stable.
+func (m *Mirror) ListWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	var err error
+	for _, rep := range m.replicas {
+		if !rep.healthy() {
+			continue
+		}
+		var it *types.ObjectIterator
+		it, err = rep.store.ListWithContext(ctx, path, pairs...)
+		if err == nil {
+			return it, nil
+		}
+	}
+	if err == nil {
+		// No healthy replica, try the first one anyway.
+		return m.replicas[0].store.ListWithContext(ctx, path, pairs...)
+	}
+	return nil, err
+}
+
+// notExistOK treats a missing object as a healthy response.
+func notExistOK(err error) error {
+	if errors.Is(err, services.ErrObjectNotExist) {
+		return nil
+	}
+	return err
+}
+
+// fanout writes to all writers, dropping the writers which failed.
+type fanout struct {
+	writers []*io.PipeWriter
+}
+
+func (f *fanout) Write(p []byte) (int, error) {
+	alive := f.writers[:0]
+	for _, w := range f.writers {
+		if _, err := w.Write(p); err != nil {
+			continue
+		}
+		alive = append(alive, w)
+	}
+	f.writers = alive
+	if len(alive) == 0 {
+		return 0, errAllFailed
+	}
+	return len(p), nil
+}
+
+func (f *fanout) close(err error) {
+	for _, w := range f.writers {
+		w.CloseWithError(err)
+	}
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,337 @@
+package mirror
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.beyondstorage.io/v5/services"
+)
+
+// Operations recorded in Repair.
+const (
+	OpWrite  = "write"
+	OpDelete = "delete"
+)
+
+// Repair records a replica which failed an operation.
+type Repair struct {
+	// Replica is the index of the storager given to New.
+	Replica int       `json:"replica"`
+	Op      string    `json:"op"`
+	Path    string    `json:"path"`
+	Error   string    `json:"error"`
+	Time    time.Time `json:"time"`
+}
+
+// RepairQueue records repairs until they are reconciled.
+type RepairQueue interface {
+	Push(r Repair) error
+	// List returns all recorded repairs, oldest first.
+	List() ([]Repair, error)
+	// Remove removes repairs returned by List once they're reconciled.
+	// Repairs pushed since List are kept.
+	Remove(done []Repair) error
+}
+
+// sameRepair reports whether a and b are the same record.
+func sameRepair(a, b Repair) bool {
+	return a.Replica == b.Replica && a.Op == b.Op && a.Path == b.Path &&
+		a.Error == b.Error && a.Time.Equal(b.Time)
+}
+
+// without returns rs without the repairs in done, every repair in done
+// removes one record.
+func without(rs, done []Repair) []Repair {
+	done = append([]Repair(nil), done...)
+	kept := rs[:0:0]
+	for _, r := range rs {
+		matched := false
+		for i, d := range done {
+			if sameRepair(r, d) {
+				done = append(done[:i], done[i+1:]...)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			kept = append(kept, r)
+		}
+	}
+	return kept
+}
+
+// MemoryQueue is a RepairQueue in memory, repairs are lost on restart.
+type MemoryQueue struct {
+	mu      sync.Mutex
+	repairs []Repair
+}
+
+// NewMemoryQueue creates a MemoryQueue.
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{}
+}
+
+// Push implements RepairQueue.
+func (q *MemoryQueue) Push(r Repair) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.repairs = append(q.repairs, r)
+	return nil
+}
+
+// List implements RepairQueue.
+func (q *MemoryQueue) List() ([]Repair, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return append([]Repair(nil), q.repairs...), nil
+}
+
+// Remove implements RepairQueue.
+func (q *MemoryQueue) Remove(done []Repair) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.repairs = without(q.repairs, done)
+	return nil
+}
+
+// Len returns the number of recorded repairs.
+func (q *MemoryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return len(q.repairs)
+}
+
+// FileQueue is a RepairQueue appending JSON lines to a local file, so that
+// repairs survive restarts.
+type FileQueue struct {
+	path string
+
+	mu sync.Mutex
+}
+
+// NewFileQueue creates a FileQueue at path, the file is created on first
+// Push.
+func NewFileQueue(path string) *FileQueue {
+	return &FileQueue{path: path}
+}
+
+// Push implements RepairQueue.
+func (q *FileQueue) Push(r Repair) error {
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	f, err := os.OpenFile(q.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// List implements RepairQueue. Lines which can't be parsed, like a line
+// truncated by a crash, are skipped.
+func (q *FileQueue) List() ([]Repair, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.read()
+}
+
+// Remove implements RepairQueue. The remaining repairs are written to a
+// temporary file which replaces the queue, so that a crash leaves either the
+// old or the new queue.
+func (q *FileQueue) Remove(done []Repair) error {
+	if len(done) == 0 {
+		return nil
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	rs, err := q.read()
+	if err != nil {
+		return err
+	}
+	rs = without(rs, done)
+
+	var buf bytes.Buffer
+	for _, r := range rs {
+		line, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		buf.Write(append(line, '\n'))
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(q.path), filepath.Base(q.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), q.path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+func (q *FileQueue) read() ([]Repair, error) {
+	f, err := os.Open(q.path)
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rs []Repair
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var r Repair
+		if json.Unmarshal(s.Bytes(), &r) == nil {
+			rs = append(rs, r)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// Repair reconciles the replicas recorded in the queue.
+//
+// Whatever the failed operation was, the replica is made the same as the
+// other replicas: the object is copied from a replica which has it, or
+// deleted if no other replica has it. Repairs are removed from the queue
+// once they succeeded, failed ones are recorded again with their new error.
+func (m *Mirror) Repair(ctx context.Context) (int, error) {
+	rs, err := m.opts.Queue.List()
+	if err != nil {
+		return 0, err
+	}
+
+	byKey := make(map[staleKey][]Repair)
+	var keys []staleKey
+	var done []Repair
+	for _, r := range rs {
+		if r.Replica < 0 || r.Replica >= len(m.replicas) {
+			done = append(done, r)
+			continue
+		}
+		k := staleKey{r.Replica, r.Path}
+		if byKey[k] == nil {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], r)
+	}
+
+	repaired := 0
+	var first error
+	for _, k := range keys {
+		recorded := byKey[k]
+		err := m.repair(ctx, m.replicas[k.replica], k.path)
+		if err == nil {
+			repaired++
+			done = append(done, recorded...)
+			continue
+		}
+		if first == nil {
+			first = err
+		}
+		m.opts.ErrorLog("mirror: repair %s on replica %d: %v", k.path, k.replica, err)
+
+		// Replace the records by one with the new error, they're kept if it
+		// can't be recorded.
+		r := recorded[len(recorded)-1]
+		r.Error, r.Time = err.Error(), time.Now()
+		if qerr := m.push(r); qerr != nil {
+			m.opts.ErrorLog("mirror: record repair of %s: %v", r.Path, qerr)
+			continue
+		}
+		done = append(done, recorded...)
+	}
+
+	if err := m.opts.Queue.Remove(done); err != nil {
+		return repaired, err
+	}
+	m.unmark(done)
+	return repaired, first
+}
+
+func (m *Mirror) repair(ctx context.Context, target *replica, path string) error {
+	var src *replica
+	var size int64
+	var statErr error
+	for _, rep := range m.ordered(path) {
+		if rep == target {
+			continue
+		}
+		o, err := rep.store.StatWithContext(ctx, path)
+		if err != nil && errors.Is(err, services.ErrObjectNotExist) {
+			continue
+		}
+		if err != nil {
+			statErr = fmt.Errorf("stat on replica %d: %w", rep.index, err)
+			continue
+		}
+		n, ok := o.GetContentLength()
+		if !ok {
+			statErr = fmt.Errorf("stat on replica %d: no content length", rep.index)
+			continue
+		}
+		src, size = rep, n
+		break
+	}
+
+	if src == nil && statErr != nil {
+		// Unknown state, the object may only exist on the failed replica.
+		return statErr
+	}
+	if src == nil {
+		err := target.store.DeleteWithContext(ctx, path)
+		if err != nil && !errors.Is(err, services.ErrObjectNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := src.store.ReadWithContext(ctx, path, pw)
+		pw.CloseWithError(err)
+	}()
+	_, err := target.store.WriteWithContext(ctx, path, pr, size)
+	pr.CloseWithError(errors.New("mirror: repair done"))
+	return err
+}
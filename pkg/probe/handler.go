@@ -0,0 +1,45 @@
+package probe
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler returns a readiness http.Handler.
+//
+// It responds 200 if all storagers are healthy, 503 otherwise, with the
+// report as JSON body. The report is reused for Options.CacheFor, so that
+// frequent polling doesn't hit the storagers (and write canaries) every
+// time. Concurrent requests without a fresh report share a single Run.
+func (p *Prober) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		report := p.cached()
+		if report == nil {
+			select {
+			case <-p.runShared():
+			case <-r.Context().Done():
+				return
+			}
+			report = p.Last()
+		}
+
+		status := http.StatusOK
+		if !report.Healthy {
+			status = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(status)
+		if r.Method == http.MethodHead {
+			return
+		}
+		_ = json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,284 @@
+// Package probe checks that storagers are reachable and usable, and reports
+// the optional interfaces they implement.
+//
+// Every storager is checked with a cheap List on its work dir. With
+// Options.Canary, a small object is also written, read back and deleted.
+package probe
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/types"
+)
+
+const (
+	defaultTimeout  = 10 * time.Second
+	defaultCacheFor = 10 * time.Second
+	canaryPrefix    = ".probe-"
+)
+
+// Check names.
+const (
+	CheckList   = "list"
+	CheckWrite  = "write"
+	CheckRead   = "read"
+	CheckDelete = "delete"
+)
+
+// Options configures a Prober.
+type Options struct {
+	// Canary enables the write-read-delete check. The canary object is
+	// named `.probe-<random>` under the work dir.
+	Canary bool
+	// Timeout of all checks of a storager, default to 10s.
+	Timeout time.Duration
+	// CacheFor is how long the report is reused by Handler, default to 10s.
+	// Negative value disables the cache.
+	CacheFor time.Duration
+}
+
+// Report is the result of probing all storagers.
+type Report struct {
+	Healthy   bool      `json:"healthy"`
+	Time      time.Time `json:"time"`
+	Storagers []Result  `json:"storagers"`
+}
+
+// Result is the result of probing a storager.
+type Result struct {
+	Name         string   `json:"name"`
+	Service      string   `json:"service"`
+	Healthy      bool     `json:"healthy"`
+	Checks       []Check  `json:"checks"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// Check is the result of a single operation.
+type Check struct {
+	Name     string `json:"name"`
+	OK       bool   `json:"ok"`
+	Duration string `json:"duration"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Prober probes a fixed set of storagers.
+type Prober struct {
+	stores map[string]types.Storager
+	opts   Options
+
+	mu   sync.Mutex
+	last *Report
+	// running is closed when the Run started by Handler is done.
+	running chan struct{}
+}
+
+// New creates a Prober for storagers keyed by name.
+func New(stores map[string]types.Storager, opts Options) *Prober {
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+	if opts.CacheFor == 0 {
+		opts.CacheFor = defaultCacheFor
+	}
+	return &Prober{stores: stores, opts: opts}
+}
+
+// Run probes all storagers concurrently. The results are sorted by name.
+func (p *Prober) Run(ctx context.Context) *Report {
+	r := &Report{
+		Healthy:   true,
+		Time:      time.Now(),
+		Storagers: make([]Result, 0, len(p.stores)),
+	}
+
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for name, store := range p.stores {
+		wg.Add(1)
+		go func(name string, store types.Storager) {
+			defer wg.Done()
+
+			res := p.probe(ctx, name, store)
+
+			mu.Lock()
+			defer mu.Unlock()
+			r.Storagers = append(r.Storagers, res)
+			if !res.Healthy {
+				r.Healthy = false
+			}
+		}(name, store)
+	}
+	wg.Wait()
+
+	sort.Slice(r.Storagers, func(i, j int) bool {
+		return r.Storagers[i].Name < r.Storagers[j].Name
+	})
+
+	p.mu.Lock()
+	p.last = r
+	p.mu.Unlock()
+	return r
+}
+
+// Last returns the last report, or nil if never run.
+func (p *Prober) Last() *Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.last
+}
+
+// runShared starts a Run unless one started by Handler is in progress, and
+// returns a channel closed once it's done.
+//
+// The Run is detached from the requests, so that a client going away
+// doesn't fail the checks for the others waiting. It's bounded by
+// Options.Timeout like every Run.
+func (p *Prober) runShared() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.running != nil {
+		return p.running
+	}
+	done := make(chan struct{})
+	p.running = done
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), p.opts.Timeout)
+		defer cancel()
+		p.Run(ctx)
+
+		p.mu.Lock()
+		p.running = nil
+		p.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+// cached returns the last report if it's still fresh.
+func (p *Prober) cached() *Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.last == nil || p.opts.CacheFor < 0 || time.Since(p.last.Time) > p.opts.CacheFor {
+		return nil
+	}
+	return p.last
+}
+
+func (p *Prober) probe(ctx context.Context, name string, store types.Storager) Result {
+	ctx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+
+	res := Result{
+		Name:         name,
+		Service:      store.String(),
+		Healthy:      true,
+		Capabilities: Capabilities(store),
+	}
+	add := func(check string, start time.Time, err error) bool {
+		c := Check{Name: check, OK: err == nil, Duration: time.Since(start).String()}
+		if err != nil {
+			c.Error = err.Error()
+			res.Healthy = false
+		}
+		res.Checks = append(res.Checks, c)
+		return err == nil
+	}
+
+	start := time.Now()
+	if !add(CheckList, start, list(ctx, store)) || !p.opts.Canary {
+		return res
+	}
+
+	path, data, err := canary()
+	if err != nil {
+		add(CheckWrite, time.Now(), err)
+		return res
+	}
+
+	start = time.Now()
+	_, err = store.WriteWithContext(ctx, path, bytes.NewReader(data), int64(len(data)))
+	if !add(CheckWrite, start, err) {
+		return res
+	}
+
+	start = time.Now()
+	var buf bytes.Buffer
+	_, err = store.ReadWithContext(ctx, path, &buf)
+	if err == nil && !bytes.Equal(buf.Bytes(), data) {
+		err = fmt.Errorf("read %d bytes, content mismatch", buf.Len())
+	}
+	add(CheckRead, start, err)
+
+	// Always try to clean up the canary object once written.
+	start = time.Now()
+	add(CheckDelete, start, store.DeleteWithContext(ctx, path))
+	return res
+}
+
+// list reads the first entry of the work dir.
+func list(ctx context.Context, store types.Storager) error {
+	it, err := store.ListWithContext(ctx, "", pairs.WithListMode(types.ListModeDir))
+	if err != nil {
+		return err
+	}
+	_, err = it.Next()
+	if err != nil && !errors.Is(err, types.IterateDone) {
+		return err
+	}
+	return nil
+}
+
+func canary() (path string, data []byte, err error) {
+	data = make([]byte, 16)
+	if _, err = rand.Read(data); err != nil {
+		return "", nil, err
+	}
+	return canaryPrefix + hex.EncodeToString(data[:8]), data, nil
+}
+
+// Capabilities returns the names of optional interfaces implemented by store.
+func Capabilities(store types.Storager) []string {
+	caps := make([]string, 0)
+	if _, ok := store.(types.Appender); ok {
+		caps = append(caps, "Appender")
+	}
+	if _, ok := store.(types.Copier); ok {
+		caps = append(caps, "Copier")
+	}
+	if _, ok := store.(types.Direr); ok {
+		caps = append(caps, "Direr")
+	}
+	if _, ok := store.(types.Fetcher); ok {
+		caps = append(caps, "Fetcher")
+	}
+	if _, ok := store.(types.Linker); ok {
+		caps = append(caps, "Linker")
+	}
+	if _, ok := store.(types.Mover); ok {
+		caps = append(caps, "Mover")
+	}
+	if _, ok := store.(types.Multiparter); ok {
+		caps = append(caps, "Multiparter")
+	}
+	if _, ok := store.(types.MultipartHTTPSigner); ok {
+		caps = append(caps, "MultipartHTTPSigner")
+	}
+	if _, ok := store.(types.StorageHTTPSigner); ok {
+		caps = append(caps, "StorageHTTPSigner")
+	}
+	return caps
+}
@@ -0,0 +1,276 @@
+// Package registry shares storagers by profile name.
+//
+// Storagers are created lazily on first use from the profiles of a
+// config.Config, and shared by all goroutines afterwards. Reload replaces
+// only the storagers whose profile has changed.
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/config"
+)
+
+// Scheme is the URI scheme accepted by Lookup.
+const Scheme = "profile"
+
+var (
+	// ErrProfileNotExist means the profile is not defined.
+	ErrProfileNotExist = errors.New("profile not exist")
+	// ErrClosed means the registry has been closed.
+	ErrClosed = errors.New("registry closed")
+)
+
+// NewFunc creates the storager of a profile.
+type NewFunc func(name string, p *config.Profile) (types.Storager, error)
+
+// Options configures a Registry.
+type Options struct {
+	// New creates storagers, default to config.Profile.NewStorager. It
+	// could be used to wrap storagers, for example with credential
+	// providers.
+	New NewFunc
+}
+
+// Registry creates storagers lazily and shares them.
+type Registry struct {
+	opts Options
+
+	mu       sync.Mutex
+	closed   bool
+	profiles map[string]*config.Profile
+	entries  map[string]*entry
+	// gen is incremented by Reload and Close, so that Get knows whether
+	// the entry it created a storager for has been dropped meanwhile.
+	gen uint64
+}
+
+// entry is the storager of a profile, created at most once at a time.
+type entry struct {
+	profile *config.Profile
+
+	mu    sync.Mutex
+	store types.Storager
+}
+
+// New creates a Registry from the profiles of c.
+func New(c *config.Config, opts Options) *Registry {
+	if opts.New == nil {
+		opts.New = func(name string, p *config.Profile) (types.Storager, error) {
+			return p.NewStorager()
+		}
+	}
+	r := &Registry{
+		opts:    opts,
+		entries: make(map[string]*entry),
+	}
+	r.profiles = copyProfiles(c)
+	return r
+}
+
+// Names returns the sorted profile names.
+func (r *Registry) Names() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.profiles))
+	for name := range r.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the storager of a profile, creating it on first use.
+//
+// A failed creation is not cached, the next Get will try again. A storager
+// created while Reload or Close ran is closed, and Get starts over with the
+// current profile.
+func (r *Registry) Get(name string) (types.Storager, error) {
+	for {
+		store, ok, err := r.get(name)
+		if err != nil || ok {
+			return store, err
+		}
+	}
+}
+
+// get returns the storager of a profile, or false if the registry changed
+// while it was created.
+func (r *Registry) get(name string) (types.Storager, bool, error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, false, ErrClosed
+	}
+	e, ok := r.entries[name]
+	if !ok {
+		p, ok := r.profiles[name]
+		if !ok {
+			r.mu.Unlock()
+			return nil, false, fmt.Errorf("%s: %w", name, ErrProfileNotExist)
+		}
+		e = &entry{profile: p}
+		r.entries[name] = e
+	}
+	gen := r.gen
+	r.mu.Unlock()
+
+	// Only this profile waits while its storager is being created.
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.store != nil {
+		return e.store, true, nil
+	}
+	store, err := r.opts.New(name, e.profile)
+	if err != nil {
+		return nil, false, fmt.Errorf("profile %s: %w", name, err)
+	}
+
+	r.mu.Lock()
+	current := r.gen == gen
+	r.mu.Unlock()
+	if !current {
+		// e may have been closed already, nobody would close store.
+		_ = closeStore(store)
+		return nil, false, nil
+	}
+	e.store = store
+	return store, true, nil
+}
+
+// Lookup resolves a URI like `profile://backups/path/to/file` into the
+// storager of profile `backups` and the path `path/to/file` relative to its
+// work dir.
+func (r *Registry) Lookup(uri string) (types.Storager, string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, "", err
+	}
+	if u.Scheme != Scheme || u.Host == "" {
+		return nil, "", fmt.Errorf("invalid profile uri %q, expect %s://<profile>/<path>", uri, Scheme)
+	}
+
+	store, err := r.Get(u.Host)
+	if err != nil {
+		return nil, "", err
+	}
+	return store, strings.TrimPrefix(u.Path, "/"), nil
+}
+
+// Reload replaces the profiles with those of c.
+//
+// Storagers of removed or changed profiles are closed if they implement
+// io.Closer, and created again with the new profile on next Get. Storagers
+// of unchanged profiles are kept.
+func (r *Registry) Reload(c *config.Config) error {
+	profiles := copyProfiles(c)
+
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrClosed
+	}
+	var stale []*entry
+	for name, e := range r.entries {
+		if p, ok := profiles[name]; ok && reflect.DeepEqual(p, e.profile) {
+			continue
+		}
+		stale = append(stale, e)
+		delete(r.entries, name)
+	}
+	r.profiles = profiles
+	r.gen++
+	r.mu.Unlock()
+
+	return closeEntries(stale)
+}
+
+// ReloadFile loads the config file at path and reloads the registry with it.
+// The registry is unchanged if the file is invalid.
+func (r *Registry) ReloadFile(path string) error {
+	c, err := config.Load(path)
+	if err != nil {
+		return err
+	}
+	return r.Reload(c)
+}
+
+// Close closes all created storagers which implement io.Closer. Get fails
+// with ErrClosed afterwards.
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil
+	}
+	r.closed = true
+	r.gen++
+	entries := make([]*entry, 0, len(r.entries))
+	for _, e := range r.entries {
+		entries = append(entries, e)
+	}
+	r.entries = nil
+	r.mu.Unlock()
+
+	return closeEntries(entries)
+}
+
+func closeEntries(entries []*entry) error {
+	var first error
+	for _, e := range entries {
+		// Wait for an ongoing creation.
+		e.mu.Lock()
+		store := e.store
+		e.store = nil
+		e.mu.Unlock()
+
+		if err := closeStore(store); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// closeStore closes store if it implements io.Closer.
+func closeStore(store types.Storager) error {
+	if c, ok := store.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// copyProfiles copies profiles so that later changes to c don't affect the
+// registry.
+func copyProfiles(c *config.Config) map[string]*config.Profile {
+	profiles := make(map[string]*config.Profile, len(c.Profiles))
+	for name, p := range c.Profiles {
+		if p == nil {
+			continue
+		}
+		cp := *p
+		cp.Features = append([]string(nil), p.Features...)
+		if p.DefaultPairs != nil {
+			cp.DefaultPairs = make(map[string]map[string]string, len(p.DefaultPairs))
+			for op, kv := range p.DefaultPairs {
+				m := make(map[string]string, len(kv))
+				for k, v := range kv {
+					m[k] = v
+				}
+				cp.DefaultPairs[op] = m
+			}
+		}
+		profiles[name] = &cp
+	}
+	return profiles
+}
@@ -0,0 +1,64 @@
+package router
+
+//go:generate go run gen_caps.go
+
+import (
+	"go.beyondstorage.io/v5/types"
+)
+
+// Capabilities of the mounted storagers.
+const (
+	capAppender = 1 << iota
+	capCopier
+	capDirer
+	capMover
+	capMultiparter
+)
+
+func capsOf(store types.Storager) int {
+	caps := 0
+	if _, ok := store.(types.Appender); ok {
+		caps |= capAppender
+	}
+	if _, ok := store.(types.Copier); ok {
+		caps |= capCopier
+	}
+	if _, ok := store.(types.Direr); ok {
+		caps |= capDirer
+	}
+	if _, ok := store.(types.Mover); ok {
+		caps |= capMover
+	}
+	if _, ok := store.(types.Multiparter); ok {
+		caps |= capMultiparter
+	}
+	return caps
+}
+
+// Storager returns the Router as a types.Storager implementing the optional
+// interfaces which all mounted storagers implement, and only those, so that
+// a type assertion tells what's supported.
+//
+// The interfaces are fixed once returned: from then on, Mount fails for a
+// storager which doesn't implement all of them. Mount the storagers before
+// calling Storager.
+func (r *Router) Storager() types.Storager {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	caps := 0
+	for i, m := range r.mounts {
+		if i == 0 {
+			caps = capsOf(m.store)
+			continue
+		}
+		caps &= capsOf(m.store)
+	}
+	// Storagers mounted since an earlier call implement those required
+	// then.
+	caps |= r.required
+	r.required = caps
+	// view is generated in caps_gen.go, there is a type for every
+	// combination of the optional interfaces.
+	return r.view(caps)
+}
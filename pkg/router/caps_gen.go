@@ -0,0 +1,253 @@
+// Code generated by gen_caps.go. DO NOT EDIT.
+
+package router
+
+import (
+	"go.beyondstorage.io/v5/types"
+)
+
+// view returns r with the optional interfaces in caps, there is a type for
+// every combination.
+func (r *Router) view(caps int) types.Storager {
+	switch caps {
+	case capAppender:
+		return viewA{r, appender{Router: r}}
+	case capCopier:
+		return viewC{r, copier{Router: r}}
+	case capAppender | capCopier:
+		return viewAC{r, appender{Router: r}, copier{Router: r}}
+	case capDirer:
+		return viewD{r, direr{Router: r}}
+	case capAppender | capDirer:
+		return viewAD{r, appender{Router: r}, direr{Router: r}}
+	case capCopier | capDirer:
+		return viewCD{r, copier{Router: r}, direr{Router: r}}
+	case capAppender | capCopier | capDirer:
+		return viewACD{r, appender{Router: r}, copier{Router: r}, direr{Router: r}}
+	case capMover:
+		return viewM{r, mover{Router: r}}
+	case capAppender | capMover:
+		return viewAM{r, appender{Router: r}, mover{Router: r}}
+	case capCopier | capMover:
+		return viewCM{r, copier{Router: r}, mover{Router: r}}
+	case capAppender | capCopier | capMover:
+		return viewACM{r, appender{Router: r}, copier{Router: r}, mover{Router: r}}
+	case capDirer | capMover:
+		return viewDM{r, direr{Router: r}, mover{Router: r}}
+	case capAppender | capDirer | capMover:
+		return viewADM{r, appender{Router: r}, direr{Router: r}, mover{Router: r}}
+	case capCopier | capDirer | capMover:
+		return viewCDM{r, copier{Router: r}, direr{Router: r}, mover{Router: r}}
+	case capAppender | capCopier | capDirer | capMover:
+		return viewACDM{r, appender{Router: r}, copier{Router: r}, direr{Router: r}, mover{Router: r}}
+	case capMultiparter:
+		return viewP{r, multiparter{Router: r}}
+	case capAppender | capMultiparter:
+		return viewAP{r, appender{Router: r}, multiparter{Router: r}}
+	case capCopier | capMultiparter:
+		return viewCP{r, copier{Router: r}, multiparter{Router: r}}
+	case capAppender | capCopier | capMultiparter:
+		return viewACP{r, appender{Router: r}, copier{Router: r}, multiparter{Router: r}}
+	case capDirer | capMultiparter:
+		return viewDP{r, direr{Router: r}, multiparter{Router: r}}
+	case capAppender | capDirer | capMultiparter:
+		return viewADP{r, appender{Router: r}, direr{Router: r}, multiparter{Router: r}}
+	case capCopier | capDirer | capMultiparter:
+		return viewCDP{r, copier{Router: r}, direr{Router: r}, multiparter{Router: r}}
+	case capAppender | capCopier | capDirer | capMultiparter:
+		return viewACDP{r, appender{Router: r}, copier{Router: r}, direr{Router: r}, multiparter{Router: r}}
+	case capMover | capMultiparter:
+		return viewMP{r, mover{Router: r}, multiparter{Router: r}}
+	case capAppender | capMover | capMultiparter:
+		return viewAMP{r, appender{Router: r}, mover{Router: r}, multiparter{Router: r}}
+	case capCopier | capMover | capMultiparter:
+		return viewCMP{r, copier{Router: r}, mover{Router: r}, multiparter{Router: r}}
+	case capAppender | capCopier | capMover | capMultiparter:
+		return viewACMP{r, appender{Router: r}, copier{Router: r}, mover{Router: r}, multiparter{Router: r}}
+	case capDirer | capMover | capMultiparter:
+		return viewDMP{r, direr{Router: r}, mover{Router: r}, multiparter{Router: r}}
+	case capAppender | capDirer | capMover | capMultiparter:
+		return viewADMP{r, appender{Router: r}, direr{Router: r}, mover{Router: r}, multiparter{Router: r}}
+	case capCopier | capDirer | capMover | capMultiparter:
+		return viewCDMP{r, copier{Router: r}, direr{Router: r}, mover{Router: r}, multiparter{Router: r}}
+	case capAppender | capCopier | capDirer | capMover | capMultiparter:
+		return viewACDMP{r, appender{Router: r}, copier{Router: r}, direr{Router: r}, mover{Router: r}, multiparter{Router: r}}
+	}
+	return r
+}
+
+type (
+	viewA struct {
+		*Router
+		appender
+	}
+	viewC struct {
+		*Router
+		copier
+	}
+	viewAC struct {
+		*Router
+		appender
+		copier
+	}
+	viewD struct {
+		*Router
+		direr
+	}
+	viewAD struct {
+		*Router
+		appender
+		direr
+	}
+	viewCD struct {
+		*Router
+		copier
+		direr
+	}
+	viewACD struct {
+		*Router
+		appender
+		copier
+		direr
+	}
+	viewM struct {
+		*Router
+		mover
+	}
+	viewAM struct {
+		*Router
+		appender
+		mover
+	}
+	viewCM struct {
+		*Router
+		copier
+		mover
+	}
+	viewACM struct {
+		*Router
+		appender
+		copier
+		mover
+	}
+	viewDM struct {
+		*Router
+		direr
+		mover
+	}
+	viewADM struct {
+		*Router
+		appender
+		direr
+		mover
+	}
+	viewCDM struct {
+		*Router
+		copier
+		direr
+		mover
+	}
+	viewACDM struct {
+		*Router
+		appender
+		copier
+		direr
+		mover
+	}
+	viewP struct {
+		*Router
+		multiparter
+	}
+	viewAP struct {
+		*Router
+		appender
+		multiparter
+	}
+	viewCP struct {
+		*Router
+		copier
+		multiparter
+	}
+	viewACP struct {
+		*Router
+		appender
+		copier
+		multiparter
+	}
+	viewDP struct {
+		*Router
+		direr
+		multiparter
+	}
+	viewADP struct {
+		*Router
+		appender
+		direr
+		multiparter
+	}
+	viewCDP struct {
+		*Router
+		copier
+		direr
+		multiparter
+	}
+	viewACDP struct {
+		*Router
+		appender
+		copier
+		direr
+		multiparter
+	}
+	viewMP struct {
+		*Router
+		mover
+		multiparter
+	}
+	viewAMP struct {
+		*Router
+		appender
+		mover
+		multiparter
+	}
+	viewCMP struct {
+		*Router
+		copier
+		mover
+		multiparter
+	}
+	viewACMP struct {
+		*Router
+		appender
+		copier
+		mover
+		multiparter
+	}
+	viewDMP struct {
+		*Router
+		direr
+		mover
+		multiparter
+	}
+	viewADMP struct {
+		*Router
+		appender
+		direr
+		mover
+		multiparter
+	}
+	viewCDMP struct {
+		*Router
+		copier
+		direr
+		mover
+		multiparter
+	}
+	viewACDMP struct {
+		*Router
+		appender
+		copier
+		direr
+		mover
+		multiparter
+	}
+)
@@ -0,0 +1,76 @@
+//go:build ignore
+// +build ignore
+
+// gen_caps generates caps_gen.go, which has a view type for every
+// combination of the optional interfaces.
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"log"
+	"strings"
+)
+
+// caps are in the order of the cap constants.
+var caps = []struct {
+	letter string
+	typ    string
+	cap    string
+}{
+	{"A", "appender", "capAppender"},
+	{"C", "copier", "capCopier"},
+	{"D", "direr", "capDirer"},
+	{"M", "mover", "capMover"},
+	{"P", "multiparter", "capMultiparter"},
+}
+
+func main() {
+	var b bytes.Buffer
+	b.WriteString("// Code generated by gen_caps.go. DO NOT EDIT.\n\n")
+	b.WriteString("package router\n\n")
+	b.WriteString("import (\n\t\"go.beyondstorage.io/v5/types\"\n)\n\n")
+
+	var views, cases bytes.Buffer
+	for mask := 1; mask < 1<<len(caps); mask++ {
+		name := "view"
+		var fields, values, exprs []string
+		for i, c := range caps {
+			if mask&(1<<i) == 0 {
+				continue
+			}
+			name += c.letter
+			fields = append(fields, c.typ)
+			values = append(values, c.typ+"{Router: r}")
+			exprs = append(exprs, c.cap)
+		}
+
+		fmt.Fprintf(&views, "\t%s struct {\n\t\t*Router\n", name)
+		for _, f := range fields {
+			fmt.Fprintf(&views, "\t\t%s\n", f)
+		}
+		views.WriteString("\t}\n")
+
+		fmt.Fprintf(&cases, "\tcase %s:\n\t\treturn %s{r, %s}\n",
+			strings.Join(exprs, " | "), name, strings.Join(values, ", "))
+	}
+
+	b.WriteString("// view returns r with the optional interfaces in caps, there is a type for\n")
+	b.WriteString("// every combination.\n")
+	b.WriteString("func (r *Router) view(caps int) types.Storager {\n\tswitch caps {\n")
+	b.Write(cases.Bytes())
+	b.WriteString("\t}\n\treturn r\n}\n\n")
+	b.WriteString("type (\n")
+	b.Write(views.Bytes())
+	b.WriteString(")\n")
+
+	src, err := format.Source(b.Bytes())
+	if err != nil {
+		log.Fatalf("format: %v", err)
+	}
+	if err := ioutil.WriteFile("caps_gen.go", src, 0o644); err != nil {
+		log.Fatalf("write: %v", err)
+	}
+}
@@ -0,0 +1,148 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.beyondstorage.io/v5/types"
+)
+
+const pageSize = 100
+
+// listStatus is the status of merged listings, which can't be continued.
+type listStatus struct{}
+
+func (listStatus) ContinuationToken() string { return "" }
+
+// source is a listing of a mount.
+type source struct {
+	mount mount
+	it    *types.ObjectIterator
+}
+
+func (r *Router) List(path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	return r.ListWithContext(context.Background(), path, pairs...)
+}
+
+// ListWithContext lists the mount of path.
+//
+// With types.ListModeDir, mount roots directly below path are merged as
+// virtual dirs. With types.ListModePrefix, all mounts below path are listed
+// as well. Objects of a mount which are hidden by a deeper mount are
+// skipped. Other list modes are only forwarded to the mount of path.
+func (r *Router) ListWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	path = strings.TrimPrefix(path, "/")
+	mode := listMode(pairs)
+	mounts := r.snapshot()
+
+	var sources []source
+	m, inner, routeErr := r.route(path)
+	if routeErr == nil {
+		it, err := m.store.ListWithContext(ctx, inner, pairs...)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source{mount: m, it: it})
+	}
+
+	var virtual []*types.Object
+	seen := make(map[string]bool)
+	switch {
+	case mode.IsDir():
+		dir := path
+		if dir != "" && !strings.HasSuffix(dir, "/") {
+			dir += "/"
+		}
+		for _, n := range mounts {
+			if n.prefix == m.prefix || n.prefix == dir || !strings.HasPrefix(n.prefix, dir) {
+				continue
+			}
+			rest := n.prefix[len(dir):]
+			child := dir + rest[:strings.IndexByte(rest, '/')+1]
+			if seen[strings.TrimSuffix(child, "/")] {
+				continue
+			}
+			seen[strings.TrimSuffix(child, "/")] = true
+
+			o := types.NewObject(r, true)
+			o.ID = child
+			o.Path = child
+			o.Mode = types.ModeDir
+			virtual = append(virtual, o)
+		}
+	case mode.IsPrefix():
+		for _, n := range mounts {
+			if n.prefix == m.prefix || !strings.HasPrefix(n.prefix, path) {
+				continue
+			}
+			it, err := n.store.ListWithContext(ctx, "", pairs...)
+			if err != nil {
+				return nil, err
+			}
+			sources = append(sources, source{mount: n, it: it})
+		}
+	}
+
+	if len(sources) == 0 && len(virtual) == 0 {
+		return nil, routeErr
+	}
+
+	next := func(ctx context.Context, page *types.ObjectPage) error {
+		for len(virtual) > 0 && len(page.Data) < pageSize {
+			page.Data = append(page.Data, virtual[0])
+			virtual = virtual[1:]
+		}
+		for len(page.Data) < pageSize {
+			if len(sources) == 0 {
+				return types.IterateDone
+			}
+			s := sources[0]
+
+			o, err := s.it.Next()
+			if err != nil && errors.Is(err, types.IterateDone) {
+				sources = sources[1:]
+				continue
+			}
+			if err != nil {
+				return err
+			}
+
+			full := s.mount.prefix + o.Path
+			if seen[strings.TrimSuffix(full, "/")] || shadowed(mounts, s.mount, full) {
+				continue
+			}
+			o.Path = full
+			page.Data = append(page.Data, o)
+		}
+		return nil
+	}
+	return types.NewObjectIterator(ctx, next, listStatus{}), nil
+}
+
+// shadowed reports whether path of mount m is hidden by a deeper mount.
+func shadowed(mounts []mount, m mount, path string) bool {
+	for _, n := range mounts {
+		if len(n.prefix) <= len(m.prefix) {
+			// Mounts are sorted, no deeper mount left.
+			return false
+		}
+		if strings.HasPrefix(n.prefix, m.prefix) &&
+			(strings.HasPrefix(path, n.prefix) || path+"/" == n.prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func listMode(pairs []types.Pair) types.ListMode {
+	for _, p := range pairs {
+		if p.Key != "list_mode" {
+			continue
+		}
+		if v, ok := p.Value.(types.ListMode); ok {
+			return v
+		}
+	}
+	return 0
+}
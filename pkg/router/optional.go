@@ -0,0 +1,235 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+func unsupported(op string, m mount) error {
+	return fmt.Errorf("%s on mount %q (%s): %w", op, m.prefix, m.store, services.ErrCapabilityInsufficient)
+}
+
+// The optional interfaces are implemented by one type each, embedding the
+// Router. Router.Storager combines those supported by all mounts.
+type (
+	appender struct {
+		*Router
+		types.UnimplementedAppender
+	}
+	copier struct {
+		*Router
+		types.UnimplementedCopier
+	}
+	direr struct {
+		*Router
+		types.UnimplementedDirer
+	}
+	mover struct {
+		*Router
+		types.UnimplementedMover
+	}
+	multiparter struct {
+		*Router
+		types.UnimplementedMultiparter
+	}
+)
+
+// outer returns o with the path prefixed by the mount.
+func outer(m mount, o *types.Object) *types.Object {
+	if o != nil {
+		o.Path = m.prefix + o.Path
+	}
+	return o
+}
+
+func (r appender) CreateAppend(path string, pairs ...types.Pair) (*types.Object, error) {
+	return r.CreateAppendWithContext(context.Background(), path, pairs...)
+}
+
+func (r appender) CreateAppendWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.Object, error) {
+	m, inner, err := r.route(path)
+	if err != nil {
+		return nil, err
+	}
+	a, ok := m.store.(types.Appender)
+	if !ok {
+		return nil, unsupported("CreateAppend", m)
+	}
+	o, err := a.CreateAppendWithContext(ctx, inner, pairs...)
+	return outer(m, o), err
+}
+
+func (r appender) WriteAppend(o *types.Object, rd io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	return r.WriteAppendWithContext(context.Background(), o, rd, size, pairs...)
+}
+
+func (r appender) WriteAppendWithContext(ctx context.Context, o *types.Object, rd io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	m, inner, err := r.routeObject(o)
+	if err != nil {
+		return 0, err
+	}
+	a, ok := m.store.(types.Appender)
+	if !ok {
+		return 0, unsupported("WriteAppend", m)
+	}
+	n, err := a.WriteAppendWithContext(ctx, inner, rd, size, pairs...)
+	// The append offset is tracked on the object.
+	if offset, ok := inner.GetAppendOffset(); ok {
+		o.SetAppendOffset(offset)
+	}
+	return n, err
+}
+
+func (r appender) CommitAppend(o *types.Object, pairs ...types.Pair) error {
+	return r.CommitAppendWithContext(context.Background(), o, pairs...)
+}
+
+func (r appender) CommitAppendWithContext(ctx context.Context, o *types.Object, pairs ...types.Pair) error {
+	m, inner, err := r.routeObject(o)
+	if err != nil {
+		return err
+	}
+	a, ok := m.store.(types.Appender)
+	if !ok {
+		return unsupported("CommitAppend", m)
+	}
+	return a.CommitAppendWithContext(ctx, inner, pairs...)
+}
+
+func (r multiparter) CreateMultipart(path string, pairs ...types.Pair) (*types.Object, error) {
+	return r.CreateMultipartWithContext(context.Background(), path, pairs...)
+}
+
+func (r multiparter) CreateMultipartWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.Object, error) {
+	m, inner, err := r.route(path)
+	if err != nil {
+		return nil, err
+	}
+	mp, ok := m.store.(types.Multiparter)
+	if !ok {
+		return nil, unsupported("CreateMultipart", m)
+	}
+	o, err := mp.CreateMultipartWithContext(ctx, inner, pairs...)
+	return outer(m, o), err
+}
+
+func (r multiparter) WriteMultipart(o *types.Object, rd io.Reader, size int64, index int, pairs ...types.Pair) (int64, *types.Part, error) {
+	return r.WriteMultipartWithContext(context.Background(), o, rd, size, index, pairs...)
+}
+
+func (r multiparter) WriteMultipartWithContext(ctx context.Context, o *types.Object, rd io.Reader, size int64, index int, pairs ...types.Pair) (int64, *types.Part, error) {
+	m, inner, err := r.routeObject(o)
+	if err != nil {
+		return 0, nil, err
+	}
+	mp, ok := m.store.(types.Multiparter)
+	if !ok {
+		return 0, nil, unsupported("WriteMultipart", m)
+	}
+	return mp.WriteMultipartWithContext(ctx, inner, rd, size, index, pairs...)
+}
+
+func (r multiparter) CompleteMultipart(o *types.Object, parts []*types.Part, pairs ...types.Pair) error {
+	return r.CompleteMultipartWithContext(context.Background(), o, parts, pairs...)
+}
+
+func (r multiparter) CompleteMultipartWithContext(ctx context.Context, o *types.Object, parts []*types.Part, pairs ...types.Pair) error {
+	m, inner, err := r.routeObject(o)
+	if err != nil {
+		return err
+	}
+	mp, ok := m.store.(types.Multiparter)
+	if !ok {
+		return unsupported("CompleteMultipart", m)
+	}
+	return mp.CompleteMultipartWithContext(ctx, inner, parts, pairs...)
+}
+
+func (r multiparter) ListMultipart(o *types.Object, pairs ...types.Pair) (*types.PartIterator, error) {
+	return r.ListMultipartWithContext(context.Background(), o, pairs...)
+}
+
+func (r multiparter) ListMultipartWithContext(ctx context.Context, o *types.Object, pairs ...types.Pair) (*types.PartIterator, error) {
+	m, inner, err := r.routeObject(o)
+	if err != nil {
+		return nil, err
+	}
+	mp, ok := m.store.(types.Multiparter)
+	if !ok {
+		return nil, unsupported("ListMultipart", m)
+	}
+	return mp.ListMultipartWithContext(ctx, inner, pairs...)
+}
+
+func (r copier) Copy(src, dst string, pairs ...types.Pair) error {
+	return r.CopyWithContext(context.Background(), src, dst, pairs...)
+}
+
+// CopyWithContext copies inside a mount. Copying across mounts is not
+// supported, use Read and Write instead.
+func (r copier) CopyWithContext(ctx context.Context, src, dst string, pairs ...types.Pair) error {
+	m, innerSrc, innerDst, err := r.routePair("Copy", src, dst)
+	if err != nil {
+		return err
+	}
+	c, ok := m.store.(types.Copier)
+	if !ok {
+		return unsupported("Copy", m)
+	}
+	return c.CopyWithContext(ctx, innerSrc, innerDst, pairs...)
+}
+
+func (r mover) Move(src, dst string, pairs ...types.Pair) error {
+	return r.MoveWithContext(context.Background(), src, dst, pairs...)
+}
+
+// MoveWithContext moves inside a mount. Moving across mounts is not
+// supported.
+func (r mover) MoveWithContext(ctx context.Context, src, dst string, pairs ...types.Pair) error {
+	m, innerSrc, innerDst, err := r.routePair("Move", src, dst)
+	if err != nil {
+		return err
+	}
+	mv, ok := m.store.(types.Mover)
+	if !ok {
+		return unsupported("Move", m)
+	}
+	return mv.MoveWithContext(ctx, innerSrc, innerDst, pairs...)
+}
+
+// routePair routes src and dst which must be in the same mount.
+func (r *Router) routePair(op, src, dst string) (mount, string, string, error) {
+	m, innerSrc, err := r.route(src)
+	if err != nil {
+		return mount{}, "", "", err
+	}
+	n, innerDst, err := r.route(dst)
+	if err != nil {
+		return mount{}, "", "", err
+	}
+	if m.prefix != n.prefix {
+		return mount{}, "", "", fmt.Errorf("%s from mount %q to %q: %w", op, m.prefix, n.prefix, services.ErrCapabilityInsufficient)
+	}
+	return m, innerSrc, innerDst, nil
+}
+
+func (r direr) CreateDir(path string, pairs ...types.Pair) (*types.Object, error) {
+	return r.CreateDirWithContext(context.Background(), path, pairs...)
+}
+
+func (r direr) CreateDirWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.Object, error) {
+	m, inner, err := r.route(path)
+	if err != nil {
+		return nil, err
+	}
+	d, ok := m.store.(types.Direr)
+	if !ok {
+		return nil, unsupported("CreateDir", m)
+	}
+	o, err := d.CreateDirWithContext(ctx, inner, pairs...)
+	return outer(m, o), err
+}
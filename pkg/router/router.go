@@ -0,0 +1,243 @@
+// Package router serves a single namespace from several storagers, each
+// mounted at a path prefix, like:
+//
+//	hot/      -> minio
+//	archive/  -> s3
+//	scratch/  -> fs
+//
+// Every call is dispatched to the mount with the longest matching prefix,
+// with the prefix stripped from the path. A mount at "" catches all paths
+// not matched by other mounts.
+//
+// List merges the mount roots below the listed dir as virtual dirs. Router
+// itself only implements types.Storager, Router.Storager returns it with the
+// optional interfaces implemented by all mounts, which are forwarded to the
+// target storager.
+package router
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+// Router is a types.Storager dispatching calls by path prefix.
+type Router struct {
+	types.UnimplementedStorager
+
+	mu     sync.RWMutex
+	mounts []mount // Sorted by prefix length, longest first.
+	// required are the capabilities returned by Storager, which all mounts
+	// must have.
+	required int
+}
+
+type mount struct {
+	prefix string
+	store  types.Storager
+}
+
+// New creates an empty Router.
+func New() *Router {
+	return &Router{}
+}
+
+// Mount mounts store at prefix. The prefix is a dir like `/hot/` or `hot/`,
+// the leading `/` is ignored. Use "" or "/" to mount a default storager.
+//
+// Once Storager has been called, store must implement the optional
+// interfaces it returned.
+func (r *Router) Mount(prefix string, store types.Storager) error {
+	prefix = strings.TrimPrefix(prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, m := range r.mounts {
+		if m.prefix == prefix {
+			return fmt.Errorf("mount %q: already mounted", prefix)
+		}
+	}
+	if capsOf(store)&r.required != r.required {
+		return fmt.Errorf("mount %q (%s): optional interfaces of the router are missing: %w", prefix, store, services.ErrCapabilityInsufficient)
+	}
+	// Always build a new slice, snapshots may still be in use.
+	mounts := make([]mount, 0, len(r.mounts)+1)
+	mounts = append(mounts, r.mounts...)
+	mounts = append(mounts, mount{prefix: prefix, store: store})
+	sort.SliceStable(mounts, func(i, j int) bool {
+		return len(mounts[i].prefix) > len(mounts[j].prefix)
+	})
+	r.mounts = mounts
+	return nil
+}
+
+// Unmount removes the mount at prefix.
+func (r *Router) Unmount(prefix string) {
+	prefix = strings.TrimPrefix(prefix, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, m := range r.mounts {
+		if m.prefix == prefix {
+			r.mounts = append(r.mounts[:i:i], r.mounts[i+1:]...)
+			return
+		}
+	}
+}
+
+// snapshot returns the current mounts, so that List doesn't hold the lock.
+func (r *Router) snapshot() []mount {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.mounts
+}
+
+// route returns the mount of path and the path inside the mount.
+func (r *Router) route(path string) (mount, string, error) {
+	path = strings.TrimPrefix(path, "/")
+	for _, m := range r.snapshot() {
+		if strings.HasPrefix(path, m.prefix) {
+			return m, path[len(m.prefix):], nil
+		}
+		// The mount root itself, like `hot` for `hot/`.
+		if path+"/" == m.prefix {
+			return m, "", nil
+		}
+	}
+	return mount{}, "", fmt.Errorf("route %s: %w", path, services.ErrObjectNotExist)
+}
+
+// routeObject returns the mount of o and the object of the mount, carrying
+// the multipart ID and append offset of o.
+func (r *Router) routeObject(o *types.Object) (mount, *types.Object, error) {
+	m, path, err := r.route(o.Path)
+	if err != nil {
+		return mount{}, nil, err
+	}
+	inner := m.store.Create(path)
+	if v, ok := o.GetMultipartID(); ok {
+		inner.SetMultipartID(v)
+	}
+	if v, ok := o.GetAppendOffset(); ok {
+		inner.SetAppendOffset(v)
+	}
+	return m, inner, nil
+}
+
+func (r *Router) String() string {
+	mounts := r.snapshot()
+	s := make([]string, 0, len(mounts))
+	for i := len(mounts) - 1; i >= 0; i-- {
+		s = append(s, fmt.Sprintf("%q: %s", mounts[i].prefix, mounts[i].store))
+	}
+	return "Router {" + strings.Join(s, ", ") + "}"
+}
+
+func (r *Router) Metadata(pairs ...types.Pair) *types.StorageMeta {
+	return &types.StorageMeta{Name: "router", WorkDir: "/"}
+}
+
+func (r *Router) Create(path string, pairs ...types.Pair) *types.Object {
+	m, inner, err := r.route(path)
+	if err != nil {
+		o := types.NewObject(r, false)
+		o.ID = path
+		o.Path = path
+		return o
+	}
+	o := m.store.Create(inner, pairs...)
+	o.Path = m.prefix + o.Path
+	return o
+}
+
+func (r *Router) Delete(path string, pairs ...types.Pair) error {
+	return r.DeleteWithContext(context.Background(), path, pairs...)
+}
+
+func (r *Router) DeleteWithContext(ctx context.Context, path string, pairs ...types.Pair) error {
+	m, inner, err := r.route(path)
+	if err != nil {
+		return err
+	}
+	return m.store.DeleteWithContext(ctx, inner, pairs...)
+}
+
+func (r *Router) Read(path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	return r.ReadWithContext(context.Background(), path, w, pairs...)
+}
+
+func (r *Router) ReadWithContext(ctx context.Context, path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	m, inner, err := r.route(path)
+	if err != nil {
+		return 0, err
+	}
+	return m.store.ReadWithContext(ctx, inner, w, pairs...)
+}
+
+func (r *Router) Stat(path string, pairs ...types.Pair) (*types.Object, error) {
+	return r.StatWithContext(context.Background(), path, pairs...)
+}
+
+func (r *Router) StatWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.Object, error) {
+	m, inner, err := r.route(path)
+	if err == nil && inner != "" {
+		var o *types.Object
+		o, err = m.store.StatWithContext(ctx, inner, pairs...)
+		if err == nil {
+			o.Path = m.prefix + o.Path
+			return o, nil
+		}
+	}
+	// Mount roots and their parents are dirs even if the storager has no
+	// such object.
+	if r.isVirtualDir(path) {
+		o := types.NewObject(r, true)
+		o.ID = path
+		o.Path = path
+		o.Mode = types.ModeDir
+		return o, nil
+	}
+	return nil, err
+}
+
+// isVirtualDir reports whether path is a mount root or a parent of one.
+func (r *Router) isVirtualDir(path string) bool {
+	dir := strings.Trim(path, "/")
+	if dir == "" {
+		return true
+	}
+	dir += "/"
+	for _, m := range r.snapshot() {
+		if strings.HasPrefix(m.prefix, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Router) Write(path string, rd io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	return r.WriteWithContext(context.Background(), path, rd, size, pairs...)
+}
+
+func (r *Router) WriteWithContext(ctx context.Context, path string, rd io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	m, inner, err := r.route(path)
+	if err != nil {
+		return 0, err
+	}
+	return m.store.WriteWithContext(ctx, inner, rd, size, pairs...)
+}
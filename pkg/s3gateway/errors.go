@@ -0,0 +1,89 @@
+package s3gateway
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+
+	"go.beyondstorage.io/v5/services"
+)
+
+// apiError is an error returned to the client in S3's XML format.
+type apiError struct {
+	Code       string
+	Message    string
+	StatusCode int
+}
+
+func (e *apiError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+var (
+	errAccessDenied                      = &apiError{"AccessDenied", "Access Denied.", http.StatusForbidden}
+	errAuthorizationHeaderMalformed      = &apiError{"AuthorizationHeaderMalformed", "The authorization header is malformed.", http.StatusBadRequest}
+	errAuthorizationQueryParametersError = &apiError{"AuthorizationQueryParametersError", "Error parsing the X-Amz-Credential parameters.", http.StatusBadRequest}
+	errBadDigest                         = &apiError{"BadDigest", "The Content-MD5 you specified did not match what we received.", http.StatusBadRequest}
+	errEntityTooLarge                    = &apiError{"EntityTooLarge", "Your proposed upload exceeds the maximum allowed object size.", http.StatusBadRequest}
+	errExpiredRequest                    = &apiError{"AccessDenied", "Request has expired.", http.StatusForbidden}
+	errIncompleteBody                    = &apiError{"IncompleteBody", "You did not provide the number of bytes specified by the Content-Length HTTP header.", http.StatusBadRequest}
+	errInternalError                     = &apiError{"InternalError", "We encountered an internal error. Please try again.", http.StatusInternalServerError}
+	errInvalidAccessKeyID                = &apiError{"InvalidAccessKeyId", "The access key ID you provided does not exist in our records.", http.StatusForbidden}
+	errInvalidArgument                   = &apiError{"InvalidArgument", "Invalid Argument.", http.StatusBadRequest}
+	errInvalidDigest                     = &apiError{"InvalidDigest", "The x-amz-content-sha256 you specified is not valid.", http.StatusBadRequest}
+	errInvalidPart                       = &apiError{"InvalidPart", "One or more of the specified parts could not be found.", http.StatusBadRequest}
+	errInvalidRange                      = &apiError{"InvalidRange", "The requested range is not satisfiable.", http.StatusRequestedRangeNotSatisfiable}
+	errMalformedXML                      = &apiError{"MalformedXML", "The XML you provided was not well-formed.", http.StatusBadRequest}
+	errMethodNotAllowed                  = &apiError{"MethodNotAllowed", "The specified method is not allowed against this resource.", http.StatusMethodNotAllowed}
+	errMissingContentLength              = &apiError{"MissingContentLength", "You must provide the Content-Length HTTP header.", http.StatusLengthRequired}
+	errNoSuchBucket                      = &apiError{"NoSuchBucket", "The specified bucket does not exist.", http.StatusNotFound}
+	errNoSuchKey                         = &apiError{"NoSuchKey", "The specified key does not exist.", http.StatusNotFound}
+	errNoSuchUpload                      = &apiError{"NoSuchUpload", "The specified multipart upload does not exist.", http.StatusNotFound}
+	errNotImplemented                    = &apiError{"NotImplemented", "A header or query you provided implies functionality that is not implemented.", http.StatusNotImplemented}
+	errRequestTimeTooSkewed              = &apiError{"RequestTimeTooSkewed", "The difference between the request time and the server's time is too large.", http.StatusForbidden}
+	errSignatureDoesNotMatch             = &apiError{"SignatureDoesNotMatch", "The request signature we calculated does not match the signature you provided.", http.StatusForbidden}
+	errUnsupportedSignature              = &apiError{"AccessDenied", "Only AWS4-HMAC-SHA256 is supported.", http.StatusBadRequest}
+	errXAmzContentSHA256Mismatch         = &apiError{"XAmzContentSHA256Mismatch", "The provided 'x-amz-content-sha256' header does not match what was computed.", http.StatusBadRequest}
+)
+
+// toAPIError converts errors returned by storager into S3 errors.
+func toAPIError(err error, notExist *apiError) *apiError {
+	var e *apiError
+	switch {
+	case errors.As(err, &e):
+		return e
+	case errors.Is(err, services.ErrObjectNotExist):
+		return notExist
+	case errors.Is(err, services.ErrPermissionDenied):
+		return errAccessDenied
+	default:
+		return errInternalError
+	}
+}
+
+type errorResponse struct {
+	XMLName   xml.Name `xml:"Error"`
+	Code      string   `xml:"Code"`
+	Message   string   `xml:"Message"`
+	Resource  string   `xml:"Resource"`
+	RequestID string   `xml:"RequestId"`
+}
+
+func (g *Gateway) writeError(w http.ResponseWriter, r *http.Request, err error, notExist *apiError) {
+	e := toAPIError(err, notExist)
+	if e == errInternalError {
+		g.opts.ErrorLog("s3gateway: %s %s: %v", r.Method, r.URL.Path, err)
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(e.StatusCode)
+	if r.Method == http.MethodHead {
+		return
+	}
+	_ = xml.NewEncoder(w).Encode(errorResponse{
+		Code:      e.Code,
+		Message:   e.Message,
+		Resource:  r.URL.Path,
+		RequestID: w.Header().Get("X-Amz-Request-Id"),
+	})
+}
@@ -0,0 +1,178 @@
+// Package s3gateway implements the core of the S3 API on top of any
+// types.Storager, so that S3 tools could access services like hdfs, ftp or
+// the local fs.
+//
+// Supported operations:
+//
+//   - ListBuckets
+//   - GetObject (with Range), HeadObject, PutObject and DeleteObject
+//   - ListObjectsV2, mapped to types.ListModeDir with delimiter "/" and
+//     types.ListModePrefix without delimiter, or a walk of every dir under
+//     the prefix if the service doesn't support it
+//   - CreateMultipartUpload, UploadPart, CompleteMultipartUpload,
+//     AbortMultipartUpload, ListParts and ListMultipartUploads, mapped to
+//     types.Multiparter
+//
+// Only path-style requests (`/<bucket>/<key>`) are supported. Requests are
+// authenticated with AWS Signature Version 4, either from the Authorization
+// header or from a presigned URL. aws-chunked payloads are decoded and every
+// chunk signature is verified.
+package s3gateway
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.beyondstorage.io/v5/types"
+)
+
+// Options controls the behavior of Gateway.
+type Options struct {
+	// Buckets maps bucket names to the storagers serving them.
+	Buckets map[string]types.Storager
+	// Credentials maps access key IDs to secret access keys.
+	//
+	// If it's empty, requests are not authenticated at all, which should only
+	// be used for local testing.
+	Credentials map[string]string
+	// MaxObjectSize limits the size of PutObject and UploadPart, default to 5 GiB.
+	MaxObjectSize int64
+	// TempDir is where PutObject bodies are staged until they're verified,
+	// default to os.TempDir.
+	TempDir string
+	// ErrorLog is used to log unexpected storage errors, default to log.Printf.
+	ErrorLog func(format string, args ...interface{})
+}
+
+// Gateway is an http.Handler serving the S3 API.
+type Gateway struct {
+	opts Options
+	now  func() time.Time
+}
+
+// New creates a Gateway.
+func New(opts Options) *Gateway {
+	if opts.MaxObjectSize == 0 {
+		opts.MaxObjectSize = 5 * 1024 * 1024 * 1024
+	}
+	if opts.ErrorLog == nil {
+		opts.ErrorLog = log.Printf
+	}
+	return &Gateway{opts: opts, now: time.Now}
+}
+
+// ServeHTTP implements http.Handler.
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("X-Amz-Request-Id", newRequestID())
+	w.Header().Set("Server", "s3gateway")
+
+	body := io.Reader(r.Body)
+	if len(g.opts.Credentials) > 0 {
+		var err error
+		body, err = verify(r, g.opts.Credentials, g.now())
+		if err != nil {
+			g.writeError(w, r, err, nil)
+			return
+		}
+	} else if r.Header.Get("X-Amz-Content-Sha256") == streamingPayload {
+		// Signatures are not verified, but the aws-chunked framing must
+		// still be removed from the content.
+		body = newChunkedReader(r.Body, nil, nil, "")
+	}
+
+	bucket, key := splitPath(r.URL.Path)
+	if bucket == "" {
+		if r.Method != http.MethodGet {
+			g.writeError(w, r, errMethodNotAllowed, nil)
+			return
+		}
+		g.listBuckets(w, r)
+		return
+	}
+
+	store, ok := g.opts.Buckets[bucket]
+	if !ok {
+		g.writeError(w, r, errNoSuchBucket, nil)
+		return
+	}
+
+	req := &request{
+		w:      w,
+		r:      r,
+		body:   body,
+		bucket: bucket,
+		key:    key,
+		store:  store,
+	}
+	q := r.URL.Query()
+
+	if key == "" {
+		switch {
+		case r.Method == http.MethodGet && has(q, "uploads"):
+			g.listMultipartUploads(req)
+		case r.Method == http.MethodGet:
+			g.listObjects(req)
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		default:
+			g.writeError(w, r, errMethodNotAllowed, nil)
+		}
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && has(q, "uploads"):
+		g.createMultipartUpload(req)
+	case r.Method == http.MethodPost && has(q, "uploadId"):
+		g.completeMultipartUpload(req)
+	case r.Method == http.MethodPut && has(q, "uploadId"):
+		g.uploadPart(req)
+	case r.Method == http.MethodDelete && has(q, "uploadId"):
+		g.abortMultipartUpload(req)
+	case r.Method == http.MethodGet && has(q, "uploadId"):
+		g.listParts(req)
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		g.getObject(req)
+	case r.Method == http.MethodPut:
+		g.putObject(req)
+	case r.Method == http.MethodDelete:
+		g.deleteObject(req)
+	default:
+		g.writeError(w, r, errMethodNotAllowed, nil)
+	}
+}
+
+// request carries the state of a routed request.
+type request struct {
+	w      http.ResponseWriter
+	r      *http.Request
+	body   io.Reader
+	bucket string
+	key    string
+	store  types.Storager
+}
+
+// splitPath splits `/<bucket>/<key>` into bucket and key.
+func splitPath(p string) (bucket, key string) {
+	p = strings.TrimPrefix(p, "/")
+	if i := strings.IndexByte(p, '/'); i >= 0 {
+		return p[:i], p[i+1:]
+	}
+	return p, ""
+}
+
+func has(q map[string][]string, k string) bool {
+	_, ok := q[k]
+	return ok
+}
+
+func newRequestID() string {
+	var b [8]byte
+	_, _ = rand.Read(b[:])
+	return strings.ToUpper(hex.EncodeToString(b[:]))
+}
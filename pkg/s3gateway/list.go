@@ -0,0 +1,233 @@
+package s3gateway
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/internal/walk"
+)
+
+const defaultMaxKeys = 1000
+
+type listEntry struct {
+	name     string
+	isPrefix bool
+	o        *types.Object
+}
+
+type listContent struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified,omitempty"`
+	ETag         string `xml:"ETag,omitempty"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName               xml.Name       `xml:"ListBucketResult"`
+	Xmlns                 string         `xml:"xmlns,attr"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	Marker                *string        `xml:"Marker,omitempty"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	KeyCount              *int           `xml:"KeyCount,omitempty"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	StartAfter            string         `xml:"StartAfter,omitempty"`
+	Contents              []listContent  `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+// listObjects serves both ListObjects and ListObjectsV2.
+//
+// With delimiter "/", the dir part of prefix is listed with
+// types.ListModeDir, otherwise prefix is listed with types.ListModePrefix,
+// or walked dir by dir if the service doesn't support it.
+// Other delimiters are not supported by Storager.
+//
+// Storager has no marker support, so every page lists all entries under the
+// prefix, sorts them, and skips the ones before the marker.
+func (g *Gateway) listObjects(req *request) {
+	w, r := req.w, req.r
+	q := r.URL.Query()
+	v2 := q.Get("list-type") == "2"
+
+	prefix, delimiter := q.Get("prefix"), q.Get("delimiter")
+	if delimiter != "" && delimiter != "/" {
+		g.writeError(w, r, errNotImplemented, nil)
+		return
+	}
+
+	maxKeys := defaultMaxKeys
+	if v := q.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			g.writeError(w, r, errInvalidArgument, nil)
+			return
+		}
+		if n < maxKeys {
+			maxKeys = n
+		}
+	}
+
+	var marker string
+	if v2 {
+		marker = q.Get("start-after")
+		if token := q.Get("continuation-token"); token != "" {
+			b, err := base64.StdEncoding.DecodeString(token)
+			if err != nil {
+				g.writeError(w, r, errInvalidArgument, nil)
+				return
+			}
+			marker = string(b)
+		}
+	} else {
+		marker = q.Get("marker")
+	}
+
+	entries, err := listEntries(req, prefix, delimiter)
+	if err != nil {
+		g.writeError(w, r, err, errNoSuchKey)
+		return
+	}
+
+	i := sort.Search(len(entries), func(i int) bool { return entries[i].name > marker })
+	entries = entries[i:]
+
+	resp := listBucketResult{
+		Xmlns:     xmlns,
+		Name:      req.bucket,
+		Prefix:    prefix,
+		Delimiter: delimiter,
+		MaxKeys:   maxKeys,
+	}
+	if len(entries) > maxKeys {
+		entries = entries[:maxKeys]
+		resp.IsTruncated = true
+	}
+
+	for _, e := range entries {
+		if e.isPrefix {
+			resp.CommonPrefixes = append(resp.CommonPrefixes, commonPrefix{Prefix: e.name})
+			continue
+		}
+		resp.Contents = append(resp.Contents, toListContent(e))
+	}
+
+	if v2 {
+		count := len(entries)
+		resp.KeyCount = &count
+		resp.ContinuationToken = q.Get("continuation-token")
+		resp.StartAfter = q.Get("start-after")
+		if resp.IsTruncated {
+			resp.NextContinuationToken = base64.StdEncoding.EncodeToString([]byte(entries[len(entries)-1].name))
+		}
+	} else {
+		resp.Marker = &marker
+		if resp.IsTruncated {
+			resp.NextMarker = entries[len(entries)-1].name
+		}
+	}
+
+	writeXML(w, http.StatusOK, resp)
+}
+
+// listEntries returns all keys and common prefixes under prefix sorted by name.
+func listEntries(req *request, prefix, delimiter string) ([]listEntry, error) {
+	listPath := prefix
+	if delimiter != "" {
+		listPath = prefix[:strings.LastIndex(prefix, "/")+1]
+	}
+
+	seen := make(map[string]bool)
+	var entries []listEntry
+	err := list(req.r.Context(), req.store, listPath, delimiter != "", func(o *types.Object) {
+		e := listEntry{name: o.Path, o: o}
+		if delimiter != "" && o.Mode.IsDir() {
+			e.isPrefix = true
+			if !strings.HasSuffix(e.name, "/") {
+				e.name += "/"
+			}
+			// The marker object of the listed dir itself.
+			if e.name == listPath {
+				return
+			}
+		}
+		if !strings.HasPrefix(e.name, prefix) || seen[e.name] {
+			return
+		}
+		seen[e.name] = true
+		entries = append(entries, e)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].name < entries[j].name
+	})
+	return entries, nil
+}
+
+// list calls fn for the objects in the dir p if dir is set, otherwise for
+// every object whose path starts with p. Services without
+// types.ListModePrefix, like fs, hdfs or ftp, are walked dir by dir from the
+// dir part of p instead, and fn must filter out the objects outside p.
+func list(ctx context.Context, store types.Storager, p string, dir bool, fn func(o *types.Object)) error {
+	mode := types.ListModePrefix
+	if dir {
+		mode = types.ListModeDir
+	}
+	it, err := store.ListWithContext(ctx, p, pairs.WithListMode(mode))
+	if err != nil && !dir {
+		return walk.Walk(ctx, store, p[:strings.LastIndex(p, "/")+1], func(o *types.Object) error {
+			fn(o)
+			return nil
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		o, err := it.Next()
+		if err != nil && errors.Is(err, types.IterateDone) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(o)
+	}
+}
+
+func toListContent(e listEntry) listContent {
+	c := listContent{Key: e.name, StorageClass: "STANDARD"}
+	if v, ok := e.o.GetContentLength(); ok {
+		c.Size = v
+	}
+	if v, ok := e.o.GetLastModified(); ok {
+		c.LastModified = v.UTC().Format(time.RFC3339Nano)
+	}
+	if v, ok := e.o.GetEtag(); ok {
+		c.ETag = quote(v)
+	}
+	return c
+}
@@ -0,0 +1,259 @@
+package s3gateway
+
+import (
+	"encoding/xml"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/types"
+)
+
+// maxPartNumber is the maximum part number allowed by S3, it's the same as
+// the maximum index + 1 of types.Multiparter.
+const maxPartNumber = 10000
+
+func (g *Gateway) multiparter(req *request) (types.Multiparter, bool) {
+	mp, ok := req.store.(types.Multiparter)
+	if !ok {
+		g.writeError(req.w, req.r, errNotImplemented, nil)
+	}
+	return mp, ok
+}
+
+func (g *Gateway) createMultipartUpload(req *request) {
+	mp, ok := g.multiparter(req)
+	if !ok {
+		return
+	}
+
+	o, err := mp.CreateMultipartWithContext(req.r.Context(), req.key)
+	if err != nil {
+		g.writeError(req.w, req.r, err, nil)
+		return
+	}
+
+	writeXML(req.w, http.StatusOK, struct {
+		XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}{Xmlns: xmlns, Bucket: req.bucket, Key: req.key, UploadID: o.MustGetMultipartID()})
+}
+
+func (g *Gateway) uploadPart(req *request) {
+	w, r := req.w, req.r
+	mp, ok := g.multiparter(req)
+	if !ok {
+		return
+	}
+
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		g.writeError(w, r, errNotImplemented, nil)
+		return
+	}
+
+	number, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+	if err != nil || number < 1 || number > maxPartNumber {
+		g.writeError(w, r, errInvalidArgument, nil)
+		return
+	}
+
+	size, err := g.contentLength(r)
+	if err != nil {
+		g.writeError(w, r, err, nil)
+		return
+	}
+
+	body, _, err := withContentMD5(r, req.body, size)
+	if err != nil {
+		g.writeError(w, r, err, nil)
+		return
+	}
+
+	o := req.store.Create(req.key, pairs.WithMultipartID(r.URL.Query().Get("uploadId")))
+
+	// Part numbers of S3 start from 1, while part indexes of Multiparter
+	// start from 0.
+	_, part, err := mp.WriteMultipartWithContext(r.Context(), o, body, size, number-1)
+	if err != nil {
+		g.writeError(w, r, err, errNoSuchUpload)
+		return
+	}
+
+	w.Header().Set("ETag", quote(part.ETag))
+	w.WriteHeader(http.StatusOK)
+}
+
+func (g *Gateway) completeMultipartUpload(req *request) {
+	w, r := req.w, req.r
+	mp, ok := g.multiparter(req)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Parts []struct {
+			PartNumber int    `xml:"PartNumber"`
+			ETag       string `xml:"ETag"`
+		} `xml:"Part"`
+	}
+	if err := readXML(req.body, &input); err != nil {
+		g.writeError(w, r, err, nil)
+		return
+	}
+	if len(input.Parts) == 0 {
+		g.writeError(w, r, errMalformedXML, nil)
+		return
+	}
+
+	parts := make([]*types.Part, 0, len(input.Parts))
+	for i, p := range input.Parts {
+		if p.PartNumber < 1 || p.PartNumber > maxPartNumber ||
+			(i > 0 && p.PartNumber <= input.Parts[i-1].PartNumber) {
+			g.writeError(w, r, errInvalidPart, nil)
+			return
+		}
+		parts = append(parts, &types.Part{Index: p.PartNumber - 1, ETag: p.ETag})
+	}
+
+	o := req.store.Create(req.key, pairs.WithMultipartID(r.URL.Query().Get("uploadId")))
+	err := mp.CompleteMultipartWithContext(r.Context(), o, parts)
+	if err != nil {
+		g.writeError(w, r, err, errNoSuchUpload)
+		return
+	}
+
+	var etag string
+	if stat, err := req.store.StatWithContext(r.Context(), req.key); err == nil {
+		if v, ok := stat.GetEtag(); ok {
+			etag = quote(v)
+		}
+	}
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+		Xmlns    string   `xml:"xmlns,attr"`
+		Location string   `xml:"Location"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		ETag     string   `xml:"ETag"`
+	}{Xmlns: xmlns, Location: "/" + req.bucket + "/" + req.key, Bucket: req.bucket, Key: req.key, ETag: etag})
+}
+
+func (g *Gateway) abortMultipartUpload(req *request) {
+	if _, ok := g.multiparter(req); !ok {
+		return
+	}
+
+	err := req.store.DeleteWithContext(req.r.Context(), req.key,
+		pairs.WithMultipartID(req.r.URL.Query().Get("uploadId")))
+	if err != nil {
+		g.writeError(req.w, req.r, err, errNoSuchUpload)
+		return
+	}
+	req.w.WriteHeader(http.StatusNoContent)
+}
+
+func (g *Gateway) listParts(req *request) {
+	w, r := req.w, req.r
+	mp, ok := g.multiparter(req)
+	if !ok {
+		return
+	}
+
+	uploadID := r.URL.Query().Get("uploadId")
+	o := req.store.Create(req.key, pairs.WithMultipartID(uploadID))
+
+	it, err := mp.ListMultipartWithContext(r.Context(), o)
+	if err != nil {
+		g.writeError(w, r, err, errNoSuchUpload)
+		return
+	}
+
+	type part struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag,omitempty"`
+		Size       int64  `xml:"Size"`
+	}
+	var parts []part
+	for {
+		p, err := it.Next()
+		if err != nil && errors.Is(err, types.IterateDone) {
+			break
+		}
+		if err != nil {
+			g.writeError(w, r, err, errNoSuchUpload)
+			return
+		}
+		parts = append(parts, part{PartNumber: p.Index + 1, ETag: quote(p.ETag), Size: p.Size})
+	}
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName     xml.Name `xml:"ListPartsResult"`
+		Xmlns       string   `xml:"xmlns,attr"`
+		Bucket      string   `xml:"Bucket"`
+		Key         string   `xml:"Key"`
+		UploadID    string   `xml:"UploadId"`
+		IsTruncated bool     `xml:"IsTruncated"`
+		Parts       []part   `xml:"Part"`
+	}{Xmlns: xmlns, Bucket: req.bucket, Key: req.key, UploadID: uploadID, Parts: parts})
+}
+
+func (g *Gateway) listMultipartUploads(req *request) {
+	w, r := req.w, req.r
+	if _, ok := g.multiparter(req); !ok {
+		return
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+	it, err := req.store.ListWithContext(r.Context(), prefix, pairs.WithListMode(types.ListModePart))
+	if err != nil {
+		g.writeError(w, r, err, nil)
+		return
+	}
+
+	type upload struct {
+		Key          string `xml:"Key"`
+		UploadID     string `xml:"UploadId"`
+		Initiated    string `xml:"Initiated,omitempty"`
+		StorageClass string `xml:"StorageClass"`
+	}
+	var uploads []upload
+	for {
+		o, err := it.Next()
+		if err != nil && errors.Is(err, types.IterateDone) {
+			break
+		}
+		if err != nil {
+			g.writeError(w, r, err, nil)
+			return
+		}
+
+		u := upload{Key: o.Path, UploadID: o.MustGetMultipartID(), StorageClass: "STANDARD"}
+		if v, ok := o.GetLastModified(); ok {
+			u.Initiated = v.UTC().Format(time.RFC3339Nano)
+		}
+		uploads = append(uploads, u)
+	}
+
+	writeXML(w, http.StatusOK, struct {
+		XMLName     xml.Name `xml:"ListMultipartUploadsResult"`
+		Xmlns       string   `xml:"xmlns,attr"`
+		Bucket      string   `xml:"Bucket"`
+		Prefix      string   `xml:"Prefix"`
+		IsTruncated bool     `xml:"IsTruncated"`
+		Uploads     []upload `xml:"Upload"`
+	}{Xmlns: xmlns, Bucket: req.bucket, Prefix: prefix, Uploads: uploads})
+}
+
+func quote(etag string) string {
+	if etag == "" || strings.HasPrefix(etag, `"`) {
+		return etag
+	}
+	return `"` + etag + `"`
+}
@@ -0,0 +1,333 @@
+package s3gateway
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/types"
+)
+
+const xmlns = "http://s3.amazonaws.com/doc/2006-03-01/"
+
+func (g *Gateway) listBuckets(w http.ResponseWriter, r *http.Request) {
+	type bucket struct {
+		Name         string `xml:"Name"`
+		CreationDate string `xml:"CreationDate"`
+	}
+	var resp struct {
+		XMLName xml.Name `xml:"ListAllMyBucketsResult"`
+		Xmlns   string   `xml:"xmlns,attr"`
+		Owner   struct {
+			ID string `xml:"ID"`
+		} `xml:"Owner"`
+		Buckets []bucket `xml:"Buckets>Bucket"`
+	}
+	resp.Xmlns = xmlns
+	resp.Owner.ID = "s3gateway"
+
+	for name := range g.opts.Buckets {
+		resp.Buckets = append(resp.Buckets, bucket{
+			Name:         name,
+			CreationDate: time.Unix(0, 0).UTC().Format(time.RFC3339),
+		})
+	}
+	sort.Slice(resp.Buckets, func(i, j int) bool {
+		return resp.Buckets[i].Name < resp.Buckets[j].Name
+	})
+
+	writeXML(w, http.StatusOK, resp)
+}
+
+func (g *Gateway) getObject(req *request) {
+	w, r := req.w, req.r
+
+	o, err := req.store.StatWithContext(r.Context(), req.key)
+	if err != nil {
+		g.writeError(w, r, err, errNoSuchKey)
+		return
+	}
+	if o.Mode.IsDir() {
+		g.writeError(w, r, errNoSuchKey, nil)
+		return
+	}
+	setObjectHeaders(w.Header(), o)
+
+	size, ok := o.GetContentLength()
+	if !ok {
+		// Without the size, ranges can't be resolved and the whole object is
+		// streamed, which HTTP allows for a Range request too.
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodHead {
+			return
+		}
+		_, err = req.store.ReadWithContext(r.Context(), req.key, w)
+		if err != nil {
+			g.opts.ErrorLog("s3gateway: read %s/%s: %v", req.bucket, req.key, err)
+		}
+		return
+	}
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	offset, length, partial, err := parseRange(r.Header.Get("Range"), size)
+	if err != nil {
+		w.Header().Set("Content-Range", "bytes */"+strconv.FormatInt(size, 10))
+		g.writeError(w, r, err, nil)
+		return
+	}
+
+	w.Header().Set("Content-Length", strconv.FormatInt(length, 10))
+	status := http.StatusOK
+	if partial {
+		status = http.StatusPartialContent
+		w.Header().Set("Content-Range",
+			"bytes "+strconv.FormatInt(offset, 10)+"-"+strconv.FormatInt(offset+length-1, 10)+"/"+strconv.FormatInt(size, 10))
+	}
+	w.WriteHeader(status)
+
+	if r.Method == http.MethodHead || length == 0 {
+		return
+	}
+
+	ps := []types.Pair{pairs.WithOffset(offset), pairs.WithSize(length)}
+	if !partial {
+		ps = nil
+	}
+	_, err = req.store.ReadWithContext(r.Context(), req.key, w, ps...)
+	if err != nil {
+		// The status has been sent, the client will see a truncated body.
+		g.opts.ErrorLog("s3gateway: read %s/%s: %v", req.bucket, req.key, err)
+	}
+}
+
+func (g *Gateway) putObject(req *request) {
+	w, r := req.w, req.r
+
+	if r.Header.Get("X-Amz-Copy-Source") != "" {
+		g.writeError(w, r, errNotImplemented, nil)
+		return
+	}
+
+	size, err := g.contentLength(r)
+	if err != nil {
+		g.writeError(w, r, err, nil)
+		return
+	}
+
+	body, sum, err := withContentMD5(r, req.body, size)
+	if err != nil {
+		g.writeError(w, r, err, nil)
+		return
+	}
+
+	// The checksums and chunk signatures are only verified at the end of the
+	// body, so it's staged first to keep a bad body from replacing the
+	// object.
+	f, err := g.stage(body, size)
+	if err != nil {
+		g.writeError(w, r, err, nil)
+		return
+	}
+	defer func() {
+		f.Close()
+		_ = os.Remove(f.Name())
+	}()
+
+	ps := make([]types.Pair, 0, 1)
+	if v := r.Header.Get("Content-Type"); v != "" {
+		ps = append(ps, pairs.WithContentType(v))
+	}
+
+	_, err = req.store.WriteWithContext(r.Context(), req.key, f, size, ps...)
+	if err != nil {
+		g.writeError(w, r, err, nil)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum.Sum(nil))+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (g *Gateway) deleteObject(req *request) {
+	err := req.store.DeleteWithContext(req.r.Context(), req.key)
+	if err != nil {
+		g.writeError(req.w, req.r, err, errNoSuchKey)
+		return
+	}
+	req.w.WriteHeader(http.StatusNoContent)
+}
+
+// stage copies body into a temp file in Options.TempDir, which is returned
+// at offset 0 once the whole body has been read and verified.
+func (g *Gateway) stage(body io.Reader, size int64) (*os.File, error) {
+	f, err := ioutil.TempFile(g.opts.TempDir, "s3gateway-")
+	if err != nil {
+		return nil, err
+	}
+	n, err := io.Copy(f, body)
+	if err == nil && n != size {
+		err = errIncompleteBody
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		_ = os.Remove(f.Name())
+		return nil, err
+	}
+	return f, nil
+}
+
+// contentLength returns the decoded size of the request body.
+func (g *Gateway) contentLength(r *http.Request) (int64, error) {
+	v := r.Header.Get("X-Amz-Decoded-Content-Length")
+	if v == "" {
+		if r.ContentLength < 0 {
+			return 0, errMissingContentLength
+		}
+		v = strconv.FormatInt(r.ContentLength, 10)
+	}
+
+	size, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || size < 0 {
+		return 0, errMissingContentLength
+	}
+	if size > g.opts.MaxObjectSize {
+		return 0, errEntityTooLarge
+	}
+	return size, nil
+}
+
+// withContentMD5 returns a reader which computes the MD5 of body, it also
+// verifies the Content-MD5 header if present.
+func withContentMD5(r *http.Request, body io.Reader, size int64) (io.Reader, hash.Hash, error) {
+	sum := md5.New()
+	v := r.Header.Get("Content-Md5")
+	if v == "" {
+		return io.TeeReader(body, sum), sum, nil
+	}
+
+	want, err := base64.StdEncoding.DecodeString(v)
+	if err != nil || len(want) != md5.Size {
+		return nil, nil, errInvalidArgument
+	}
+	return &md5Reader{r: body, h: sum, want: want, remaining: size}, sum, nil
+}
+
+// md5Reader is the same as hashReader, but fails with BadDigest.
+type md5Reader struct {
+	r         io.Reader
+	h         hash.Hash
+	want      []byte
+	remaining int64
+}
+
+func (m *md5Reader) Read(p []byte) (int, error) {
+	n, err := m.r.Read(p)
+	m.h.Write(p[:n])
+	m.remaining -= int64(n)
+	if (m.remaining == 0 || err == io.EOF) && !bytes.Equal(m.h.Sum(nil), m.want) {
+		return n, errBadDigest
+	}
+	return n, err
+}
+
+func setObjectHeaders(h http.Header, o *types.Object) {
+	if v, ok := o.GetEtag(); ok && v != "" {
+		h.Set("ETag", quote(v))
+	}
+	if v, ok := o.GetLastModified(); ok {
+		h.Set("Last-Modified", v.UTC().Format(http.TimeFormat))
+	}
+	if v, ok := o.GetContentType(); ok && v != "" {
+		h.Set("Content-Type", v)
+	} else {
+		h.Set("Content-Type", "binary/octet-stream")
+	}
+}
+
+// parseRange parses a single byte range as supported by S3.
+func parseRange(v string, size int64) (offset, length int64, partial bool, err error) {
+	if v == "" {
+		return 0, size, false, nil
+	}
+	if !strings.HasPrefix(v, "bytes=") || strings.Contains(v, ",") {
+		// S3 ignores the header if it's not a valid single range.
+		return 0, size, false, nil
+	}
+
+	spec := strings.SplitN(strings.TrimPrefix(v, "bytes="), "-", 2)
+	if len(spec) != 2 {
+		return 0, size, false, nil
+	}
+	start, end := strings.TrimSpace(spec[0]), strings.TrimSpace(spec[1])
+
+	switch {
+	case start == "":
+		// bytes=-n, the last n bytes.
+		n, err := strconv.ParseInt(end, 10, 64)
+		if err != nil || n <= 0 {
+			return 0, 0, false, errInvalidRange
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, n, true, nil
+	default:
+		first, err := strconv.ParseInt(start, 10, 64)
+		if err != nil || first < 0 || first >= size {
+			return 0, 0, false, errInvalidRange
+		}
+		last := size - 1
+		if end != "" {
+			last, err = strconv.ParseInt(end, 10, 64)
+			if err != nil || last < first {
+				return 0, 0, false, errInvalidRange
+			}
+			if last >= size {
+				last = size - 1
+			}
+		}
+		return first, last - first + 1, true, nil
+	}
+}
+
+func writeXML(w http.ResponseWriter, status int, v interface{}) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(&buf).Encode(v); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
+
+func readXML(r io.Reader, v interface{}) error {
+	err := xml.NewDecoder(io.LimitReader(r, 1024*1024)).Decode(v)
+	var e *apiError
+	if errors.As(err, &e) {
+		return e
+	}
+	if err != nil {
+		return errMalformedXML
+	}
+	return nil
+}
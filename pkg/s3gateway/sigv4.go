@@ -0,0 +1,371 @@
+package s3gateway
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sigV4Algorithm   = "AWS4-HMAC-SHA256"
+	amzDateFormat    = "20060102T150405Z"
+	unsignedPayload  = "UNSIGNED-PAYLOAD"
+	streamingPayload = "STREAMING-AWS4-HMAC-SHA256-PAYLOAD"
+	emptySHA256      = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+	// maxClockSkew is the same as the one allowed by AWS.
+	maxClockSkew = 15 * time.Minute
+)
+
+// signature is the parsed result of a SigV4 signed request.
+type signature struct {
+	accessKey     string
+	date          string // yyyymmdd
+	region        string
+	service       string
+	signedHeaders []string
+	signature     string
+	amzDate       time.Time
+	payloadHash   string
+	expires       time.Duration // only for presigned URL
+}
+
+func (s *signature) scope() string {
+	return strings.Join([]string{s.date, s.region, s.service, "aws4_request"}, "/")
+}
+
+// verify checks the SigV4 signature of r against keys, which maps access
+// keys to secret keys.
+//
+// The returned body must be used instead of r.Body: it verifies the payload
+// hash, or decodes and verifies aws-chunked payloads.
+func verify(r *http.Request, keys map[string]string, now time.Time) (io.Reader, error) {
+	var sig *signature
+	var err error
+	if r.URL.Query().Get("X-Amz-Algorithm") != "" {
+		sig, err = parsePresigned(r)
+	} else {
+		sig, err = parseAuthorization(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	secret, ok := keys[sig.accessKey]
+	if !ok {
+		return nil, errInvalidAccessKeyID
+	}
+
+	if sig.expires > 0 {
+		if now.After(sig.amzDate.Add(sig.expires)) {
+			return nil, errExpiredRequest
+		}
+	} else if d := now.Sub(sig.amzDate); d > maxClockSkew || d < -maxClockSkew {
+		return nil, errRequestTimeTooSkewed
+	}
+
+	key := signingKey(secret, sig.date, sig.region, sig.service)
+	expected := hex.EncodeToString(hmacSHA256(key, stringToSign(sig, canonicalRequest(r, sig))))
+	if !hmac.Equal([]byte(expected), []byte(sig.signature)) {
+		return nil, errSignatureDoesNotMatch
+	}
+
+	switch sig.payloadHash {
+	case unsignedPayload:
+		return r.Body, nil
+	case streamingPayload:
+		return newChunkedReader(r.Body, key, sig, expected), nil
+	default:
+		want, err := hex.DecodeString(sig.payloadHash)
+		if err != nil || len(want) != sha256.Size {
+			return nil, errInvalidDigest
+		}
+		return &hashReader{r: r.Body, h: sha256.New(), want: want, remaining: r.ContentLength}, nil
+	}
+}
+
+func parseAuthorization(r *http.Request) (*signature, error) {
+	auth := r.Header.Get("Authorization")
+	if auth == "" {
+		return nil, errAccessDenied
+	}
+	if !strings.HasPrefix(auth, sigV4Algorithm+" ") {
+		return nil, errUnsupportedSignature
+	}
+
+	sig := &signature{}
+	for _, field := range strings.Split(strings.TrimPrefix(auth, sigV4Algorithm+" "), ",") {
+		kv := strings.SplitN(strings.TrimSpace(field), "=", 2)
+		if len(kv) != 2 {
+			return nil, errAuthorizationHeaderMalformed
+		}
+		switch kv[0] {
+		case "Credential":
+			if err := sig.parseCredential(kv[1]); err != nil {
+				return nil, err
+			}
+		case "SignedHeaders":
+			sig.signedHeaders = strings.Split(kv[1], ";")
+		case "Signature":
+			sig.signature = kv[1]
+		}
+	}
+	if sig.accessKey == "" || len(sig.signedHeaders) == 0 || sig.signature == "" {
+		return nil, errAuthorizationHeaderMalformed
+	}
+
+	t, err := time.Parse(amzDateFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, errAuthorizationHeaderMalformed
+	}
+	sig.amzDate = t
+
+	sig.payloadHash = r.Header.Get("X-Amz-Content-Sha256")
+	if sig.payloadHash == "" {
+		return nil, errInvalidDigest
+	}
+	return sig, nil
+}
+
+func parsePresigned(r *http.Request) (*signature, error) {
+	q := r.URL.Query()
+	if q.Get("X-Amz-Algorithm") != sigV4Algorithm {
+		return nil, errUnsupportedSignature
+	}
+
+	sig := &signature{
+		signedHeaders: strings.Split(q.Get("X-Amz-SignedHeaders"), ";"),
+		signature:     q.Get("X-Amz-Signature"),
+		payloadHash:   unsignedPayload,
+	}
+	if err := sig.parseCredential(q.Get("X-Amz-Credential")); err != nil {
+		return nil, err
+	}
+
+	t, err := time.Parse(amzDateFormat, q.Get("X-Amz-Date"))
+	if err != nil {
+		return nil, errAuthorizationQueryParametersError
+	}
+	sig.amzDate = t
+
+	expires, err := strconv.ParseInt(q.Get("X-Amz-Expires"), 10, 64)
+	if err != nil || expires <= 0 || expires > 7*24*3600 {
+		return nil, errAuthorizationQueryParametersError
+	}
+	sig.expires = time.Duration(expires) * time.Second
+
+	if sig.signature == "" {
+		return nil, errAuthorizationQueryParametersError
+	}
+	return sig, nil
+}
+
+// parseCredential parses `<access_key>/<date>/<region>/<service>/aws4_request`.
+func (s *signature) parseCredential(v string) error {
+	parts := strings.Split(v, "/")
+	if len(parts) != 5 || parts[4] != "aws4_request" {
+		return errAuthorizationHeaderMalformed
+	}
+	s.accessKey, s.date, s.region, s.service = parts[0], parts[1], parts[2], parts[3]
+	return nil
+}
+
+func canonicalRequest(r *http.Request, sig *signature) string {
+	headers := make([]string, 0, len(sig.signedHeaders))
+	for _, name := range sig.signedHeaders {
+		var value string
+		if name == "host" {
+			value = r.Host
+		} else {
+			var values []string
+			for _, v := range r.Header.Values(name) {
+				values = append(values, strings.Join(strings.Fields(v), " "))
+			}
+			value = strings.Join(values, ",")
+		}
+		headers = append(headers, name+":"+value+"\n")
+	}
+
+	return strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		canonicalQuery(r.URL.Query()),
+		strings.Join(headers, ""),
+		strings.Join(sig.signedHeaders, ";"),
+		sig.payloadHash,
+	}, "\n")
+}
+
+func canonicalQuery(q url.Values) string {
+	params := make([]string, 0, len(q))
+	for k, vs := range q {
+		if k == "X-Amz-Signature" {
+			continue
+		}
+		for _, v := range vs {
+			params = append(params, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+func stringToSign(sig *signature, canonical string) string {
+	sum := sha256.Sum256([]byte(canonical))
+	return strings.Join([]string{
+		sigV4Algorithm,
+		sig.amzDate.Format(amzDateFormat),
+		sig.scope(),
+		hex.EncodeToString(sum[:]),
+	}, "\n")
+}
+
+func signingKey(secret, date, region, service string) []byte {
+	k := hmacSHA256([]byte("AWS4"+secret), date)
+	k = hmacSHA256(k, region)
+	k = hmacSHA256(k, service)
+	return hmacSHA256(k, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// uriEncode implements the UriEncode function described by SigV4, which only
+// leaves unreserved characters as is.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// hashReader checks the SHA-256 of the content once all bytes are read.
+//
+// Services usually read exactly `size` bytes without hitting EOF, so the
+// check happens as soon as `remaining` reaches zero. With an unknown
+// length, `remaining` starts at -1 and never reaches zero, so the check
+// only happens at EOF.
+type hashReader struct {
+	r         io.Reader
+	h         hash.Hash
+	want      []byte
+	remaining int64
+}
+
+func (h *hashReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	h.h.Write(p[:n])
+	h.remaining -= int64(n)
+	if (h.remaining == 0 || err == io.EOF) && !bytes.Equal(h.h.Sum(nil), h.want) {
+		return n, errXAmzContentSHA256Mismatch
+	}
+	return n, err
+}
+
+// chunkedReader decodes an aws-chunked body and verifies the signature of
+// every chunk, which is chained from the seed signature of the request.
+// Without key, chunks are decoded but not verified.
+//
+// Every chunk is formatted as `<hex size>;chunk-signature=<sig>\r\n<data>\r\n`
+// and the body ends with a zero sized chunk.
+type chunkedReader struct {
+	r       *bufio.Reader
+	key     []byte
+	sig     *signature
+	prevSig string
+
+	buf  []byte
+	done bool
+}
+
+func newChunkedReader(body io.Reader, key []byte, sig *signature, seed string) *chunkedReader {
+	return &chunkedReader{r: bufio.NewReader(body), key: key, sig: sig, prevSig: seed}
+}
+
+func (c *chunkedReader) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		if err := c.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	if len(c.buf) == 0 && !c.done {
+		// Read the next chunk eagerly, so that the final chunk is verified
+		// even if the caller stops reading after the decoded length.
+		if err := c.next(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+func (c *chunkedReader) next() error {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return errIncompleteBody
+	}
+	header := strings.SplitN(strings.TrimRight(line, "\r\n"), ";chunk-signature=", 2)
+	if len(header) != 2 {
+		return errIncompleteBody
+	}
+	size, err := strconv.ParseInt(header[0], 16, 64)
+	if err != nil || size < 0 || size > 16*1024*1024 {
+		return errIncompleteBody
+	}
+
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(c.r, data); err != nil || string(data[size:]) != "\r\n" {
+		return errIncompleteBody
+	}
+	data = data[:size]
+
+	if c.key != nil {
+		sum := sha256.Sum256(data)
+		toSign := strings.Join([]string{
+			"AWS4-HMAC-SHA256-PAYLOAD",
+			c.sig.amzDate.Format(amzDateFormat),
+			c.sig.scope(),
+			c.prevSig,
+			emptySHA256,
+			hex.EncodeToString(sum[:]),
+		}, "\n")
+		expected := hex.EncodeToString(hmacSHA256(c.key, toSign))
+		if !hmac.Equal([]byte(expected), []byte(header[1])) {
+			return errSignatureDoesNotMatch
+		}
+		c.prevSig = expected
+	}
+
+	c.buf = data
+	c.done = size == 0
+	return nil
+}
@@ -0,0 +1,168 @@
+package spool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Every item is stored as <seq>.json, and <seq>.data for writes. The data is
+// written first, so an item is committed once its json exists. Files are
+// written to a .tmp file and renamed, so a crash never leaves a partial file
+// under the final name.
+const (
+	metaExt = ".json"
+	dataExt = ".data"
+	tmpExt  = ".tmp"
+)
+
+func (s *Spool) name(seq uint64, ext string) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, ext))
+}
+
+// writeData copies size bytes of r to the data file of seq.
+func (s *Spool) writeData(seq uint64, r io.Reader, size int64) error {
+	name := s.name(seq, dataExt)
+	return writeFile(name, func(f *os.File) error {
+		n, err := io.Copy(f, io.LimitReader(r, size))
+		if err != nil {
+			return err
+		}
+		if n != size {
+			return fmt.Errorf("got %d bytes, expected %d: %w", n, size, io.ErrUnexpectedEOF)
+		}
+		return nil
+	})
+}
+
+// writeMeta commits the item.
+func (s *Spool) writeMeta(it *Item) error {
+	content, err := json.Marshal(it)
+	if err != nil {
+		return err
+	}
+	return writeFile(s.name(it.Seq, metaExt), func(f *os.File) error {
+		_, err := f.Write(content)
+		return err
+	})
+}
+
+// remove removes the files of an item, the json first so that a crash in
+// between only leaves an orphan data file.
+func (s *Spool) remove(seq uint64) {
+	for _, ext := range []string{metaExt, dataExt} {
+		err := os.Remove(s.name(seq, ext))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			s.opts.ErrorLog("spool: remove %s: %v", s.name(seq, ext), err)
+		}
+	}
+}
+
+// writeFile writes name atomically and durably.
+func writeFile(name string, fn func(f *os.File) error) error {
+	tmp := name + tmpExt
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	err = fn(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, name)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return syncDir(filepath.Dir(name))
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	// Some file systems don't support syncing a directory, the rename is
+	// still done.
+	_ = d.Sync()
+	return nil
+}
+
+// recover loads the items left by a previous run, and removes the files of
+// uncommitted items.
+func (s *Spool) recover() error {
+	fis, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+
+	metas := make(map[uint64]bool)
+	datas := make(map[uint64]bool)
+	for _, fi := range fis {
+		name := fi.Name()
+		if strings.HasSuffix(name, tmpExt) {
+			_ = os.Remove(filepath.Join(s.dir, name))
+			continue
+		}
+		ext := filepath.Ext(name)
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch ext {
+		case metaExt:
+			metas[seq] = true
+		case dataExt:
+			datas[seq] = true
+		}
+		if seq >= s.seq {
+			s.seq = seq
+		}
+	}
+
+	for seq := range datas {
+		if !metas[seq] {
+			// Crashed before the item was committed, it was never
+			// acknowledged.
+			_ = os.Remove(s.name(seq, dataExt))
+		}
+	}
+
+	var items []*Item
+	for seq := range metas {
+		content, err := ioutil.ReadFile(s.name(seq, metaExt))
+		if err != nil {
+			return err
+		}
+		it := &Item{}
+		if err := json.Unmarshal(content, it); err != nil || it.Seq != seq || (it.Op == OpWrite && !datas[seq]) {
+			s.opts.ErrorLog("spool: drop corrupted item %s", s.name(seq, metaExt))
+			s.remove(seq)
+			continue
+		}
+		if it.State == StateUploading {
+			it.State = StatePending
+		}
+		items = append(items, it)
+	}
+
+	sort.Slice(items, func(i, j int) bool { return items[i].Seq < items[j].Seq })
+	for _, it := range items {
+		s.insert(it)
+	}
+	return nil
+}
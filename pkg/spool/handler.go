@@ -0,0 +1,29 @@
+package spool
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Handler returns an http.Handler reporting the Status as JSON on GET. A
+// POST makes the failed items pending again, and reports the Status after.
+func (s *Spool) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead:
+		case http.MethodPost:
+			s.Retry()
+		default:
+			w.Header().Set("Allow", "GET, HEAD, POST")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if r.Method == http.MethodHead {
+			return
+		}
+		_ = json.NewEncoder(w).Encode(s.Status())
+	})
+}
@@ -0,0 +1,407 @@
+// Package spool stages writes to a storager in a local directory, and uploads
+// them in the background.
+//
+// Write and Delete return as soon as the operation is durably recorded in
+// the spool. Operations are uploaded in order per path, and retried with
+// backoff until they succeed or run out of attempts. A newer operation on a
+// path replaces the older ones which haven't started uploading yet.
+//
+// Items left in the spool by a crash or a Close are uploaded by the next
+// Spool on the same directory. A directory must not be used by several
+// Spools at once.
+package spool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+const (
+	defaultWorkers     = 4
+	defaultMaxAttempts = 10
+	defaultMinBackoff  = time.Second
+	defaultMaxBackoff  = 5 * time.Minute
+)
+
+// Operations of an Item.
+const (
+	OpWrite  = "write"
+	OpDelete = "delete"
+)
+
+// States of an Item.
+const (
+	StatePending   = "pending"
+	StateUploading = "uploading"
+	StateFailed    = "failed"
+)
+
+// ErrClosed is returned by operations on a closed Spool.
+var ErrClosed = errors.New("spool closed")
+
+// Options configures a Spool.
+type Options struct {
+	// Workers is the number of concurrent uploads, default to 4.
+	Workers int
+	// MaxAttempts is the number of attempts before an item is failed,
+	// default to 10. Negative value retries forever.
+	MaxAttempts int
+	// MinBackoff is the delay after the first failed attempt, doubled on
+	// every attempt up to MaxBackoff. Default to 1s and 5m.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// ErrorLog logs failed attempts, default to discard.
+	ErrorLog func(format string, v ...interface{})
+}
+
+// Item is an operation in the spool.
+type Item struct {
+	Seq  uint64 `json:"seq"`
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+	// Pairs are the pairs given to Write, only string values are kept.
+	Pairs       map[string]string `json:"pairs,omitempty"`
+	State       string            `json:"state"`
+	Attempts    int               `json:"attempts"`
+	LastError   string            `json:"last_error,omitempty"`
+	Created     time.Time         `json:"created"`
+	NextAttempt time.Time         `json:"next_attempt"`
+}
+
+// Spool is a types.Storager staging writes to backend in a local directory.
+type Spool struct {
+	types.UnimplementedStorager
+
+	dir     string
+	backend types.Storager
+	opts    Options
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu      sync.Mutex
+	seq     uint64
+	items   []*Item
+	busy    map[string]bool
+	closed  bool
+	wake    chan struct{}
+	changed chan struct{}
+}
+
+// New creates a Spool in dir uploading to backend, and starts uploading the
+// items left by a previous run.
+func New(dir string, backend types.Storager, opts Options) (*Spool, error) {
+	if opts.Workers <= 0 {
+		opts.Workers = defaultWorkers
+	}
+	if opts.MaxAttempts == 0 {
+		opts.MaxAttempts = defaultMaxAttempts
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = defaultMinBackoff
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = defaultMaxBackoff
+	}
+	if opts.ErrorLog == nil {
+		opts.ErrorLog = func(string, ...interface{}) {}
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("spool: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Spool{
+		dir:     dir,
+		backend: backend,
+		opts:    opts,
+		ctx:     ctx,
+		cancel:  cancel,
+		busy:    make(map[string]bool),
+		wake:    make(chan struct{}, 1),
+		changed: make(chan struct{}),
+	}
+	if err := s.recover(); err != nil {
+		cancel()
+		return nil, fmt.Errorf("spool: recover %s: %w", dir, err)
+	}
+
+	for i := 0; i < opts.Workers; i++ {
+		s.wg.Add(1)
+		go s.worker()
+	}
+	return s, nil
+}
+
+// Close stops uploading. Uploads in progress are canceled and, like pending
+// items, resumed by the next Spool on the directory. Use Flush before Close
+// to wait for pending items.
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	s.cancel()
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Spool) String() string {
+	return fmt.Sprintf("Spool {Dir: %s, Backend: %s}", s.dir, s.backend)
+}
+
+func (s *Spool) Metadata(pairs ...types.Pair) *types.StorageMeta {
+	return s.backend.Metadata(pairs...)
+}
+
+func (s *Spool) Create(path string, pairs ...types.Pair) *types.Object {
+	return s.backend.Create(path, pairs...)
+}
+
+func (s *Spool) Write(path string, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	return s.WriteWithContext(context.Background(), path, r, size, pairs...)
+}
+
+// WriteWithContext stores the content in the spool, and returns once it's
+// synced to the local disk.
+//
+// Only pairs with string values, like content_type, are supported since
+// pairs are stored along with the content.
+func (s *Spool) WriteWithContext(ctx context.Context, path string, r io.Reader, size int64, pairs ...types.Pair) (int64, error) {
+	ps := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		v, ok := p.Value.(string)
+		if !ok {
+			return 0, fmt.Errorf("spool: write %s: pair %s: %w", path, p.Key, services.ErrCapabilityInsufficient)
+		}
+		ps[p.Key] = v
+	}
+
+	seq, err := s.nextSeq()
+	if err != nil {
+		return 0, err
+	}
+	if err := s.writeData(seq, &ctxReader{ctx: ctx, r: r}, size); err != nil {
+		return 0, fmt.Errorf("spool: write %s: %w", path, err)
+	}
+
+	it := &Item{Seq: seq, Op: OpWrite, Path: path, Size: size, Pairs: ps}
+	if err := s.commit(it); err != nil {
+		return 0, fmt.Errorf("spool: write %s: %w", path, err)
+	}
+	return size, nil
+}
+
+func (s *Spool) Delete(path string, pairs ...types.Pair) error {
+	return s.DeleteWithContext(context.Background(), path, pairs...)
+}
+
+// DeleteWithContext records the deletion in the spool. Pairs are not
+// supported.
+func (s *Spool) DeleteWithContext(ctx context.Context, path string, pairs ...types.Pair) error {
+	if len(pairs) > 0 {
+		return fmt.Errorf("spool: delete %s: pairs: %w", path, services.ErrCapabilityInsufficient)
+	}
+
+	seq, err := s.nextSeq()
+	if err != nil {
+		return err
+	}
+	it := &Item{Seq: seq, Op: OpDelete, Path: path}
+	if err := s.commit(it); err != nil {
+		return fmt.Errorf("spool: delete %s: %w", path, err)
+	}
+	return nil
+}
+
+func (s *Spool) Read(path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	return s.ReadWithContext(context.Background(), path, w, pairs...)
+}
+
+// ReadWithContext reads the latest content in the spool, or from the backend
+// if the path has no pending item.
+func (s *Spool) ReadWithContext(ctx context.Context, path string, w io.Writer, pairs ...types.Pair) (int64, error) {
+	it := s.latest(path)
+	if it == nil {
+		return s.backend.ReadWithContext(ctx, path, w, pairs...)
+	}
+	if it.Op == OpDelete {
+		return 0, fmt.Errorf("spool: read %s: %w", path, services.ErrObjectNotExist)
+	}
+
+	f, err := os.Open(s.name(it.Seq, dataExt))
+	if err != nil && errors.Is(err, os.ErrNotExist) {
+		// Uploaded in the meantime.
+		return s.backend.ReadWithContext(ctx, path, w, pairs...)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("spool: read %s: %w", path, err)
+	}
+	defer f.Close()
+
+	offset, size := readRange(pairs, it.Size)
+	return io.Copy(w, &ctxReader{ctx: ctx, r: io.NewSectionReader(f, offset, size)})
+}
+
+func (s *Spool) Stat(path string, pairs ...types.Pair) (*types.Object, error) {
+	return s.StatWithContext(context.Background(), path, pairs...)
+}
+
+// StatWithContext stats the latest item in the spool, or the backend if the
+// path has no pending item.
+func (s *Spool) StatWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.Object, error) {
+	it := s.latest(path)
+	if it == nil {
+		return s.backend.StatWithContext(ctx, path, pairs...)
+	}
+	if it.Op == OpDelete {
+		return nil, fmt.Errorf("spool: stat %s: %w", path, services.ErrObjectNotExist)
+	}
+
+	o := s.backend.Create(path)
+	o.Mode = types.ModeRead
+	o.SetContentLength(it.Size)
+	o.SetLastModified(it.Created)
+	if v, ok := it.Pairs["content_type"]; ok {
+		o.SetContentType(v)
+	}
+	return o, nil
+}
+
+func (s *Spool) List(path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	return s.ListWithContext(context.Background(), path, pairs...)
+}
+
+// ListWithContext lists the backend, items in the spool are not listed until
+// uploaded.
+func (s *Spool) ListWithContext(ctx context.Context, path string, pairs ...types.Pair) (*types.ObjectIterator, error) {
+	return s.backend.ListWithContext(ctx, path, pairs...)
+}
+
+func (s *Spool) nextSeq() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return 0, ErrClosed
+	}
+	s.seq++
+	return s.seq, nil
+}
+
+// commit records the item on disk, and queues it for upload.
+func (s *Spool) commit(it *Item) error {
+	it.State = StatePending
+	it.Created = time.Now()
+	if err := s.writeMeta(it); err != nil {
+		s.remove(it.Seq)
+		return err
+	}
+
+	s.mu.Lock()
+	s.insert(it)
+	s.notifyLocked()
+	s.mu.Unlock()
+	return nil
+}
+
+// insert adds the item in order, and drops the items it replaces. Items
+// being uploaded are kept, the new item waits for them to finish.
+func (s *Spool) insert(it *Item) {
+	for _, old := range s.items {
+		if old.Path == it.Path && old.Seq > it.Seq {
+			// A newer item has been committed first.
+			s.remove(it.Seq)
+			return
+		}
+	}
+
+	items := s.items[:0]
+	for _, old := range s.items {
+		if old.Path == it.Path && old.State != StateUploading {
+			s.remove(old.Seq)
+			continue
+		}
+		items = append(items, old)
+	}
+
+	i := sort.Search(len(items), func(i int) bool { return items[i].Seq > it.Seq })
+	items = append(items, nil)
+	copy(items[i+1:], items[i:])
+	items[i] = it
+	s.items = items
+}
+
+// latest returns a copy of the newest item of path.
+func (s *Spool) latest(path string) *Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.items) - 1; i >= 0; i-- {
+		if it := s.items[i]; it.Path == path {
+			c := *it
+			return &c
+		}
+	}
+	return nil
+}
+
+// notifyLocked wakes a worker and the Flush callers.
+func (s *Spool) notifyLocked() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// readRange returns the offset and size pairs within an object of total
+// size.
+func readRange(ps []types.Pair, total int64) (offset, size int64) {
+	size = -1
+	for _, p := range ps {
+		switch p.Key {
+		case "offset":
+			offset = p.Value.(int64)
+		case "size":
+			size = p.Value.(int64)
+		}
+	}
+	if offset > total {
+		offset = total
+	}
+	if size < 0 || offset+size > total {
+		size = total - offset
+	}
+	return offset, size
+}
+
+// ctxReader stops reading once ctx is done.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
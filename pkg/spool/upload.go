@@ -0,0 +1,246 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+// Status is a snapshot of the items in the spool.
+type Status struct {
+	Pending   int    `json:"pending"`
+	Uploading int    `json:"uploading"`
+	Failed    int    `json:"failed"`
+	Items     []Item `json:"items"`
+}
+
+// Status returns all items in the spool, in upload order.
+func (s *Spool) Status() Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := Status{Items: make([]Item, 0, len(s.items))}
+	for _, it := range s.items {
+		switch it.State {
+		case StatePending:
+			st.Pending++
+		case StateUploading:
+			st.Uploading++
+		case StateFailed:
+			st.Failed++
+		}
+		st.Items = append(st.Items, *it)
+	}
+	return st
+}
+
+// Retry makes the failed items pending again, and returns their number.
+func (s *Spool) Retry() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, it := range s.items {
+		if it.State != StateFailed {
+			continue
+		}
+		it.State = StatePending
+		it.Attempts = 0
+		it.NextAttempt = time.Time{}
+		s.persistLocked(it)
+		n++
+	}
+	if n > 0 {
+		s.notifyLocked()
+	}
+	return n
+}
+
+// Flush waits until no item is pending or uploading. Failed items don't
+// block Flush, it returns an error reporting them.
+func (s *Spool) Flush(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		failed, waiting := 0, 0
+		for _, it := range s.items {
+			if it.State == StateFailed {
+				failed++
+			} else {
+				waiting++
+			}
+		}
+		changed := s.changed
+		closed := s.closed
+		s.mu.Unlock()
+
+		if waiting == 0 && failed > 0 {
+			return fmt.Errorf("spool: %d items failed", failed)
+		}
+		if waiting == 0 {
+			return nil
+		}
+		if closed {
+			return ErrClosed
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Spool) worker() {
+	defer s.wg.Done()
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		it, wait := s.next()
+		if it != nil {
+			s.finish(it, s.upload(it))
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if wait <= 0 {
+			wait = time.Hour
+		}
+		timer.Reset(wait)
+
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// next picks the first item ready for upload, and returns a copy of it. If
+// none is ready, it returns how long until an item in backoff is ready.
+func (s *Spool) next() (*Item, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, 0
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	for _, it := range s.items {
+		if it.State != StatePending || s.busy[it.Path] {
+			continue
+		}
+		if d := it.NextAttempt.Sub(now); d > 0 {
+			if wait == 0 || d < wait {
+				wait = d
+			}
+			continue
+		}
+
+		it.State = StateUploading
+		s.busy[it.Path] = true
+		c := *it
+		return &c, 0
+	}
+	return nil, wait
+}
+
+func (s *Spool) upload(it *Item) error {
+	if it.Op == OpDelete {
+		err := s.backend.DeleteWithContext(s.ctx, it.Path)
+		if err != nil && !errors.Is(err, services.ErrObjectNotExist) {
+			return err
+		}
+		return nil
+	}
+
+	f, err := os.Open(s.name(it.Seq, dataExt))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ps := make([]types.Pair, 0, len(it.Pairs))
+	for k, v := range it.Pairs {
+		ps = append(ps, types.Pair{Key: k, Value: v})
+	}
+	_, err = s.backend.WriteWithContext(s.ctx, it.Path, f, it.Size, ps...)
+	return err
+}
+
+// finish removes the uploaded item, or schedules the next attempt.
+func (s *Spool) finish(c *Item, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.busy, c.Path)
+	defer s.notifyLocked()
+
+	idx := -1
+	for i, it := range s.items {
+		if it.Seq == c.Seq {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return
+	}
+	it := s.items[idx]
+
+	if err == nil {
+		s.remove(it.Seq)
+		s.items = append(s.items[:idx], s.items[idx+1:]...)
+		return
+	}
+
+	it.State = StatePending
+	if s.ctx.Err() != nil {
+		// Canceled by Close, not an attempt.
+		return
+	}
+
+	it.Attempts++
+	it.LastError = err.Error()
+	s.opts.ErrorLog("spool: %s %s to %s (attempt %d): %v", it.Op, it.Path, s.backend, it.Attempts, err)
+	if s.opts.MaxAttempts > 0 && it.Attempts >= s.opts.MaxAttempts {
+		it.State = StateFailed
+	} else {
+		it.NextAttempt = time.Now().Add(s.backoff(it.Attempts))
+	}
+	s.persistLocked(it)
+}
+
+func (s *Spool) backoff(attempts int) time.Duration {
+	d := s.opts.MinBackoff
+	for i := 1; i < attempts && d < s.opts.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > s.opts.MaxBackoff {
+		d = s.opts.MaxBackoff
+	}
+	return d
+}
+
+// persistLocked records the state of the item, so that attempts and failures
+// survive restarts.
+func (s *Spool) persistLocked(it *Item) {
+	if err := s.writeMeta(it); err != nil {
+		s.opts.ErrorLog("spool: record %s: %v", it.Path, err)
+	}
+}
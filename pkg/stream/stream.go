@@ -0,0 +1,220 @@
+// Package stream writes readers of unknown size to storagers.
+//
+// The first PartSize bytes are buffered: a reader ending within them is
+// written by a single Write. Longer readers are uploaded part by part via
+// types.Multiparter, or types.Appender if the storager has no multipart
+// support, so memory stays bounded by PartSize times Concurrency.
+package stream
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"go.beyondstorage.io/v5/pairs"
+	"go.beyondstorage.io/v5/services"
+	"go.beyondstorage.io/v5/types"
+)
+
+const (
+	defaultPartSize    = 8 * 1024 * 1024
+	defaultConcurrency = 4
+	defaultMaxParts    = 10000
+)
+
+// ErrTooManyParts means the reader is longer than PartSize times MaxParts.
+var ErrTooManyParts = errors.New("too many parts")
+
+// Options configures Write.
+type Options struct {
+	// PartSize is the size of parts and of the first buffer, default to
+	// 8 MiB. It must be at least the minimum part size of the service.
+	PartSize int64
+	// Concurrency is the number of parts uploaded at once, default to 4.
+	Concurrency int
+	// MaxParts is the maximum number of parts of the service, default to
+	// 10000.
+	MaxParts int
+}
+
+func (opts *Options) setDefaults() {
+	if opts.PartSize <= 0 {
+		opts.PartSize = defaultPartSize
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.MaxParts <= 0 {
+		opts.MaxParts = defaultMaxParts
+	}
+}
+
+// Write writes r to path until EOF, and returns the number of bytes
+// written. Pairs are given to Write, CreateMultipart or CreateAppend.
+//
+// If r or the storager fails, the multipart upload is aborted, or the
+// object being appended deleted.
+func Write(ctx context.Context, store types.Storager, path string, r io.Reader, opts Options, ps ...types.Pair) (int64, error) {
+	opts.setDefaults()
+
+	first := make([]byte, opts.PartSize)
+	n, err := io.ReadFull(r, first)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return 0, err
+	}
+	if err != nil {
+		// The reader ended within the first buffer.
+		return store.WriteWithContext(ctx, path, bytes.NewReader(first[:n]), int64(n), ps...)
+	}
+
+	if mp, ok := store.(types.Multiparter); ok {
+		return multipart(ctx, store, mp, path, first, r, opts, ps)
+	}
+	if a, ok := store.(types.Appender); ok {
+		return appendAll(ctx, store, a, path, first, r, ps)
+	}
+	return 0, fmt.Errorf("stream write %s: size unknown: %w", path, services.ErrCapabilityInsufficient)
+}
+
+func multipart(ctx context.Context, store types.Storager, mp types.Multiparter, path string, first []byte, r io.Reader, opts Options, ps []types.Pair) (int64, error) {
+	o, err := mp.CreateMultipartWithContext(ctx, path, ps...)
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Buffers are recycled through free, so that at most Concurrency
+	// parts are in memory. first is one of them.
+	free := make(chan []byte, opts.Concurrency)
+	for i := 1; i < opts.Concurrency; i++ {
+		free <- nil
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		parts []*types.Part
+		upErr error
+	)
+	upload := func(index int, buf []byte) {
+		defer wg.Done()
+
+		_, part, err := mp.WriteMultipartWithContext(ctx, o, bytes.NewReader(buf), int64(len(buf)), index)
+		mu.Lock()
+		if err != nil && upErr == nil {
+			upErr = fmt.Errorf("write part %d: %w", index, err)
+			cancel()
+		}
+		if err == nil {
+			parts = append(parts, part)
+		}
+		mu.Unlock()
+		free <- buf[:cap(buf)]
+	}
+	failed := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return upErr
+	}
+
+	var total int64
+	var readErr error
+	buf := first
+	for index := 0; ; index++ {
+		total += int64(len(buf))
+		wg.Add(1)
+		go upload(index, buf)
+
+		if int64(len(buf)) < opts.PartSize {
+			break
+		}
+		if index+1 >= opts.MaxParts {
+			// The reader may end right after the last part.
+			_, err := io.ReadFull(r, make([]byte, 1))
+			switch {
+			case errors.Is(err, io.EOF):
+			case err != nil:
+				readErr = err
+			default:
+				readErr = fmt.Errorf("%d parts of %d bytes: %w", opts.MaxParts, opts.PartSize, ErrTooManyParts)
+			}
+			break
+		}
+
+		buf = <-free
+		if failed() != nil {
+			break
+		}
+		if buf == nil {
+			buf = make([]byte, opts.PartSize)
+		}
+		n, err := io.ReadFull(r, buf)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			readErr = err
+			break
+		}
+		buf = buf[:n]
+	}
+	wg.Wait()
+
+	if err := readErr; err != nil || failed() != nil {
+		if err == nil {
+			err = failed()
+		}
+		// Abort the upload, so that the parts don't linger.
+		if id, ok := o.GetMultipartID(); ok {
+			_ = store.DeleteWithContext(context.Background(), path, pairs.WithMultipartID(id))
+		}
+		return 0, err
+	}
+
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Index < parts[j].Index })
+	if err := mp.CompleteMultipartWithContext(ctx, o, parts); err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+// appendAll appends r to a new object, which is deleted on failure.
+func appendAll(ctx context.Context, store types.Storager, a types.Appender, path string, buf []byte, r io.Reader, ps []types.Pair) (int64, error) {
+	o, err := a.CreateAppendWithContext(ctx, path, ps...)
+	if err != nil {
+		return 0, err
+	}
+	abort := func(err error) (int64, error) {
+		// Don't leave a partial object behind.
+		_ = store.DeleteWithContext(context.Background(), path)
+		return 0, err
+	}
+
+	var total int64
+	for {
+		if _, err := a.WriteAppendWithContext(ctx, o, bytes.NewReader(buf), int64(len(buf))); err != nil {
+			return abort(err)
+		}
+		total += int64(len(buf))
+
+		n, err := io.ReadFull(r, buf[:cap(buf)])
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			return abort(err)
+		}
+		buf = buf[:n]
+	}
+
+	if err := a.CommitAppendWithContext(ctx, o); err != nil {
+		return abort(err)
+	}
+	return total, nil
+}
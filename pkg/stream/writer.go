@@ -0,0 +1,57 @@
+package stream
+
+import (
+	"context"
+	"io"
+
+	"go.beyondstorage.io/v5/types"
+)
+
+// Writer is an io.WriteCloser writing to an object through Write, for
+// producers which write instead of being read, like compressors.
+type Writer struct {
+	pw   *io.PipeWriter
+	done chan struct{}
+	n    int64
+	err  error
+}
+
+// NewWriter starts writing to path. The object is complete once Close
+// returns nil.
+func NewWriter(ctx context.Context, store types.Storager, path string, opts Options, ps ...types.Pair) *Writer {
+	pr, pw := io.Pipe()
+	w := &Writer{pw: pw, done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+
+		w.n, w.err = Write(ctx, store, path, pr, opts, ps...)
+		// Unblock the producer if Write returned early.
+		pr.CloseWithError(w.err)
+	}()
+	return w
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	return w.pw.Write(p)
+}
+
+// Close ends the object, and waits until it's written.
+func (w *Writer) Close() error {
+	w.pw.Close()
+	<-w.done
+	return w.err
+}
+
+// CloseWithError aborts the object if Write hasn't completed yet: parts
+// uploaded so far are aborted, and an object being appended is deleted.
+func (w *Writer) CloseWithError(err error) error {
+	w.pw.CloseWithError(err)
+	<-w.done
+	return w.err
+}
+
+// Written returns the size of the object once closed.
+func (w *Writer) Written() int64 {
+	<-w.done
+	return w.n
+}
@@ -0,0 +1,55 @@
+package example
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"go.beyondstorage.io/example/pkg/probe"
+)
+
+func ProbeStoragers(path string) {
+	stores := LoadStoragers(path)
+
+	// probe.New checks every storager with a List on its work dir.
+	//
+	// With `Canary`, a small `.probe-<random>` object will be written, read back
+	// and deleted, so missing write permissions are caught at startup too.
+	p := probe.New(stores, probe.Options{
+		Canary:  true,
+		Timeout: 5 * time.Second,
+	})
+
+	report := p.Run(context.Background())
+	for _, r := range report.Storagers {
+		log.Printf("%s (%s): healthy %v, capabilities %v", r.Name, r.Service, r.Healthy, r.Capabilities)
+		for _, c := range r.Checks {
+			if !c.OK {
+				log.Printf("  %s failed in %s: %s", c.Name, c.Duration, c.Error)
+			}
+		}
+	}
+	if !report.Healthy {
+		log.Fatalf("storagers in %v are not healthy", path)
+	}
+}
+
+func ServeReadiness(path, addr string) {
+	stores := LoadStoragers(path)
+
+	// Handler responds 200 if all storagers are healthy and 503 otherwise,
+	// the report is cached for `CacheFor`.
+	p := probe.New(stores, probe.Options{
+		CacheFor: 30 * time.Second,
+	})
+
+	http.Handle("/readyz", p.Handler())
+
+	log.Printf("listening on %s", addr)
+
+	err := http.ListenAndServe(addr, nil)
+	if err != nil {
+		log.Fatalf("ListenAndServe %v: %v", addr, err)
+	}
+}
@@ -0,0 +1,51 @@
+package example
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.beyondstorage.io/example/pkg/config"
+	"go.beyondstorage.io/example/pkg/registry"
+)
+
+func NewRegistry(path string) *registry.Registry {
+	c, err := config.Load(path)
+	if err != nil {
+		log.Fatalf("config.Load %v: %v", path, err)
+	}
+
+	// registry.New doesn't create any storager, each of them will be created
+	// on first use and shared by all goroutines afterwards.
+	r := registry.New(c, registry.Options{})
+
+	// Reload on SIGHUP, only storagers whose profile has changed are replaced.
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	go func() {
+		for range ch {
+			if err := r.ReloadFile(path); err != nil {
+				log.Printf("ReloadFile %v: %v", path, err)
+			}
+		}
+	}()
+	return r
+}
+
+func ReadFromProfileURI(r *registry.Registry, uri string) []byte {
+	// Lookup resolves `profile://<profile>/<path>` into the storager of the
+	// profile and the path relative to its work dir.
+	store, path, err := r.Lookup(uri)
+	if err != nil {
+		log.Fatalf("Lookup %v: %v", uri, err)
+	}
+
+	var buf bytes.Buffer
+	_, err = store.Read(path, &buf)
+	if err != nil {
+		log.Fatalf("read %v: %v", uri, err)
+	}
+	return buf.Bytes()
+}
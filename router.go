@@ -0,0 +1,46 @@
+package example
+
+import (
+	"log"
+
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/router"
+)
+
+func NewRouter() types.Storager {
+	hot, err := NewMinio()
+	if err != nil {
+		log.Fatalf("NewMinio: %v", err)
+	}
+	archive, err := NewS3()
+	if err != nil {
+		log.Fatalf("NewS3: %v", err)
+	}
+	scratch, err := NewFs()
+	if err != nil {
+		log.Fatalf("NewFs: %v", err)
+	}
+
+	// router.New creates a Storager which dispatches every call to the
+	// storager mounted at the longest matching prefix, with the prefix
+	// stripped: `hot/a.txt` will be `a.txt` in minio.
+	r := router.New()
+	if err := r.Mount("/hot/", hot); err != nil {
+		log.Fatalf("Mount: %v", err)
+	}
+	if err := r.Mount("/archive/", archive); err != nil {
+		log.Fatalf("Mount: %v", err)
+	}
+	if err := r.Mount("/scratch/", scratch); err != nil {
+		log.Fatalf("Mount: %v", err)
+	}
+
+	// List on `` returns `hot/`, `archive/` and `scratch/` as dirs.
+	//
+	// r.Storager returns the router implementing only the optional
+	// interfaces which minio, s3 and fs all implement, check them with a
+	// type assertion. Mounting a storager without them fails from now on.
+	// Copy and Move only work inside a mount.
+	return r.Storager()
+}
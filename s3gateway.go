@@ -0,0 +1,51 @@
+package example
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/s3gateway"
+)
+
+func ServeS3Gateway(addr string) {
+	hdfs, err := NewHDFS()
+	if err != nil {
+		log.Fatalf("NewHDFS: %v", err)
+	}
+	ftp, err := NewFTP()
+	if err != nil {
+		log.Fatalf("NewFTP: %v", err)
+	}
+	fs, err := NewFs()
+	if err != nil {
+		log.Fatalf("NewFs: %v", err)
+	}
+
+	// s3gateway.New creates an http.Handler which speaks the S3 API.
+	//
+	// `Buckets` maps bucket names to storagers, requests must be path-style: `/<bucket>/<key>`.
+	// Multipart uploads are only available on buckets whose storager implements `Multiparter`.
+	//
+	// `Credentials` maps access key IDs to secret access keys, every request will be
+	// verified with AWS Signature Version 4.
+	g := s3gateway.New(s3gateway.Options{
+		Buckets: map[string]types.Storager{
+			"hdfs":  hdfs,
+			"ftp":   ftp,
+			"local": fs,
+		},
+		Credentials: map[string]string{
+			os.Getenv("S3_GATEWAY_ACCESS_KEY"): os.Getenv("S3_GATEWAY_SECRET_KEY"),
+		},
+	})
+
+	log.Printf("listening on %s", addr)
+
+	err = http.ListenAndServe(addr, g)
+	if err != nil {
+		log.Fatalf("ListenAndServe %v: %v", addr, err)
+	}
+}
@@ -0,0 +1,88 @@
+package example
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.beyondstorage.io/example/pkg/spool"
+)
+
+func NewFTPWithSpool(dir string) *spool.Spool {
+	ftp, err := NewFTP()
+	if err != nil {
+		log.Fatalf("NewFTP: %v", err)
+	}
+
+	// spool.New stages writes to ftp in dir, and uploads them in background.
+	//
+	// Items left in dir by a previous run are uploaded again. Failed uploads
+	// are retried with backoff from 5s up to 10m, and kept as failed after 20
+	// attempts.
+	s, err := spool.New(dir, ftp, spool.Options{
+		Workers:     2,
+		MaxAttempts: 20,
+		MinBackoff:  5 * time.Second,
+		MaxBackoff:  10 * time.Minute,
+		ErrorLog:    log.Printf,
+	})
+	if err != nil {
+		log.Fatalf("spool.New: %v", err)
+	}
+	return s
+}
+
+func NewIPFSWithSpool(dir string) *spool.Spool {
+	ipfs, err := NewIPFS()
+	if err != nil {
+		log.Fatalf("NewIPFS: %v", err)
+	}
+
+	// Retry forever with a negative MaxAttempts.
+	s, err := spool.New(dir, ipfs, spool.Options{
+		MaxAttempts: -1,
+		ErrorLog:    log.Printf,
+	})
+	if err != nil {
+		log.Fatalf("spool.New: %v", err)
+	}
+	return s
+}
+
+func WriteWithSpool(s *spool.Spool, path string, content string) {
+	// Write returns once the content is synced to the spool.
+	_, err := s.Write(path, strings.NewReader(content), int64(len(content)))
+	if err != nil {
+		log.Fatalf("write %v: %v", path, err)
+	}
+
+	st := s.Status()
+	log.Printf("%d pending, %d uploading, %d failed", st.Pending, st.Uploading, st.Failed)
+	for _, it := range st.Items {
+		if it.State == spool.StateFailed {
+			log.Printf("%s %s failed after %d attempts: %s", it.Op, it.Path, it.Attempts, it.LastError)
+		}
+	}
+}
+
+func CloseSpool(s *spool.Spool) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	// Wait for pending items before closing, the rest is uploaded on next
+	// start.
+	if err := s.Flush(ctx); err != nil {
+		log.Printf("flush: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		log.Fatalf("close: %v", err)
+	}
+}
+
+func ServeSpoolStatus(s *spool.Spool, addr string) {
+	// GET reports the pending and failed items, POST retries the failed ones.
+	http.Handle("/spool", s.Handler())
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
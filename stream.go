@@ -0,0 +1,53 @@
+package example
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"log"
+	"os"
+
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/stream"
+)
+
+func WriteUnknownSize(store types.Storager, path string) {
+	// stream.Write reads until EOF, the size is not needed.
+	//
+	// Up to `PartSize` is buffered to be written by Write. Longer data is
+	// uploaded via multipart, or append, with `Concurrency` parts in memory
+	// at most.
+	n, err := stream.Write(context.Background(), store, path, os.Stdin, stream.Options{
+		PartSize:    16 * 1024 * 1024,
+		Concurrency: 4,
+	})
+	if err != nil {
+		log.Fatalf("write %v: %v", path, err)
+	}
+
+	log.Printf("write size: %d", n)
+}
+
+func WriteCompressed(store types.Storager, path string, src io.Reader) {
+	// stream.NewWriter returns an io.WriteCloser, which could be given to a
+	// compressor.
+	w := stream.NewWriter(context.Background(), store, path, stream.Options{})
+	zw := gzip.NewWriter(w)
+
+	if _, err := io.Copy(zw, src); err != nil {
+		// Nothing is written if the source failed.
+		_ = w.CloseWithError(err)
+		log.Fatalf("compress: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		log.Fatalf("compress: %v", err)
+	}
+
+	// The object is complete once Close returns.
+	if err := w.Close(); err != nil {
+		log.Fatalf("write %v: %v", path, err)
+	}
+
+	log.Printf("compressed size: %d", w.Written())
+}
@@ -0,0 +1,32 @@
+//go:build go1.16
+// +build go1.16
+
+package example
+
+import (
+	"log"
+	"net/http"
+
+	"go.beyondstorage.io/v5/types"
+
+	"go.beyondstorage.io/example/pkg/davfs"
+)
+
+func ServeWebDAV(store types.Storager, addr string) {
+	// davfs.NewHandler creates a `*webdav.Handler` from golang.org/x/net/webdav.
+	//
+	// `prefix` is the URL path prefix to strip, use "" to serve at the root.
+	//
+	// Large PUT bodies are uploaded via multipart if `store` implements `Multiparter`.
+	h := davfs.NewHandler(store, "/dav")
+
+	mux := http.NewServeMux()
+	mux.Handle("/dav/", h)
+
+	log.Printf("listening on %s", addr)
+
+	err := http.ListenAndServe(addr, mux)
+	if err != nil {
+		log.Fatalf("ListenAndServe %v: %v", addr, err)
+	}
+}